@@ -1,22 +1,47 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/AsterZephyr/Scree-go-AZlearn/logger"
 	"github.com/gorilla/sessions"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var compareHashAndPassword = bcrypt.CompareHashAndPassword
+
+// dummyHash is checked against when a user doesn't exist.
+const dummyHash = "$2a$12$kNgc2ZYAXzIL6SHY.8PHAOQ8Casi0s1bKatYoG/jupt2yV1M5K5nO"
+
 type Users struct {
 	Lookup         map[string]string
 	store          sessions.Store
 	sessionTimeout int
+	cookie         CookieOptions
+	trustProxy     bool
+	registry       *sessionRegistry
+	http           *HTTPAuth
+	proxy          *ProxyAuth
+	limiter        *LoginLimiter
+}
+
+// CookieOptions configures the attributes of the session cookie.
+type CookieOptions struct {
+	Name     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
 }
 
 type UserPW struct {
@@ -45,11 +70,14 @@ func read(r io.Reader) ([]UserPW, error) {
 	return result, nil
 }
 
-func ReadPasswordsFile(path string, secret []byte, sessionTimeout int) (*Users, error) {
+func ReadPasswordsFile(path string, secret []byte, sessionTimeout int, trustProxy bool, cookie CookieOptions) (*Users, error) {
 	users := &Users{
 		Lookup:         map[string]string{},
 		sessionTimeout: sessionTimeout,
+		cookie:         cookie,
+		trustProxy:     trustProxy,
 		store:          sessions.NewCookieStore(secret),
+		registry:       newSessionRegistry(),
 	}
 	if path == "" {
 		log.Info().Msg("Users file not specified")
@@ -77,18 +105,125 @@ type Response struct {
 	Message string `json:"message"`
 }
 
+// UseHTTP delegates credential checks to an external HTTP service instead of
+// the users file.
+func (u *Users) UseHTTP(backend *HTTPAuth) {
+	u.http = backend
+}
+
+// UseProxy takes the current user from the header of an authenticating
+// reverse proxy instead of the session cookie.
+func (u *Users) UseProxy(proxy *ProxyAuth) {
+	u.proxy = proxy
+}
+
+// UseLoginLimiter enables brute-force protection for the login endpoint.
+func (u *Users) UseLoginLimiter(limiter *LoginLimiter) {
+	u.limiter = limiter
+}
+
+// ClientIP returns the ip of the client, honoring X-Real-IP when proxy headers
+// are trusted.
+func (u *Users) ClientIP(r *http.Request) string {
+	return u.clientIP(r)
+}
+
+// clientIP returns the ip of the client, honoring X-Real-IP when proxy headers
+// are trusted.
+func (u *Users) clientIP(r *http.Request) string {
+	if realIP := r.Header.Get("X-Real-IP"); u.trustProxy && realIP != "" {
+		return realIP
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// newSession creates an empty session with the configured cookie attributes.
+func (u *Users) newSession(maxAge int) *sessions.Session {
+	session := sessions.NewSession(u.store, u.cookie.Name)
+	session.IsNew = true
+	session.Options = &sessions.Options{
+		Path:     "/",
+		Domain:   u.cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   u.cookie.Secure,
+		HttpOnly: true,
+		SameSite: u.cookie.SameSite,
+	}
+	return session
+}
+
 func (u *Users) CurrentUser(r *http.Request) (string, bool) {
-	s, _ := u.store.Get(r, "user")
-	user, ok := s.Values["user"].(string)
+	if u.proxy != nil {
+		user, ok := u.proxy.User(r)
+		if !ok {
+			return "guest", false
+		}
+		return user, true
+	}
+	user, _, ok := u.currentSession(r)
 	if !ok {
 		return "guest", ok
 	}
 	return user, ok
 }
 
+func (u *Users) currentSession(r *http.Request) (string, string, bool) {
+	s, _ := u.store.Get(r, u.cookie.Name)
+	user, ok := s.Values["user"].(string)
+	if !ok {
+		return "", "", false
+	}
+	id, ok := s.Values["sid"].(string)
+	if !ok || !u.registry.valid(user, id) {
+		return "", "", false
+	}
+	return user, id, true
+}
+
+// AuthenticateSession returns the current user like CurrentUser and counts
+// the attempt if the request carries a session cookie. It's used once per
+// WebSocket connection, requests that only read the user aren't counted.
+func (u *Users) AuthenticateSession(r *http.Request) (string, bool) {
+	user, ok := u.CurrentUser(r)
+	if u.proxy == nil {
+		if s, _ := u.store.Get(r, u.cookie.Name); s != nil {
+			if _, presented := s.Values["user"].(string); presented {
+				CountAttempt(AttemptSession, ok)
+			}
+		}
+	}
+	return user, ok
+}
+
 func (u *Users) Logout(w http.ResponseWriter, r *http.Request) {
-	session := sessions.NewSession(u.store, "user")
-	session.IsNew = true
+	if user, id, ok := u.currentSession(r); ok {
+		u.registry.remove(user, id)
+	}
+	u.clearSession(w, r)
+}
+
+// LogoutAll revokes every session of the current user.
+func (u *Users) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := u.currentSession(r)
+	if !ok {
+		w.WriteHeader(401)
+		_ = json.NewEncoder(w).Encode(&Response{
+			Message: "not logged in",
+		})
+		return
+	}
+	count := u.registry.removeAll(user)
+	logoutAllTotal.Inc()
+	log.Info().Str("user", user).Int("sessions", count).Msg("Logged out all sessions")
+	u.clearSession(w, r)
+}
+
+func (u *Users) clearSession(w http.ResponseWriter, r *http.Request) {
+	session := u.newSession(0)
 	if err := u.store.Save(r, w, session); err != nil {
 		w.WriteHeader(500)
 		_ = json.NewEncoder(w).Encode(&Response{
@@ -103,18 +238,49 @@ func (u *Users) Authenticate(w http.ResponseWriter, r *http.Request) {
 	user := r.FormValue("user")
 	pass := r.FormValue("pass")
 
-	if !u.Validate(user, pass) {
+	ip := u.clientIP(r)
+	keys := []string{"ip:" + ip, "user:" + user}
+	if u.limiter != nil {
+		if remaining, locked := u.limiter.Locked(keys...); locked {
+			log.Warn().Str("ip", logger.Addr(ip)).Str("user", user).Msg("Login locked out")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+			w.WriteHeader(429)
+			_ = json.NewEncoder(w).Encode(&Response{
+				Message: "too many failed login attempts",
+			})
+			return
+		}
+	}
+
+	name, ok := u.check(user, pass)
+	CountAttempt(AttemptLogin, ok)
+	if !ok {
+		log.Info().Str("ip", logger.Addr(ip)).Str("user", user).Msg("Login failed")
+		if u.limiter != nil {
+			u.limiter.Fail(keys...)
+		}
 		w.WriteHeader(401)
 		_ = json.NewEncoder(w).Encode(&Response{
 			Message: "could not authenticate",
 		})
 		return
 	}
+	if u.limiter != nil {
+		u.limiter.Succeed(keys...)
+	}
 
-	session := sessions.NewSession(u.store, "user")
-	session.IsNew = true
-	session.Options.MaxAge = u.sessionTimeout
-	session.Values["user"] = user
+	id, err := u.registry.add(name, time.Duration(u.sessionTimeout)*time.Second)
+	if err != nil {
+		w.WriteHeader(500)
+		_ = json.NewEncoder(w).Encode(&Response{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	session := u.newSession(u.sessionTimeout)
+	session.Values["user"] = name
+	session.Values["sid"] = id
 	if err := u.store.Save(r, w, session); err != nil {
 		w.WriteHeader(500)
 		_ = json.NewEncoder(w).Encode(&Response{
@@ -129,6 +295,26 @@ func (u *Users) Authenticate(w http.ResponseWriter, r *http.Request) {
 }
 
 func (u Users) Validate(user, password string) bool {
-	realPassword, exists := u.Lookup[user]
-	return exists && bcrypt.CompareHashAndPassword([]byte(realPassword), []byte(password)) == nil
+	_, ok := u.check(user, password)
+	CountAttempt(AttemptBasic, ok)
+	return ok
+}
+
+func (u Users) check(user, password string) (string, bool) {
+	if u.http != nil {
+		return u.http.Authenticate(user, password)
+	}
+
+	// Every user is compared and the hash check runs even for unknown users,
+	// so the response time doesn't reveal which usernames exist.
+	realPassword := dummyHash
+	exists := 0
+	for name, hash := range u.Lookup {
+		if subtle.ConstantTimeCompare([]byte(name), []byte(user)) == 1 {
+			realPassword = hash
+			exists = 1
+		}
+	}
+	valid := compareHashAndPassword([]byte(realPassword), []byte(password)) == nil
+	return user, exists == 1 && valid
 }
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestValidate_comparesUnknownUser(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	users := Users{Lookup: map[string]string{"user1": string(hash)}}
+
+	calls := 0
+	old := compareHashAndPassword
+	compareHashAndPassword = func(hash, password []byte) error {
+		calls++
+		return old(hash, password)
+	}
+	defer func() {
+		compareHashAndPassword = old
+	}()
+
+	assert.True(t, users.Validate("user1", "secret"))
+	assert.Equal(t, 1, calls)
+
+	assert.False(t, users.Validate("user1", "wrong"))
+	assert.Equal(t, 2, calls)
+
+	assert.False(t, users.Validate("unknown", "secret"))
+	assert.Equal(t, 3, calls, "unknown users must run the hash comparison")
+
+	assert.False(t, users.Validate("user", "secret"))
+	assert.Equal(t, 4, calls, "username prefixes must not match")
+}
+
+func TestAuthAttempts_countsOnlyAuthentication(t *testing.T) {
+	users, err := ReadPasswordsFile("", []byte("secret"), 0, false, CookieOptions{Name: "user"})
+	require.NoError(t, err)
+	hash, err := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users.Lookup["user1"] = string(hash)
+	count := func(mode, outcome string) float64 {
+		return testutil.ToFloat64(authAttemptsTotal.WithLabelValues(mode, outcome))
+	}
+	login := func(pass string) *httptest.ResponseRecorder {
+		form := url.Values{"user": {"user1"}, "pass": {pass}}
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		users.Authenticate(rec, req)
+		return rec
+	}
+
+	loginFailures, loginSuccesses := count(AttemptLogin, "failure"), count(AttemptLogin, "success")
+	assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+	rec := login("pass")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, loginFailures+1, count(AttemptLogin, "failure"))
+	assert.Equal(t, loginSuccesses+1, count(AttemptLogin, "success"))
+
+	basicFailures := count(AttemptBasic, "failure")
+	assert.False(t, users.Validate("user1", "wrong"))
+	assert.Equal(t, basicFailures+1, count(AttemptBasic, "failure"))
+
+	withCookie := httptest.NewRequest("GET", "/config", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		withCookie.AddCookie(cookie)
+	}
+	sessions := count(AttemptSession, "success")
+	for i := 0; i < 3; i++ {
+		_, ok := users.CurrentUser(withCookie)
+		assert.True(t, ok)
+		_, ok = users.CurrentUser(httptest.NewRequest("GET", "/config", nil))
+		assert.False(t, ok)
+	}
+	assert.Equal(t, sessions, count(AttemptSession, "success"), "reading the current user isn't an attempt")
+
+	guests := count(AttemptSession, "failure")
+	_, ok := users.AuthenticateSession(withCookie)
+	assert.True(t, ok)
+	_, ok = users.AuthenticateSession(httptest.NewRequest("GET", "/stream", nil))
+	assert.False(t, ok)
+	assert.Equal(t, sessions+1, count(AttemptSession, "success"))
+	assert.Equal(t, guests, count(AttemptSession, "failure"), "requests without a session cookie aren't counted")
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// HTTPAuth delegates credential checks to an external HTTP service.
+type HTTPAuth struct {
+	url      string
+	client   *http.Client
+	cacheTTL time.Duration
+
+	lock  sync.Mutex
+	cache map[string]httpCacheEntry
+}
+
+type httpCacheEntry struct {
+	user    string
+	expires time.Time
+}
+
+type httpAuthRequest struct {
+	User string `json:"user"`
+	Pass string `json:"pass"`
+}
+
+type httpAuthResponse struct {
+	Authenticated bool   `json:"authenticated"`
+	User          string `json:"user"`
+}
+
+// NewHTTPAuth creates a HTTPAuth posting credentials to url. Successful
+// authentications are cached for cacheTTL.
+func NewHTTPAuth(url string, timeout time.Duration, insecureSkipVerify bool, cacheTTL time.Duration) *HTTPAuth {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	return &HTTPAuth{
+		url:      url,
+		client:   &http.Client{Timeout: timeout, Transport: transport},
+		cacheTTL: cacheTTL,
+		cache:    map[string]httpCacheEntry{},
+	}
+}
+
+// Authenticate returns the username reported by the external service and
+// whether the credentials were accepted.
+func (a *HTTPAuth) Authenticate(user, pass string) (string, bool) {
+	key := cacheKey(user, pass)
+	if name, ok := a.cached(key); ok {
+		return name, true
+	}
+
+	name, err := a.request(user, pass)
+	if err != nil {
+		log.Error().Err(err).Str("url", a.url).Str("user", user).Msg("HTTP auth")
+		return "", false
+	}
+	if name == "" {
+		return "", false
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	now := time.Now()
+	for k, entry := range a.cache {
+		if entry.expires.Before(now) {
+			delete(a.cache, k)
+		}
+	}
+	a.cache[key] = httpCacheEntry{user: name, expires: now.Add(a.cacheTTL)}
+	return name, true
+}
+
+func (a *HTTPAuth) cached(key string) (string, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	entry, ok := a.cache[key]
+	if !ok {
+		return "", false
+	}
+	if entry.expires.Before(time.Now()) {
+		delete(a.cache, key)
+		return "", false
+	}
+	return entry.user, true
+}
+
+func (a *HTTPAuth) request(user, pass string) (string, error) {
+	body, err := json.Marshal(&httpAuthRequest{User: user, Pass: pass})
+	if err != nil {
+		return "", err
+	}
+	resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	result := httpAuthResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("malformed response: %s", err)
+	}
+	if !result.Authenticated {
+		return "", nil
+	}
+	if result.User == "" {
+		return user, nil
+	}
+	return result.User, nil
+}
+
+// cacheKey hashes the credentials so plain passwords aren't kept in memory.
+func cacheKey(user, pass string) string {
+	sum := sha256.Sum256([]byte(user + "\x00" + pass))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPAuth(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		req := httpAuthRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_ = json.NewEncoder(w).Encode(&httpAuthResponse{
+			Authenticated: req.Pass == "secret",
+			User:          "remote-" + req.User,
+		})
+	}))
+	defer srv.Close()
+
+	a := NewHTTPAuth(srv.URL, time.Second, false, time.Minute)
+
+	name, ok := a.Authenticate("user1", "secret")
+	assert.True(t, ok)
+	assert.Equal(t, "remote-user1", name)
+
+	_, ok = a.Authenticate("user1", "secret")
+	assert.True(t, ok)
+	assert.Equal(t, 1, calls, "successful auth should be cached")
+
+	_, ok = a.Authenticate("user1", "wrong")
+	assert.False(t, ok)
+	assert.Equal(t, 2, calls)
+}
+
+func TestHTTPAuth_unavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	a := NewHTTPAuth(srv.URL, time.Second, false, time.Minute)
+	_, ok := a.Authenticate("user1", "secret")
+	assert.False(t, ok)
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// maxLockoutShift caps the exponential backoff at 2^maxLockoutShift times the
+// base lockout duration.
+const maxLockoutShift = 10
+
+// LoginLimiter tracks failed login attempts and temporarily locks out clients
+// and usernames after too many failures.
+type LoginLimiter struct {
+	lock        sync.Mutex
+	maxAttempts int
+	lockout     time.Duration
+	window      time.Duration
+	attempts    map[string]*loginAttempts
+	lastSweep   time.Time
+	now         func() time.Time
+}
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// NewLoginLimiter creates a LoginLimiter that locks out a key for lockout
+// after maxAttempts failures. Each further failure doubles the lockout.
+// Failures older than window are forgotten.
+func NewLoginLimiter(maxAttempts int, lockout, window time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		maxAttempts: maxAttempts,
+		lockout:     lockout,
+		window:      window,
+		attempts:    map[string]*loginAttempts{},
+		now:         time.Now,
+	}
+}
+
+// Locked returns the remaining lockout duration if any of the keys are locked.
+func (l *LoginLimiter) Locked(keys ...string) (time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	var remaining time.Duration
+	for _, key := range keys {
+		entry, ok := l.attempts[key]
+		if !ok {
+			continue
+		}
+		if left := entry.lockedUntil.Sub(now); left > remaining {
+			remaining = left
+		}
+	}
+	return remaining, remaining > 0
+}
+
+// Fail records a failed attempt for all keys.
+func (l *LoginLimiter) Fail(keys ...string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	for _, key := range keys {
+		entry, ok := l.attempts[key]
+		if !ok || now.Sub(entry.lastFailure) > l.window {
+			entry = &loginAttempts{}
+			l.attempts[key] = entry
+		}
+		entry.failures++
+		entry.lastFailure = now
+		if entry.failures >= l.maxAttempts {
+			shift := entry.failures - l.maxAttempts
+			if shift > maxLockoutShift {
+				shift = maxLockoutShift
+			}
+			entry.lockedUntil = now.Add(l.lockout << shift)
+		}
+	}
+}
+
+// Succeed clears the failed attempts of all keys.
+func (l *LoginLimiter) Succeed(keys ...string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, key := range keys {
+		delete(l.attempts, key)
+	}
+}
+
+// sweep evicts expired entries, at most once per minute.
+func (l *LoginLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, entry := range l.attempts {
+		if now.Sub(entry.lastFailure) > l.window && now.After(entry.lockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+}
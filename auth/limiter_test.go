@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	type step struct {
+		after   time.Duration // advance the clock before the step
+		fail    bool          // record a failure
+		succeed bool          // record a successful login
+		locked  time.Duration // expected remaining lockout after the step
+	}
+	for _, tc := range []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "locks after max attempts",
+			steps: []step{
+				{fail: true},
+				{fail: true},
+				{fail: true, locked: time.Minute},
+			},
+		},
+		{
+			name: "backoff doubles with every further failure",
+			steps: []step{
+				{fail: true},
+				{fail: true},
+				{fail: true, locked: time.Minute},
+				{after: time.Minute, fail: true, locked: 2 * time.Minute},
+				{after: 2 * time.Minute, fail: true, locked: 4 * time.Minute},
+				{after: time.Minute, locked: 3 * time.Minute},
+			},
+		},
+		{
+			name: "lockout expires",
+			steps: []step{
+				{fail: true},
+				{fail: true},
+				{fail: true, locked: time.Minute},
+				{after: 59 * time.Second, locked: time.Second},
+				{after: time.Second},
+			},
+		},
+		{
+			name: "failures outside the window are forgotten",
+			steps: []step{
+				{fail: true},
+				{fail: true},
+				{after: 10*time.Minute + time.Second, fail: true},
+				{fail: true},
+				{fail: true, locked: time.Minute},
+			},
+		},
+		{
+			name: "success clears the failures",
+			steps: []step{
+				{fail: true},
+				{fail: true},
+				{fail: true, locked: time.Minute},
+				{succeed: true},
+				{fail: true},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Unix(1000, 0)
+			limiter := NewLoginLimiter(3, time.Minute, 10*time.Minute)
+			limiter.now = func() time.Time { return now }
+			for i, s := range tc.steps {
+				now = now.Add(s.after)
+				if s.fail {
+					limiter.Fail("ip:192.0.2.1")
+				}
+				if s.succeed {
+					limiter.Succeed("ip:192.0.2.1")
+				}
+				remaining, locked := limiter.Locked("ip:192.0.2.1")
+				assert.Equal(t, s.locked, remaining, "step %d", i)
+				assert.Equal(t, s.locked > 0, locked, "step %d", i)
+			}
+		})
+	}
+}
+
+func TestLoginLimiter_backoffIsCapped(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := NewLoginLimiter(1, time.Second, time.Hour)
+	limiter.now = func() time.Time { return now }
+	for i := 0; i < 20; i++ {
+		limiter.Fail("user:admin")
+	}
+	remaining, _ := limiter.Locked("user:admin")
+	assert.Equal(t, time.Second<<maxLockoutShift, remaining)
+}
+
+func TestLoginLimiter_anyLockedKey(t *testing.T) {
+	limiter := NewLoginLimiter(1, time.Minute, time.Hour)
+	limiter.Fail("user:admin")
+	_, locked := limiter.Locked("ip:192.0.2.1", "user:admin")
+	assert.True(t, locked, "a locked username locks out every client")
+	_, locked = limiter.Locked("ip:192.0.2.1", "user:other")
+	assert.False(t, locked)
+}
+
+func TestLoginLimiter_evictsExpiredEntries(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := NewLoginLimiter(3, time.Minute, 10*time.Minute)
+	limiter.now = func() time.Time { return now }
+	limiter.Fail("ip:192.0.2.1")
+	limiter.Fail("ip:192.0.2.2", "ip:192.0.2.2", "ip:192.0.2.2")
+
+	now = now.Add(10*time.Minute + time.Second)
+	limiter.Fail("ip:192.0.2.3")
+	assert.NotContains(t, limiter.attempts, "ip:192.0.2.1")
+	assert.NotContains(t, limiter.attempts, "ip:192.0.2.2")
+	assert.Contains(t, limiter.attempts, "ip:192.0.2.3")
+
+	locked := NewLoginLimiter(1, time.Hour, time.Minute)
+	locked.now = func() time.Time { return now }
+	locked.Fail("ip:192.0.2.1")
+	now = now.Add(2 * time.Minute)
+	locked.Fail("ip:192.0.2.2")
+	assert.Contains(t, locked.attempts, "ip:192.0.2.1", "entries stay while locked out")
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	AttemptBasic   = "basic"
+	AttemptLogin   = "login"
+	AttemptSession = "session"
+	AttemptToken   = "token"
+)
+
+var (
+	logoutAllTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "screego_logout_all_total",
+		Help: "The total number of logouts of all sessions of a user",
+	})
+	authAttemptsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "screego_auth_attempts_total",
+		Help: "The total number of authentication attempts",
+	}, []string{"mode", "outcome"})
+)
+
+// RegisterMetrics registers the metrics that are only collected when
+// prometheus is enabled.
+func RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(authAttemptsTotal, logoutAllTotal)
+}
+
+// CountAttempt records an authentication attempt of the given mode.
+func CountAttempt(mode string, success bool) {
+	outcome := "failure"
+	if success {
+		outcome = "success"
+	}
+	authAttemptsTotal.WithLabelValues(mode, outcome).Inc()
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ProxyAuth reads the username from a header set by an authenticating reverse
+// proxy, e.g. oauth2-proxy. The header is only trusted on requests from the
+// given upstream networks, so clients cannot spoof it by connecting directly.
+type ProxyAuth struct {
+	header  string
+	trusted []*net.IPNet
+}
+
+// NewProxyAuth creates a ProxyAuth reading header on requests from trusted.
+func NewProxyAuth(header string, trusted []*net.IPNet) *ProxyAuth {
+	return &ProxyAuth{header: header, trusted: trusted}
+}
+
+// User returns the username set by the proxy and whether the request came
+// from a trusted upstream with a non-empty header.
+func (p *ProxyAuth) User(r *http.Request) (string, bool) {
+	if !p.isTrusted(r.RemoteAddr) {
+		return "", false
+	}
+	user := strings.TrimSpace(r.Header.Get(p.header))
+	return user, user != ""
+}
+
+func (p *ProxyAuth) isTrusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range p.trusted {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyAuth(t *testing.T) {
+	_, upstream, err := net.ParseCIDR("10.0.0.0/24")
+	require.NoError(t, err)
+	users, err := ReadPasswordsFile("", []byte("secret"), 0, true, CookieOptions{Name: "user"})
+	require.NoError(t, err)
+	users.UseProxy(NewProxyAuth("X-Auth-User", []*net.IPNet{upstream}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.5:40000"
+	req.Header.Set("X-Auth-User", "jmattheis")
+	user, ok := users.CurrentUser(req)
+	assert.True(t, ok)
+	assert.Equal(t, "jmattheis", user)
+
+	req.Header.Del("X-Auth-User")
+	user, ok = users.CurrentUser(req)
+	assert.False(t, ok, "requests without the header are not logged in")
+	assert.Equal(t, "guest", user)
+
+	spoofed := httptest.NewRequest("GET", "/", nil)
+	spoofed.RemoteAddr = "192.0.2.1:40000"
+	spoofed.Header.Set("X-Auth-User", "admin")
+	spoofed.Header.Set("X-Real-IP", "10.0.0.5")
+	_, ok = users.CurrentUser(spoofed)
+	assert.False(t, ok, "the header is ignored on requests from untrusted addresses")
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter allows a fixed number of requests per key within a window.
+type RateLimiter struct {
+	lock     sync.Mutex
+	limit    int
+	window   time.Duration
+	requests map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimiter creates a RateLimiter allowing limit requests per key
+// within window.
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{limit: limit, window: window, requests: map[string]*rateWindow{}}
+}
+
+// Allow records a request for key and returns the time until the next request
+// is allowed, if the limit is exceeded.
+func (l *RateLimiter) Allow(key string) (time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	for other, entry := range l.requests {
+		if now.Sub(entry.start) >= l.window {
+			delete(l.requests, other)
+		}
+	}
+	entry, ok := l.requests[key]
+	if !ok {
+		entry = &rateWindow{start: now}
+		l.requests[key] = entry
+	}
+	if entry.count >= l.limit {
+		return entry.start.Add(l.window).Sub(now), false
+	}
+	entry.count++
+	return 0, true
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(2, time.Hour)
+	_, ok := limiter.Allow("alice")
+	assert.True(t, ok)
+	_, ok = limiter.Allow("alice")
+	assert.True(t, ok)
+	retry, ok := limiter.Allow("alice")
+	assert.False(t, ok)
+	assert.InDelta(t, time.Hour, retry, float64(time.Second))
+
+	_, ok = limiter.Allow("bob")
+	assert.True(t, ok, "keys are limited separately")
+
+	limiter.window = 0
+	_, ok = limiter.Allow("alice")
+	assert.True(t, ok, "the limit resets after the window")
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// registrySweepInterval is the minimum time between two sweeps of expired
+// sessions of all users.
+const registrySweepInterval = time.Minute
+
+// sessionRegistry keeps track of the issued sessions per user, so that
+// sessions can be revoked before the cookie expires.
+type sessionRegistry struct {
+	lock     sync.Mutex
+	sessions map[string]map[string]time.Time
+	swept    time.Time // the last sweep of expired sessions
+	now      func() time.Time
+}
+
+func newSessionRegistry() *sessionRegistry {
+	return &sessionRegistry{sessions: map[string]map[string]time.Time{}, now: time.Now}
+}
+
+// add issues a new session id for user. A ttl of 0 means the session never
+// expires server side.
+func (s *sessionRegistry) add(user string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(raw)
+
+	now := s.now()
+	var expires time.Time
+	if ttl > 0 {
+		expires = now.Add(ttl)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// Only adding sessions grows the registry, so sweeping here keeps the
+	// sessions of users that never come back from piling up.
+	if now.Sub(s.swept) >= registrySweepInterval {
+		s.sweep(now)
+	}
+	userSessions, ok := s.sessions[user]
+	if !ok {
+		userSessions = map[string]time.Time{}
+		s.sessions[user] = userSessions
+	}
+	userSessions[id] = expires
+	return id, nil
+}
+
+// sweep removes the expired sessions of all users. The lock must be held.
+func (s *sessionRegistry) sweep(now time.Time) {
+	s.swept = now
+	for user, userSessions := range s.sessions {
+		for id, expires := range userSessions {
+			if expired(expires, now) {
+				delete(userSessions, id)
+			}
+		}
+		if len(userSessions) == 0 {
+			delete(s.sessions, user)
+		}
+	}
+}
+
+func expired(expires, now time.Time) bool {
+	return !expires.IsZero() && !expires.After(now)
+}
+
+func (s *sessionRegistry) valid(user, id string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	expires, ok := s.sessions[user][id]
+	if ok && expired(expires, s.now()) {
+		s.removeLocked(user, id)
+		return false
+	}
+	return ok
+}
+
+func (s *sessionRegistry) remove(user, id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.removeLocked(user, id)
+}
+
+func (s *sessionRegistry) removeLocked(user, id string) {
+	delete(s.sessions[user], id)
+	if len(s.sessions[user]) == 0 {
+		delete(s.sessions, user)
+	}
+}
+
+// removeAll revokes every session of user and returns the amount revoked.
+func (s *sessionRegistry) removeAll(user string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	count := len(s.sessions[user])
+	delete(s.sessions, user)
+	return count
+}
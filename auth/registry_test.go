@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSessionRegistry_expiry(t *testing.T) {
+	now := time.Unix(1000, 0)
+	registry := newSessionRegistry()
+	registry.now = func() time.Time { return now }
+
+	short, err := registry.add("user1", time.Minute)
+	require.NoError(t, err)
+	forever, err := registry.add("user1", 0)
+	require.NoError(t, err)
+	assert.True(t, registry.valid("user1", short))
+	assert.False(t, registry.valid("user2", short), "sessions belong to a user")
+
+	now = now.Add(time.Minute)
+	assert.False(t, registry.valid("user1", short))
+	assert.NotContains(t, registry.sessions["user1"], short, "expired sessions are removed on lookup")
+	assert.True(t, registry.valid("user1", forever), "a ttl of 0 never expires")
+
+	registry.remove("user1", forever)
+	assert.False(t, registry.valid("user1", forever))
+	assert.NotContains(t, registry.sessions, "user1")
+}
+
+func TestSessionRegistry_sweepsUsersThatDontReturn(t *testing.T) {
+	now := time.Unix(1000, 0)
+	registry := newSessionRegistry()
+	registry.now = func() time.Time { return now }
+
+	_, err := registry.add("gone", time.Minute)
+	require.NoError(t, err)
+	kept, err := registry.add("kept", time.Hour)
+	require.NoError(t, err)
+
+	now = now.Add(registrySweepInterval / 2)
+	_, err = registry.add("other", time.Hour)
+	require.NoError(t, err)
+	assert.Contains(t, registry.sessions, "gone", "not swept before the interval passed")
+
+	now = now.Add(registrySweepInterval)
+	_, err = registry.add("other", time.Hour)
+	require.NoError(t, err)
+	assert.NotContains(t, registry.sessions, "gone")
+	assert.True(t, registry.valid("kept", kept))
+	assert.Len(t, registry.sessions["other"], 2)
+}
+
+func TestLogoutAll_revokesExistingCookies(t *testing.T) {
+	users, err := ReadPasswordsFile("", []byte("secret"), 0, false, CookieOptions{Name: "user"})
+	require.NoError(t, err)
+	hash, err := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users.Lookup["user1"] = string(hash)
+
+	login := func() []*http.Cookie {
+		form := url.Values{"user": {"user1"}, "pass": {"pass"}}
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		users.Authenticate(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec.Result().Cookies()
+	}
+	request := func(path string, cookies []*http.Cookie) *http.Request {
+		req := httptest.NewRequest("POST", path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		return req
+	}
+
+	laptop, phone := login(), login()
+	_, ok := users.CurrentUser(request("/config", phone))
+	assert.True(t, ok)
+
+	before := testutil.ToFloat64(logoutAllTotal)
+	rec := httptest.NewRecorder()
+	users.LogoutAll(rec, request("/logout-all", laptop))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(logoutAllTotal))
+
+	_, ok = users.CurrentUser(request("/config", laptop))
+	assert.False(t, ok)
+	_, ok = users.CurrentUser(request("/config", phone))
+	assert.False(t, ok, "the cookies of other devices are revoked too")
+
+	rec = httptest.NewRecorder()
+	users.LogoutAll(rec, request("/logout-all", phone))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(logoutAllTotal))
+}
@@ -13,8 +13,9 @@ func Run(version, commitHash string) {
 		Name:    "screego",
 		Version: fmt.Sprintf("%s; screego/server@%s", version, commitHash),
 		Commands: []*cli.Command{
-			serveCmd(version),
+			serveCmd(version, commitHash),
 			hashCmd,
+			verifyCmd,
 		},
 	}
 	err := app.Run(os.Args)
@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"strings"
 	"syscall"
 
+	"github.com/AsterZephyr/Scree-go-AZlearn/config"
 	"github.com/AsterZephyr/Scree-go-AZlearn/logger"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -18,9 +21,28 @@ var hashCmd = &cli.Command{
 	Flags: []cli.Flag{
 		&cli.StringFlag{Name: "name"},
 		&cli.StringFlag{Name: "pass"},
+		&cli.StringFlag{
+			Name:  "file",
+			Usage: "hash all name:password lines of this file and print the users file",
+		},
+		&cli.IntFlag{
+			Name:  "cost",
+			Value: 12,
+			// the cost is stored in the hash, users files may mix different costs.
+			Usage: fmt.Sprintf("bcrypt cost (%d-%d)", bcrypt.MinCost, bcrypt.MaxCost),
+		},
 	},
 	Action: func(ctx *cli.Context) error {
-		logger.Init(zerolog.ErrorLevel)
+		logger.Init(zerolog.ErrorLevel, config.LogFormatConsole, 0)
+		cost := ctx.Int("cost")
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			log.Fatal().Int("cost", cost).Msgf("--cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		if file := ctx.String("file"); file != "" {
+			hashFile(file, cost)
+			return nil
+		}
+
 		name := ctx.String("name")
 		pass := []byte(ctx.String("pass"))
 		if name == "" {
@@ -28,15 +50,9 @@ var hashCmd = &cli.Command{
 		}
 
 		if len(pass) == 0 {
-			var err error
-			_, _ = fmt.Fprint(os.Stderr, "Enter Password: ")
-			pass, err = term.ReadPassword(int(syscall.Stdin))
-			if err != nil {
-				log.Fatal().Err(err).Msg("could not read stdin")
-			}
-			_, _ = fmt.Fprintln(os.Stderr, "")
-		}
-		hashedPw, err := bcrypt.GenerateFromPassword(pass, 12)
+			pass = readPassword()
+		}
+		hashedPw, err := bcrypt.GenerateFromPassword(pass, cost)
 		if err != nil {
 			log.Fatal().Err(err).Msg("could not generate password")
 		}
@@ -46,3 +62,47 @@ var hashCmd = &cli.Command{
 		return nil
 	},
 }
+
+// readPassword prompts for a password on the terminal.
+func readPassword() []byte {
+	_, _ = fmt.Fprint(os.Stderr, "Enter Password: ")
+	pass, err := term.ReadPassword(int(syscall.Stdin))
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not read stdin")
+	}
+	_, _ = fmt.Fprintln(os.Stderr, "")
+	return pass
+}
+
+// hashFile prints a users file for all name:password lines in path. Empty
+// lines and lines starting with # are skipped.
+func hashFile(path string, cost int) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal().Err(err).Str("file", path).Msg("could not open file")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNr := 0
+	for scanner.Scan() {
+		lineNr++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// split on the first colon, passwords may contain colons.
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Fatal().Int("line", lineNr).Str("file", path).Msg("expected name:password")
+		}
+		hashedPw, err := bcrypt.GenerateFromPassword([]byte(parts[1]), cost)
+		if err != nil {
+			log.Fatal().Err(err).Int("line", lineNr).Msg("could not generate password")
+		}
+		fmt.Printf("%s:%s\n", parts[0], string(hashedPw))
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal().Err(err).Str("file", path).Msg("could not read file")
+	}
+}
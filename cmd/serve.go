@@ -1,15 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
 	"os"
+	"time"
 
-	// "github.com/AsterZephyr/Scree-go-AZlearn/auth"
 	"github.com/AsterZephyr/Scree-go-AZlearn/auth"
 	"github.com/AsterZephyr/Scree-go-AZlearn/config"
 	"github.com/AsterZephyr/Scree-go-AZlearn/logger"
 	"github.com/AsterZephyr/Scree-go-AZlearn/router"
 	"github.com/AsterZephyr/Scree-go-AZlearn/server"
 	"github.com/AsterZephyr/Scree-go-AZlearn/turn"
+	"github.com/AsterZephyr/Scree-go-AZlearn/util"
 	"github.com/AsterZephyr/Scree-go-AZlearn/ws"
 
 	"github.com/rs/zerolog"
@@ -17,12 +20,13 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
-func serveCmd(version string) *cli.Command {
+func serveCmd(version, commitHash string) *cli.Command {
 	return &cli.Command{
 		Name: "serve",
 		Action: func(ctx *cli.Context) error {
 			conf, errs := config.Get()
-			logger.Init(conf.LogLevel.AsZeroLogLevel())
+			logger.Init(conf.LogLevel.AsZeroLogLevel(), conf.LogFormat, conf.LogSamplingN())
+			logger.RedactIP(conf.LogRedactIP)
 
 			exit := false
 			for _, err := range errs {
@@ -33,27 +37,116 @@ func serveCmd(version string) *cli.Command {
 				os.Exit(1)
 			}
 
+			log.Info().Str("version", version).Object("config", conf).Msg("Effective configuration")
+
 			if _, _, err := conf.TurnIPProvider.Get(); err != nil {
 				// error is already logged by .Get()
 				os.Exit(1)
 			}
 
-			users, err := auth.ReadPasswordsFile(conf.UsersFile, conf.Secret, conf.SessionTimeoutSeconds)
+			users, err := auth.ReadPasswordsFile(conf.UsersFile, conf.Secret, conf.SessionTimeoutSeconds, conf.TrustProxyHeaders, auth.CookieOptions{
+				Name:     conf.SessionCookieName,
+				Domain:   conf.SessionCookieDomain,
+				Secure:   conf.SessionCookieSecure,
+				SameSite: conf.SessionCookieSameSiteParsed,
+			})
 			if err != nil {
 				log.Fatal().Str("file", conf.UsersFile).Err(err).Msg("While loading users file")
 			}
+			if conf.LoginMaxAttempts > 0 {
+				users.UseLoginLimiter(auth.NewLoginLimiter(
+					conf.LoginMaxAttempts,
+					time.Duration(conf.LoginLockoutSeconds)*time.Second,
+					time.Duration(conf.LoginAttemptWindowSeconds)*time.Second))
+			}
+			if conf.AuthMode == config.AuthModeHTTP {
+				users.UseHTTP(auth.NewHTTPAuth(
+					conf.AuthHTTPURL,
+					time.Duration(conf.AuthHTTPTimeoutSeconds)*time.Second,
+					conf.AuthHTTPInsecureSkipVerify,
+					time.Duration(conf.AuthHTTPCacheSeconds)*time.Second))
+				log.Info().Str("url", conf.AuthHTTPURL).Msg("Using HTTP authentication")
+			}
+			if conf.AuthMode == config.AuthModeProxy {
+				users.UseProxy(auth.NewProxyAuth(conf.AuthProxyHeader, conf.AuthProxyTrustedUpstreamsParsed))
+				log.Info().Str("header", conf.AuthProxyHeader).Msg("Using proxy authentication")
+			}
 
 			tServer, err := turn.Start(conf)
 			if err != nil {
 				log.Fatal().Err(err).Msg("could not start turn server")
 			}
 
-			rooms := ws.NewRooms(tServer, users, conf)
+			names, err := util.ReadNames(conf.NamesAdjectivesFile, conf.NamesNounsFile)
+			if err != nil {
+				log.Fatal().Err(err).Msg("While loading name word lists")
+			}
+
+			blocklist, err := util.ReadBlocklist(conf.BlockedWordsFile, conf.BlockedWords)
+			if err != nil {
+				log.Fatal().Err(err).Msg("While loading blocked words")
+			}
+
+			roomOpts := []ws.Option{ws.WithNames(names), ws.WithBlocklist(blocklist)}
+			if conf.GeoIPDatabase != "" {
+				geoIP, err := util.ReadGeoIP(conf.GeoIPDatabase)
+				if err != nil {
+					log.Fatal().Err(err).Msg("While loading the geoip database")
+				}
+				roomOpts = append(roomOpts, ws.WithGeoIP(geoIP))
+				log.Info().Str("file", conf.GeoIPDatabase).Msg("Using geoip database")
+			}
+
+			rooms := ws.NewRooms(tServer, users, conf, roomOpts...)
 
-			go rooms.Start()
+			// cancelled on SIGINT or SIGTERM, stops the event loops
+			running, stop := context.WithCancel(ctx.Context)
+			defer stop()
+			go rooms.Start(running)
 
-			r := router.Router(conf, rooms, users, version)
-			if err := server.Start(r, conf.ServerAddress, conf.TLSCertFile, conf.TLSKeyFile); err != nil {
+			r := router.Router(conf, rooms, users, version, commitHash)
+			opts := server.Options{
+				ReadHeaderTimeout: time.Duration(conf.ServerReadHeaderTimeoutSeconds) * time.Second,
+				WriteTimeout:      time.Duration(conf.ServerWriteTimeoutSeconds) * time.Second,
+				IdleTimeout:       time.Duration(conf.ServerIdleTimeoutSeconds) * time.Second,
+				SocketMode:        conf.ServerSocketModeParsed,
+				ActivationName:    "http",
+				TLS: &tls.Config{
+					MinVersion:   conf.TLSMinVersionParsed,
+					CipherSuites: conf.TLSCipherSuitesParsed,
+				},
+				OCSPStapling:       conf.TLSOCSPStapling,
+				CertReloadInterval: time.Duration(conf.TLSCertReloadSeconds) * time.Second,
+				OnShutdown:         stop,
+			}
+			if len(conf.TLSACMEDomains) > 0 {
+				opts.ACME = &server.ACMEOptions{
+					Domains:     conf.TLSACMEDomains,
+					CacheDir:    conf.TLSACMECacheDir,
+					Email:       conf.TLSACMEEmail,
+					HTTPAddress: conf.TLSACMEHTTPAddress,
+				}
+			}
+			if conf.ProxyProtocol {
+				opts.ProxyProtocolUpstreams = conf.ProxyProtocolTrustedUpstreamsParsed
+			}
+			if conf.Prometheus && conf.MetricsAddress != "" {
+				metricsOpts := opts
+				metricsOpts.ActivationName = "metrics"
+				metricsOpts.ProxyProtocolUpstreams = nil
+				metricsOpts.ACME = nil
+				go func() {
+					if err := server.Start(router.MetricsRouter(conf, users), conf.MetricsAddress, "", "", metricsOpts); err != nil {
+						log.Fatal().Err(err).Msg("metrics http server")
+					}
+				}()
+			}
+			err = server.Start(r, conf.ServerAddress, conf.TLSCertFile, conf.TLSKeyFile, opts)
+			stop()
+			if closeErr := tServer.Close(); closeErr != nil {
+				log.Warn().Err(closeErr).Msg("Could not stop the TURN server")
+			}
+			if err != nil {
 				log.Fatal().Err(err).Msg("http server")
 			}
 			return nil
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/auth"
+	"github.com/AsterZephyr/Scree-go-AZlearn/config"
+	"github.com/AsterZephyr/Scree-go-AZlearn/logger"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+var verifyCmd = &cli.Command{
+	Name:  "verify",
+	Usage: "check a password against the users file",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "name"},
+		&cli.StringFlag{Name: "users", EnvVars: []string{"SCREEGO_USERS_FILE"}},
+	},
+	Action: func(ctx *cli.Context) error {
+		logger.Init(zerolog.ErrorLevel, config.LogFormatConsole, 0)
+		name := ctx.String("name")
+		if name == "" {
+			log.Fatal().Msg("--name must be set")
+		}
+		path := ctx.String("users")
+		if path == "" {
+			log.Fatal().Msg("--users or SCREEGO_USERS_FILE must be set")
+		}
+
+		users, err := auth.ReadPasswordsFile(path, nil, 0, false, auth.CookieOptions{})
+		if err != nil {
+			log.Fatal().Str("file", path).Err(err).Msg("While loading users file")
+		}
+
+		if !users.Validate(name, string(readPassword())) {
+			return cli.Exit("FAIL", 1)
+		}
+		fmt.Println("OK")
+		return nil
+	},
+}
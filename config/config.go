@@ -5,14 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/AsterZephyr/Scree-go-AZlearn/config/ipdns"
 	"github.com/AsterZephyr/Scree-go-AZlearn/config/mode"
+	"github.com/AsterZephyr/Scree-go-AZlearn/util"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/zerolog"
@@ -27,45 +30,176 @@ var (
 )
 
 const (
-	AuthModeTurn = "turn"
-	AuthModeAll  = "all"
-	AuthModeNone = "none"
+	AuthModeTurn  = "turn"
+	AuthModeAll   = "all"
+	AuthModeNone  = "none"
+	AuthModeHTTP  = "http"
+	AuthModeProxy = "proxy"
 )
 
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
+// DefaultContentSecurityPolicy is used if SCREEGO_CONTENT_SECURITY_POLICY is
+// empty. {host} is replaced with the host of the request and
+// {frame-ancestors} with SCREEGO_FRAME_ANCESTORS.
+const DefaultContentSecurityPolicy = "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data: blob:; media-src 'self' blob: mediastream:; connect-src 'self' wss://{host} ws://{host}; " +
+	"object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors {frame-ancestors}"
+
 type Config struct {
 	LogLevel   LogLevel `default:"info" split_words:"true"`
+	LogFormat  string   `split_words:"true"`
 	ExternalIP []string `split_words:"true"`
 
+	LogSampling     bool   `split_words:"true"`
+	LogSamplingRate uint32 `default:"10" split_words:"true"`
+
+	LogRedactIP bool `split_words:"true"`
+
 	TLSCertFile string `split_words:"true"`
 	TLSKeyFile  string `split_words:"true"`
 
+	TLSMinVersion         string   `default:"1.2" split_words:"true"`
+	TLSMinVersionParsed   uint16   `ignored:"true"`
+	TLSCipherSuites       []string `split_words:"true"`
+	TLSCipherSuitesParsed []uint16 `ignored:"true"`
+	TLSOCSPStapling       bool     `envconfig:"TLS_OCSP_STAPLING"`
+	TLSCertReloadSeconds  int      `default:"60" split_words:"true"`
+
+	TLSACMEDomains     []string `envconfig:"TLS_ACME_DOMAINS"`
+	TLSACMECacheDir    string   `envconfig:"TLS_ACME_CACHE_DIR"`
+	TLSACMEEmail       string   `envconfig:"TLS_ACME_EMAIL"`
+	TLSACMEHTTPAddress string   `default:":80" envconfig:"TLS_ACME_HTTP_ADDRESS"`
+
 	ServerTLS             bool   `split_words:"true"`
 	ServerAddress         string `default:":5050" split_words:"true"`
 	Secret                []byte `split_words:"true"`
 	SessionTimeoutSeconds int    `default:"0" split_words:"true"`
 
+	ServerReadHeaderTimeoutSeconds int `default:"10" split_words:"true"`
+	ServerWriteTimeoutSeconds      int `default:"30" split_words:"true"`
+	ServerIdleTimeoutSeconds       int `default:"120" split_words:"true"`
+
+	// BasePath has a leading and no trailing slash, empty means root.
+	BasePath string `split_words:"true"`
+
+	HTTPCompression bool `default:"true" split_words:"true"`
+
+	WebSocketCompression      bool   `split_words:"true"`
+	WebSocketCompressionLevel string `default:"balanced" split_words:"true"`
+
+	ContentSecurityPolicy string   `split_words:"true"`
+	FrameAncestors        []string `default:"'self'" split_words:"true"`
+
+	HSTSMaxAgeSeconds     int  `split_words:"true"`
+	HSTSIncludeSubDomains bool `split_words:"true"`
+	HSTSPreload           bool `split_words:"true"`
+
+	ServerSocketMode       string      `default:"0660" split_words:"true"`
+	ServerSocketModeParsed os.FileMode `ignored:"true"`
+
+	SessionCookieName           string        `default:"user" split_words:"true"`
+	SessionCookieDomain         string        `split_words:"true"`
+	SessionCookieSecure         bool          `default:"true" split_words:"true"`
+	SessionCookieSameSite       string        `default:"lax" split_words:"true"`
+	SessionCookieSameSiteParsed http.SameSite `ignored:"true"`
+
+	LoginMaxAttempts          int `default:"5" split_words:"true"`
+	LoginLockoutSeconds       int `default:"60" split_words:"true"`
+	LoginAttemptWindowSeconds int `default:"900" split_words:"true"`
+
 	TurnAddress   string `default:":3478" required:"true" split_words:"true"`
 	TurnPortRange string `split_words:"true"`
 
 	TurnExternalIP     []string `split_words:"true"`
-	TurnExternalPort   string   `default:"3478" split_words:"true"`
+	TurnExternalPort   []string `default:"3478" split_words:"true"`
 	TurnExternalSecret string   `split_words:"true"`
 
 	TrustProxyHeaders  bool     `split_words:"true"`
 	AuthMode           string   `default:"turn" split_words:"true"`
 	CorsAllowedOrigins []string `split_words:"true"`
 	UsersFile          string   `split_words:"true"`
+	AdminUsers         []string `split_words:"true"`
 	Prometheus         bool     `split_words:"true"`
+	MetricsAddress     string   `split_words:"true"`
+	MetricsBasicAuth   bool     `default:"true" split_words:"true"`
+	MetricsToken       string   `split_words:"true"`
+
+	ProxyProtocol                       bool         `split_words:"true"`
+	ProxyProtocolTrustedUpstreams       []string     `split_words:"true"`
+	ProxyProtocolTrustedUpstreamsParsed []*net.IPNet `ignored:"true"`
+
+	AuthHTTPURL                string `envconfig:"AUTH_HTTP_URL"`
+	AuthHTTPTimeoutSeconds     int    `default:"5" split_words:"true"`
+	AuthHTTPInsecureSkipVerify bool   `split_words:"true"`
+	AuthHTTPCacheSeconds       int    `default:"60" split_words:"true"`
+
+	AuthProxyHeader                 string       `default:"X-Auth-User" split_words:"true"`
+	AuthProxyTrustedUpstreams       []string     `split_words:"true"`
+	AuthProxyTrustedUpstreamsParsed []*net.IPNet `ignored:"true"`
 
 	CheckOrigin    func(string) bool `ignored:"true" json:"-"`
 	TurnExternal   bool              `ignored:"true"`
 	TurnIPProvider ipdns.Provider    `ignored:"true"`
-	TurnPort       string            `ignored:"true"`
+	TurnPorts      []string          `ignored:"true"`
 
 	TurnDenyPeers       []string     `default:"0.0.0.0/8,127.0.0.1/8,::/128,::1/128,fe80::/10" split_words:"true"`
 	TurnDenyPeersParsed []*net.IPNet `ignored:"true"`
 
+	TurnAllowPeers       []string     `split_words:"true"`
+	TurnAllowPeersParsed []*net.IPNet `ignored:"true"`
+
+	TurnHealthCheckSeconds int `default:"30" split_words:"true"`
+
+	TurnAllocationLog     string `default:"debug" split_words:"true"`
+	TurnAllocationLogRate uint32 `default:"1" split_words:"true"`
+
+	TurnAdvertisedPorts []string `split_words:"true"`
+	TurnExplicitUDP     bool     `split_words:"true"`
+	TurnUsernameFormat  string   `split_words:"true"`
+
+	TurnRegions        []string     `split_words:"true"`
+	TurnRegionNetworks []string     `split_words:"true"`
+	TurnRegionsParsed  []TurnRegion `ignored:"true"`
+
+	EventQueueSize  int `default:"1024" split_words:"true"`
+	EventLoopShards int `default:"1" split_words:"true"`
+
+	EventQueueHighWaterPercent int `default:"100" split_words:"true"`
+	EventQueueLowWaterPercent  int `default:"75" split_words:"true"`
+
+	NamesAdjectivesFile string `split_words:"true"`
+	NamesNounsFile      string `split_words:"true"`
+
+	BlockedWords     []string `split_words:"true"`
+	BlockedWordsFile string   `split_words:"true"`
+
+	GeoIPDatabase string `split_words:"true"`
+
 	CloseRoomWhenOwnerLeaves bool `default:"true" split_words:"true"`
+	RequireUserName          bool `split_words:"true"`
+	MaxUserNameLength        int  `default:"32" split_words:"true"`
+	MaxSessionsPerUser       int  `split_words:"true"`
+	MaxSDPBytes              int  `default:"65536" split_words:"true"`
+	ClientQueueLimit         int  `default:"1024" split_words:"true"`
+	UpgradeErrorDetail       bool `split_words:"true"`
+
+	CloseRoomWhenNoStreamFor time.Duration `split_words:"true"`
+	MaxConnectionLifetime    time.Duration `split_words:"true"`
+	DisconnectGrace          time.Duration `split_words:"true"`
+	PingJitter               float64       `default:"0.1" split_words:"true"`
+
+	ReservedRooms       []string `split_words:"true"`
+	ReservedRoomMode    string   `default:"turn" split_words:"true"`
+	ReservedRoomWelcome string   `split_words:"true"`
+
+	RoomIDLowercase bool `split_words:"true"`
+
+	ICERestartPacketLoss float64 `split_words:"true"`
+	ICEServersRateLimit  int     `default:"10" split_words:"true"`
 }
 
 func (c *Config) parsePortRange() (uint16, uint16, error) {
@@ -89,6 +223,39 @@ func (c *Config) parsePortRange() (uint16, uint16, error) {
 	return uint16(min64), uint16(max64), nil
 }
 
+// MinTurnExternalSecretLength is the minimum length of
+// SCREEGO_TURN_EXTERNAL_SECRET. The secret signs the TURN credentials, a short
+// one can be guessed from observed credentials.
+const MinTurnExternalSecretLength = 16
+
+// MinHSTSPreloadMaxAge is the minimum max-age in seconds browsers accept for
+// the HSTS preload list.
+const MinHSTSPreloadMaxAge = 31536000
+
+// validateTurnExternalSecret checks the shared secret of the external TURN
+// server. Without it the credentials would be signed with an empty key and
+// always be rejected by the TURN server.
+func validateTurnExternalSecret(secret string) *FutureLog {
+	if secret == "" {
+		log := futureFatal("SCREEGO_TURN_EXTERNAL_SECRET must be set if external TURN server is used")
+		return &log
+	}
+	if len(secret) < MinTurnExternalSecretLength {
+		log := futureFatal(fmt.Sprintf("SCREEGO_TURN_EXTERNAL_SECRET must be at least %d characters long", MinTurnExternalSecretLength))
+		return &log
+	}
+	return nil
+}
+
+// LogSamplingN returns the sampling rate passed to the logger, 0 means no
+// sampling.
+func (c Config) LogSamplingN() uint32 {
+	if !c.LogSampling {
+		return 0
+	}
+	return c.LogSamplingRate
+}
+
 func (c Config) PortRange() (uint16, uint16, bool) {
 	min, max, _ := c.parsePortRange()
 	return min, max, min != 0 && max != 0
@@ -130,12 +297,75 @@ func Get() (Config, []FutureLog) {
 			futureFatal(fmt.Sprintf("cannot parse env params: %s", err)))
 	}
 
-	if config.AuthMode != AuthModeTurn && config.AuthMode != AuthModeAll && config.AuthMode != AuthModeNone {
+	if config.LogFormat == "" {
+		if mode.Get() == mode.Prod {
+			config.LogFormat = LogFormatJSON
+		} else {
+			config.LogFormat = LogFormatConsole
+		}
+	}
+	if config.LogFormat != LogFormatConsole && config.LogFormat != LogFormatJSON {
+		logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_LOG_FORMAT: %s", config.LogFormat)))
+	}
+
+	if config.LogSampling && config.LogSamplingRate < 2 {
+		logs = append(logs, futureFatal("SCREEGO_LOG_SAMPLING_RATE must be at least 2 if SCREEGO_LOG_SAMPLING is enabled"))
+	}
+
+	if config.AuthMode != AuthModeTurn && config.AuthMode != AuthModeAll && config.AuthMode != AuthModeNone && config.AuthMode != AuthModeHTTP && config.AuthMode != AuthModeProxy {
 		logs = append(logs,
 			futureFatal(fmt.Sprintf("invalid SCREEGO_AUTH_MODE: %s", config.AuthMode)))
 	}
 
-	if config.ServerTLS {
+	if config.AuthMode == AuthModeHTTP {
+		if config.AuthHTTPURL == "" {
+			logs = append(logs, futureFatal("SCREEGO_AUTH_HTTP_URL must be set if SCREEGO_AUTH_MODE is http"))
+		}
+		if config.AuthHTTPTimeoutSeconds <= 0 {
+			logs = append(logs, futureFatal("SCREEGO_AUTH_HTTP_TIMEOUT_SECONDS must be greater than 0"))
+		}
+		if config.AuthHTTPInsecureSkipVerify {
+			logs = append(logs, FutureLog{
+				Level: zerolog.WarnLevel,
+				Msg:   "SCREEGO_AUTH_HTTP_INSECURE_SKIP_VERIFY is enabled, TLS certificates of the auth service won't be verified",
+			})
+		}
+	}
+
+	if config.AuthMode == AuthModeProxy {
+		if !config.TrustProxyHeaders {
+			logs = append(logs, futureFatal("SCREEGO_TRUST_PROXY_HEADERS must be enabled if SCREEGO_AUTH_MODE is proxy"))
+		}
+		if config.AuthProxyHeader == "" {
+			logs = append(logs, futureFatal("SCREEGO_AUTH_PROXY_HEADER must be set if SCREEGO_AUTH_MODE is proxy"))
+		}
+		if len(config.AuthProxyTrustedUpstreams) == 0 {
+			logs = append(logs, futureFatal("SCREEGO_AUTH_PROXY_TRUSTED_UPSTREAMS must be set if SCREEGO_AUTH_MODE is proxy"))
+		}
+		for _, cidrString := range config.AuthProxyTrustedUpstreams {
+			_, cidr, err := net.ParseCIDR(cidrString)
+			if err != nil {
+				logs = append(logs, futureFatal(fmt.Sprintf("Invalid SCREEGO_AUTH_PROXY_TRUSTED_UPSTREAMS %q: %s", cidrString, err)))
+			} else {
+				config.AuthProxyTrustedUpstreamsParsed = append(config.AuthProxyTrustedUpstreamsParsed, cidr)
+			}
+		}
+	}
+
+	if len(config.TLSACMEDomains) > 0 {
+		if !config.ServerTLS {
+			logs = append(logs, futureFatal("SCREEGO_SERVER_TLS must be enabled if SCREEGO_TLS_ACME_DOMAINS is set"))
+		}
+		if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+			logs = append(logs, futureFatal("SCREEGO_TLS_ACME_DOMAINS can't be used together with SCREEGO_TLS_CERT_FILE and SCREEGO_TLS_KEY_FILE"))
+		}
+		if config.TLSACMECacheDir == "" {
+			logs = append(logs, futureFatal("SCREEGO_TLS_ACME_CACHE_DIR must be set if SCREEGO_TLS_ACME_DOMAINS is set"))
+		}
+		if config.TLSOCSPStapling {
+			logs = append(logs, futureFatal("SCREEGO_TLS_OCSP_STAPLING is only supported with SCREEGO_TLS_CERT_FILE, not with SCREEGO_TLS_ACME_DOMAINS"))
+		}
+	} else if config.ServerTLS {
 		if config.TLSCertFile == "" {
 			logs = append(logs, futureFatal("SCREEGO_TLS_CERT_FILE must be set if TLS is enabled"))
 		}
@@ -145,6 +375,163 @@ func Get() (Config, []FutureLog) {
 		}
 	}
 
+	config.BasePath = strings.TrimRight(config.BasePath, "/")
+	if config.BasePath != "" && !strings.HasPrefix(config.BasePath, "/") {
+		config.BasePath = "/" + config.BasePath
+	}
+	if strings.ContainsAny(config.BasePath, "?#") {
+		logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_BASE_PATH: %s", config.BasePath)))
+	}
+
+	switch strings.TrimSpace(config.ContentSecurityPolicy) {
+	case "":
+		config.ContentSecurityPolicy = DefaultContentSecurityPolicy
+	case "off":
+		config.ContentSecurityPolicy = ""
+	}
+
+	if len(config.FrameAncestors) == 0 {
+		logs = append(logs, futureFatal("SCREEGO_FRAME_ANCESTORS must not be empty, use 'none' to disallow embedding"))
+	}
+	for _, origin := range config.FrameAncestors {
+		if origin == "" || strings.ContainsAny(origin, "; ") {
+			logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_FRAME_ANCESTORS entry: %q", origin)))
+		}
+	}
+	// A custom policy with its own frame-ancestors directive would silently
+	// ignore SCREEGO_FRAME_ANCESTORS.
+	if os.Getenv("SCREEGO_FRAME_ANCESTORS") != "" && strings.Contains(config.ContentSecurityPolicy, "frame-ancestors") &&
+		!strings.Contains(config.ContentSecurityPolicy, "{frame-ancestors}") {
+		logs = append(logs, futureFatal("SCREEGO_CONTENT_SECURITY_POLICY already contains frame-ancestors, use frame-ancestors {frame-ancestors} to apply SCREEGO_FRAME_ANCESTORS"))
+	}
+
+	if config.HSTSMaxAgeSeconds < 0 {
+		logs = append(logs, futureFatal("SCREEGO_HSTS_MAX_AGE_SECONDS must not be negative"))
+	}
+	if config.HSTSPreload && (!config.HSTSIncludeSubDomains || config.HSTSMaxAgeSeconds < MinHSTSPreloadMaxAge) {
+		logs = append(logs, futureFatal(fmt.Sprintf("SCREEGO_HSTS_PRELOAD requires SCREEGO_HSTS_INCLUDE_SUB_DOMAINS and SCREEGO_HSTS_MAX_AGE_SECONDS of at least %d", MinHSTSPreloadMaxAge)))
+	}
+
+	if config.MaxUserNameLength < 0 {
+		logs = append(logs, futureFatal("SCREEGO_MAX_USER_NAME_LENGTH must not be negative"))
+	}
+
+	if config.EventQueueSize < 0 {
+		logs = append(logs, futureFatal("SCREEGO_EVENT_QUEUE_SIZE must not be negative"))
+	}
+	if config.EventQueueHighWaterPercent < 1 || config.EventQueueHighWaterPercent > 100 {
+		logs = append(logs, futureFatal("SCREEGO_EVENT_QUEUE_HIGH_WATER_PERCENT must be between 1 and 100"))
+	}
+	if config.EventQueueLowWaterPercent < 1 || config.EventQueueLowWaterPercent > config.EventQueueHighWaterPercent {
+		logs = append(logs, futureFatal("SCREEGO_EVENT_QUEUE_LOW_WATER_PERCENT must be between 1 and SCREEGO_EVENT_QUEUE_HIGH_WATER_PERCENT"))
+	}
+	if config.CloseRoomWhenNoStreamFor < 0 {
+		logs = append(logs, futureFatal("SCREEGO_CLOSE_ROOM_WHEN_NO_STREAM_FOR must not be negative"))
+	}
+	if config.MaxConnectionLifetime < 0 {
+		logs = append(logs, futureFatal("SCREEGO_MAX_CONNECTION_LIFETIME must not be negative"))
+	}
+	if config.DisconnectGrace < 0 {
+		logs = append(logs, futureFatal("SCREEGO_DISCONNECT_GRACE must not be negative"))
+	}
+	if config.PingJitter < 0 || config.PingJitter >= 1 {
+		logs = append(logs, futureFatal("SCREEGO_PING_JITTER must be at least 0 and less than 1"))
+	}
+	for _, name := range config.ReservedRooms {
+		if err := util.ValidateRoomID(name); err != nil {
+			logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_RESERVED_ROOMS entry %q: %s", name, err)))
+		}
+	}
+	switch config.ReservedRoomMode {
+	case "local", "stun", AuthModeTurn:
+	default:
+		logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_RESERVED_ROOM_MODE %q, must be one of local, stun or turn", config.ReservedRoomMode)))
+	}
+	switch config.WebSocketCompressionLevel {
+	case "speed", "balanced", "size":
+	default:
+		logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_WEB_SOCKET_COMPRESSION_LEVEL %q, must be one of speed, balanced or size", config.WebSocketCompressionLevel)))
+	}
+	switch config.TurnAllocationLog {
+	case "off", "debug", "info":
+	default:
+		logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_TURN_ALLOCATION_LOG %q, must be one of off, debug or info", config.TurnAllocationLog)))
+	}
+	if config.TurnAllocationLogRate < 1 {
+		logs = append(logs, futureFatal("SCREEGO_TURN_ALLOCATION_LOG_RATE must be at least 1"))
+	}
+	if config.ICEServersRateLimit < 1 {
+		logs = append(logs, futureFatal("SCREEGO_ICE_SERVERS_RATE_LIMIT must be at least 1"))
+	}
+	if config.ICERestartPacketLoss < 0 || config.ICERestartPacketLoss > 1 {
+		logs = append(logs, futureFatal("SCREEGO_ICE_RESTART_PACKET_LOSS must be between 0 and 1"))
+	}
+	if config.ClientQueueLimit < 0 {
+		logs = append(logs, futureFatal("SCREEGO_CLIENT_QUEUE_LIMIT must not be negative"))
+	}
+	if config.MaxSDPBytes < 0 {
+		logs = append(logs, futureFatal("SCREEGO_MAX_SDP_BYTES must not be negative"))
+	}
+	if config.MaxSessionsPerUser < 0 {
+		logs = append(logs, futureFatal("SCREEGO_MAX_SESSIONS_PER_USER must not be negative"))
+	}
+	if config.EventLoopShards < 1 {
+		logs = append(logs, futureFatal("SCREEGO_EVENT_LOOP_SHARDS must be at least 1"))
+	}
+
+	if config.ServerReadHeaderTimeoutSeconds < 0 || config.ServerWriteTimeoutSeconds < 0 || config.ServerIdleTimeoutSeconds < 0 {
+		logs = append(logs, futureFatal("SCREEGO_SERVER_*_TIMEOUT_SECONDS must not be negative"))
+	}
+
+	if config.MetricsAddress != "" && !config.Prometheus {
+		logs = append(logs, FutureLog{
+			Level: zerolog.WarnLevel,
+			Msg:   "SCREEGO_METRICS_ADDRESS is set but SCREEGO_PROMETHEUS is disabled",
+		})
+	}
+
+	if config.SessionCookieName == "" {
+		logs = append(logs, futureFatal("SCREEGO_SESSION_COOKIE_NAME must not be empty"))
+	}
+
+	if config.LoginMaxAttempts > 0 && (config.LoginLockoutSeconds <= 0 || config.LoginAttemptWindowSeconds <= 0) {
+		logs = append(logs, futureFatal("SCREEGO_LOGIN_LOCKOUT_SECONDS and SCREEGO_LOGIN_ATTEMPT_WINDOW_SECONDS must be greater than 0"))
+	}
+
+	if mode, err := strconv.ParseUint(config.ServerSocketMode, 8, 32); err != nil || mode > 0o777 {
+		logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_SERVER_SOCKET_MODE: %s", config.ServerSocketMode)))
+	} else {
+		config.ServerSocketModeParsed = os.FileMode(mode)
+	}
+
+	if version, err := parseTLSVersion(config.TLSMinVersion); err != nil {
+		logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_TLS_MIN_VERSION: %s", err)))
+	} else {
+		config.TLSMinVersionParsed = version
+	}
+	if config.TLSCertReloadSeconds < 0 {
+		logs = append(logs, futureFatal("SCREEGO_TLS_CERT_RELOAD_SECONDS must not be negative"))
+	}
+	if suites, err := parseCipherSuites(config.TLSCipherSuites); err != nil {
+		logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_TLS_CIPHER_SUITES: %s", err)))
+	} else {
+		config.TLSCipherSuitesParsed = suites
+	}
+
+	switch strings.ToLower(config.SessionCookieSameSite) {
+	case "lax":
+		config.SessionCookieSameSiteParsed = http.SameSiteLaxMode
+	case "strict":
+		config.SessionCookieSameSiteParsed = http.SameSiteStrictMode
+	case "none":
+		config.SessionCookieSameSiteParsed = http.SameSiteNoneMode
+		if !config.SessionCookieSecure {
+			logs = append(logs, futureFatal("SCREEGO_SESSION_COOKIE_SECURE must be enabled if SCREEGO_SESSION_COOKIE_SAME_SITE is none"))
+		}
+	default:
+		logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_SESSION_COOKIE_SAME_SITE: %s", config.SessionCookieSameSite)))
+	}
+
 	var compiledAllowedOrigins []*regexp.Regexp
 	for _, origin := range config.CorsAllowedOrigins {
 		compiled, err := regexp.Compile(origin)
@@ -186,21 +573,26 @@ func Get() (Config, []FutureLog) {
 		}
 
 		config.TurnIPProvider, errs = parseIPProvider(config.TurnExternalIP, "SCREEGO_TURN_EXTERNAL_IP")
-		config.TurnPort = config.TurnExternalPort
+		config.TurnPorts = config.TurnExternalPort
 		config.TurnExternal = true
 		logs = append(logs, errs...)
-		if config.TurnExternalSecret == "" {
-			logs = append(logs, futureFatal("SCREEGO_TURN_EXTERNAL_SECRET must be set if external TURN server is used"))
+		if log := validateTurnExternalSecret(config.TurnExternalSecret); log != nil {
+			logs = append(logs, *log)
 		}
 	} else if len(config.ExternalIP) > 0 {
 		config.TurnIPProvider, errs = parseIPProvider(config.ExternalIP, "SCREEGO_EXTERNAL_IP")
 		logs = append(logs, errs...)
 		split := strings.Split(config.TurnAddress, ":")
-		config.TurnPort = split[len(split)-1]
+		config.TurnPorts = []string{split[len(split)-1]}
+		if len(config.TurnAdvertisedPorts) > 0 {
+			config.TurnPorts = config.TurnAdvertisedPorts
+		}
 	} else {
 		logs = append(logs, futureFatal("SCREEGO_EXTERNAL_IP or SCREEGO_TURN_EXTERNAL_IP must be set"))
 	}
 
+	logs = append(logs, validatePorts(config.TurnPorts)...)
+
 	min, max, err := config.parsePortRange()
 	if err != nil {
 		logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_TURN_PORT_RANGE: %s", err)))
@@ -234,9 +626,69 @@ func Get() (Config, []FutureLog) {
 		Msg:   fmt.Sprintf("Deny turn peers within %q", config.TurnDenyPeersParsed),
 	})
 
+	for _, cidrString := range config.TurnAllowPeers {
+		_, cidr, err := net.ParseCIDR(cidrString)
+		if err != nil {
+			logs = append(logs, FutureLog{
+				Level: zerolog.FatalLevel,
+				Msg:   fmt.Sprintf("Invalid SCREEGO_TURN_ALLOW_PEERS %q: %s", cidrString, err),
+			})
+		} else {
+			config.TurnAllowPeersParsed = append(config.TurnAllowPeersParsed, cidr)
+		}
+	}
+	if len(config.TurnAllowPeersParsed) > 0 {
+		logs = append(logs, FutureLog{
+			Level: zerolog.InfoLevel,
+			Msg:   fmt.Sprintf("Only allow turn peers within %q", config.TurnAllowPeersParsed),
+		})
+	}
+
+	if config.ProxyProtocol {
+		if len(config.ProxyProtocolTrustedUpstreams) == 0 {
+			logs = append(logs, futureFatal("SCREEGO_PROXY_PROTOCOL_TRUSTED_UPSTREAMS must be set if SCREEGO_PROXY_PROTOCOL is enabled"))
+		}
+		for _, cidrString := range config.ProxyProtocolTrustedUpstreams {
+			_, cidr, err := net.ParseCIDR(cidrString)
+			if err != nil {
+				logs = append(logs, futureFatal(fmt.Sprintf("Invalid SCREEGO_PROXY_PROTOCOL_TRUSTED_UPSTREAMS %q: %s", cidrString, err)))
+			} else {
+				config.ProxyProtocolTrustedUpstreamsParsed = append(config.ProxyProtocolTrustedUpstreamsParsed, cidr)
+			}
+		}
+	}
+
+	if config.TurnUsernameFormat != "" && !strings.Contains(config.TurnUsernameFormat, "{session}") {
+		logs = append(logs, futureFatal("SCREEGO_TURN_USERNAME_FORMAT must contain {session}"))
+	}
+
+	config.TurnRegionsParsed, errs = parseTurnRegions(config.TurnRegions, config.TurnRegionNetworks)
+	logs = append(logs, errs...)
+	if len(config.TurnRegionsParsed) > 0 && !config.TurnExternal {
+		logs = append(logs, FutureLog{
+			Level: zerolog.WarnLevel,
+			Msg:   "SCREEGO_TURN_REGIONS is used without an external TURN server, TURN credentials are only valid on this instance",
+		})
+	}
+
 	return config, logs
 }
 
+// validatePorts checks that the TURN ports are valid and unique.
+func validatePorts(ports []string) []FutureLog {
+	var logs []FutureLog
+	seen := map[string]bool{}
+	for _, port := range ports {
+		if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+			logs = append(logs, futureFatal(fmt.Sprintf("invalid TURN port %q", port)))
+		} else if seen[port] {
+			logs = append(logs, futureFatal(fmt.Sprintf("duplicate TURN port %q", port)))
+		}
+		seen[port] = true
+	}
+	return logs
+}
+
 func logDeprecated() []FutureLog {
 	if os.Getenv("SCREEGO_TURN_STRICT_AUTH") != "" {
 		return []FutureLog{{Level: zerolog.WarnLevel, Msg: "The setting SCREEGO_TURN_STRICT_AUTH has been removed."}}
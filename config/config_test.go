@@ -0,0 +1,121 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTurnExternalSecret(t *testing.T) {
+	assert.NotNil(t, validateTurnExternalSecret(""))
+	assert.NotNil(t, validateTurnExternalSecret("short"))
+	assert.Nil(t, validateTurnExternalSecret("a-long-enough-shared-secret"))
+}
+
+func TestGet_requiresTurnExternalSecret(t *testing.T) {
+	t.Setenv("SCREEGO_TURN_EXTERNAL_IP", "192.0.2.1")
+	t.Setenv("SCREEGO_TURN_EXTERNAL_SECRET", "")
+
+	_, logs := Get()
+	assert.Contains(t, logs, FutureLog{
+		Level: zerolog.FatalLevel,
+		Msg:   "SCREEGO_TURN_EXTERNAL_SECRET must be set if external TURN server is used",
+	})
+}
+
+func TestGet_frameAncestorsInCustomPolicy(t *testing.T) {
+	const msg = "SCREEGO_CONTENT_SECURITY_POLICY already contains frame-ancestors, use frame-ancestors {frame-ancestors} to apply SCREEGO_FRAME_ANCESTORS"
+	t.Setenv("SCREEGO_CONTENT_SECURITY_POLICY", "default-src 'self'; frame-ancestors 'none'")
+	t.Setenv("SCREEGO_FRAME_ANCESTORS", "https://portal.example.com")
+
+	_, logs := Get()
+	assert.Contains(t, logs, FutureLog{Level: zerolog.FatalLevel, Msg: msg})
+
+	t.Setenv("SCREEGO_CONTENT_SECURITY_POLICY", "default-src 'self'; frame-ancestors {frame-ancestors}")
+	_, logs = Get()
+	assert.NotContains(t, logs, FutureLog{Level: zerolog.FatalLevel, Msg: msg})
+
+	t.Setenv("SCREEGO_CONTENT_SECURITY_POLICY", "default-src 'self'; frame-ancestors 'none'")
+	t.Setenv("SCREEGO_FRAME_ANCESTORS", "")
+	_, logs = Get()
+	assert.NotContains(t, logs, FutureLog{Level: zerolog.FatalLevel, Msg: msg}, "the default ancestors aren't configured")
+}
+
+func TestGet_metricsAddressRequiresPrometheus(t *testing.T) {
+	warning := FutureLog{Level: zerolog.WarnLevel, Msg: "SCREEGO_METRICS_ADDRESS is set but SCREEGO_PROMETHEUS is disabled"}
+	t.Setenv("SCREEGO_METRICS_ADDRESS", "127.0.0.1:9090")
+	t.Setenv("SCREEGO_PROMETHEUS", "false")
+
+	conf, logs := Get()
+	assert.Equal(t, "127.0.0.1:9090", conf.MetricsAddress)
+	assert.Contains(t, logs, warning)
+
+	t.Setenv("SCREEGO_PROMETHEUS", "true")
+	_, logs = Get()
+	assert.NotContains(t, logs, warning)
+}
+
+func TestGet_ocspStapling(t *testing.T) {
+	t.Setenv("SCREEGO_TLS_OCSP_STAPLING", "true")
+
+	conf, _ := Get()
+	assert.True(t, conf.TLSOCSPStapling)
+}
+
+func TestGet_acme(t *testing.T) {
+	const (
+		requiresTLS = "SCREEGO_SERVER_TLS must be enabled if SCREEGO_TLS_ACME_DOMAINS is set"
+		exclusive   = "SCREEGO_TLS_ACME_DOMAINS can't be used together with SCREEGO_TLS_CERT_FILE and SCREEGO_TLS_KEY_FILE"
+		cacheDir    = "SCREEGO_TLS_ACME_CACHE_DIR must be set if SCREEGO_TLS_ACME_DOMAINS is set"
+		ocsp        = "SCREEGO_TLS_OCSP_STAPLING is only supported with SCREEGO_TLS_CERT_FILE, not with SCREEGO_TLS_ACME_DOMAINS"
+	)
+	valid := map[string]string{
+		"SCREEGO_SERVER_TLS":         "true",
+		"SCREEGO_TLS_ACME_DOMAINS":   "screego.example.com",
+		"SCREEGO_TLS_ACME_CACHE_DIR": t.TempDir(),
+		"SCREEGO_TLS_CERT_FILE":      "",
+		"SCREEGO_TLS_KEY_FILE":       "",
+		"SCREEGO_TLS_OCSP_STAPLING":  "false",
+	}
+
+	for name, tc := range map[string]struct {
+		env      map[string]string
+		expected string
+	}{
+		"tls disabled": {map[string]string{"SCREEGO_SERVER_TLS": "false"}, requiresTLS},
+		"cert file":    {map[string]string{"SCREEGO_TLS_CERT_FILE": "cert.pem"}, exclusive},
+		"key file":     {map[string]string{"SCREEGO_TLS_KEY_FILE": "key.pem"}, exclusive},
+		"no cache dir": {map[string]string{"SCREEGO_TLS_ACME_CACHE_DIR": ""}, cacheDir},
+		"ocsp":         {map[string]string{"SCREEGO_TLS_OCSP_STAPLING": "true"}, ocsp},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range valid {
+				t.Setenv(key, value)
+			}
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			_, logs := Get()
+			assert.Contains(t, logs, FutureLog{Level: zerolog.FatalLevel, Msg: tc.expected})
+		})
+	}
+
+	for key, value := range valid {
+		t.Setenv(key, value)
+	}
+	conf, logs := Get()
+	assert.Equal(t, []string{"screego.example.com"}, conf.TLSACMEDomains)
+	for _, msg := range []string{requiresTLS, exclusive, cacheDir, ocsp} {
+		assert.NotContains(t, logs, FutureLog{Level: zerolog.FatalLevel, Msg: msg})
+	}
+}
+
+func TestGet_authHTTPURL(t *testing.T) {
+	t.Setenv("SCREEGO_AUTH_MODE", "http")
+	t.Setenv("SCREEGO_AUTH_HTTP_URL", "https://auth.example.com/login")
+
+	conf, logs := Get()
+	assert.Equal(t, "https://auth.example.com/login", conf.AuthHTTPURL)
+	assert.NotContains(t, logs, FutureLog{Level: zerolog.FatalLevel, Msg: "SCREEGO_AUTH_HTTP_URL must be set if SCREEGO_AUTH_MODE is http"})
+}
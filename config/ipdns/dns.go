@@ -24,9 +24,17 @@ type DNS struct {
 }
 
 func (s *DNS) Get() (net.IP, net.IP, error) {
+	return s.get(false)
+}
+
+func (s *DNS) Refresh() (net.IP, net.IP, error) {
+	return s.get(true)
+}
+
+func (s *DNS) get(force bool) (net.IP, net.IP, error) {
 	s.Lock()
 	defer s.Unlock()
-	if s.refetch.Before(time.Now()) {
+	if force || s.refetch.Before(time.Now()) {
 		oldV4, oldV6 := s.v4, s.v6
 		s.v4, s.v6, s.err = s.lookup()
 		if s.err == nil {
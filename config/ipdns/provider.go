@@ -4,4 +4,7 @@ import "net"
 
 type Provider interface {
 	Get() (net.IP, net.IP, error)
+	// Refresh discards cached addresses and resolves them again. Providers
+	// without a cache return the same as Get.
+	Refresh() (net.IP, net.IP, error)
 }
@@ -10,3 +10,7 @@ type Static struct {
 func (s *Static) Get() (net.IP, net.IP, error) {
 	return s.V4, s.V6, nil
 }
+
+func (s *Static) Refresh() (net.IP, net.IP, error) {
+	return s.Get()
+}
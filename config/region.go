@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// TurnRegion is a TURN endpoint assigned to the clients within Networks.
+type TurnRegion struct {
+	Name string
+	// Host is a hostname or ip, ipv6 addresses are enclosed in brackets.
+	Host string
+	// Port is empty if the default TURN port should be used.
+	Port     string
+	Networks []*net.IPNet
+}
+
+// MatchTurnRegion returns the region of the first network containing ip, or nil.
+func MatchTurnRegion(regions []TurnRegion, ip net.IP) *TurnRegion {
+	for i := range regions {
+		for _, network := range regions[i].Networks {
+			if network.Contains(ip) {
+				return &regions[i]
+			}
+		}
+	}
+	return nil
+}
+
+// parseTurnRegions parses endpoints in the format name=host[:port] and
+// networks in the format name=cidr.
+func parseTurnRegions(endpoints, networks []string) ([]TurnRegion, []FutureLog) {
+	var logs []FutureLog
+	var regions []TurnRegion
+	byName := map[string]int{}
+
+	for _, endpoint := range endpoints {
+		name, address, ok := strings.Cut(endpoint, "=")
+		if !ok || name == "" || address == "" {
+			logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_TURN_REGIONS entry %q: expected name=host[:port]", endpoint)))
+			continue
+		}
+		if _, exists := byName[name]; exists {
+			logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_TURN_REGIONS: duplicate region %q", name)))
+			continue
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			host, port = strings.Trim(address, "[]"), ""
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		byName[name] = len(regions)
+		regions = append(regions, TurnRegion{Name: name, Host: host, Port: port})
+	}
+
+	for _, network := range networks {
+		name, cidrString, ok := strings.Cut(network, "=")
+		if !ok {
+			logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_TURN_REGION_NETWORKS entry %q: expected name=cidr", network)))
+			continue
+		}
+		index, exists := byName[name]
+		if !exists {
+			logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_TURN_REGION_NETWORKS entry %q: unknown region %q", network, name)))
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(cidrString)
+		if err != nil {
+			logs = append(logs, futureFatal(fmt.Sprintf("invalid SCREEGO_TURN_REGION_NETWORKS entry %q: %s", network, err)))
+			continue
+		}
+		regions[index].Networks = append(regions[index].Networks, cidr)
+	}
+	return regions, logs
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTurnRegions(t *testing.T) {
+	regions, logs := parseTurnRegions(
+		[]string{"eu=turn-eu.example.com", "us=[2001:db8::1]:443"},
+		[]string{"eu=10.10.0.0/16", "us=10.20.0.0/16"})
+	assert.Empty(t, logs)
+	assert.Equal(t, "turn-eu.example.com", regions[0].Host)
+	assert.Equal(t, "", regions[0].Port)
+	assert.Equal(t, "[2001:db8::1]", regions[1].Host)
+	assert.Equal(t, "443", regions[1].Port)
+
+	assert.Equal(t, "us", MatchTurnRegion(regions, net.ParseIP("10.20.0.1")).Name)
+	assert.Nil(t, MatchTurnRegion(regions, net.ParseIP("10.30.0.1")))
+
+	_, logs = parseTurnRegions([]string{"eu=turn-eu.example.com"}, []string{"asia=10.0.0.0/8"})
+	assert.Len(t, logs, 1)
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// MarshalZerologObject logs the effective configuration relevant for
+// operators. Secrets are never logged, only whether they are set.
+func (c Config) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("authMode", c.AuthMode).
+		Str("reservedRoomMode", c.ReservedRoomMode).
+		Str("address", c.ServerAddress).
+		Bool("tls", c.TLSCertFile != "" || c.TLSKeyFile != "" || len(c.TLSACMEDomains) > 0).
+		Strs("tlsACMEDomains", c.TLSACMEDomains).
+		Str("tlsMinVersion", c.TLSMinVersion).
+		Strs("tlsCipherSuites", c.TLSCipherSuites).
+		Int("hstsMaxAgeSeconds", c.HSTSMaxAgeSeconds).
+		Str("basePath", c.BasePath).
+		Bool("trustProxyHeaders", c.TrustProxyHeaders).
+		Bool("proxyProtocol", c.ProxyProtocol).
+		Strs("externalIP", c.ExternalIP).
+		Bool("usersFile", c.UsersFile != "").
+		Strs("adminUsers", c.AdminUsers)
+
+	if c.TurnExternal {
+		e.Str("turn", "external").
+			Strs("turnExternalIP", c.TurnExternalIP).
+			Strs("turnPorts", c.TurnPorts).
+			Bool("turnExternalSecret", c.TurnExternalSecret != "")
+	} else {
+		e.Str("turn", "internal").
+			Str("turnAddress", c.TurnAddress).
+			Str("turnPortRange", c.TurnPortRange)
+	}
+
+	e.Bool("prometheus", c.Prometheus)
+	if c.Prometheus && c.MetricsAddress != "" {
+		e.Str("metricsAddress", c.MetricsAddress)
+	}
+	e.Str("logLevel", zerolog.Level(c.LogLevel).String())
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummary_redactsSecrets(t *testing.T) {
+	conf := Config{
+		AuthMode:           AuthModeTurn,
+		ServerAddress:      ":5050",
+		Secret:             []byte("server-secret"),
+		TurnExternal:       true,
+		TurnExternalIP:     []string{"192.0.2.1"},
+		TurnPorts:          []string{"3478"},
+		TurnExternalSecret: "turn-secret",
+	}
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Info().Object("config", conf).Msg("Effective configuration")
+
+	assert.Contains(t, buf.String(), `"turn":"external"`)
+	assert.Contains(t, buf.String(), `"turnExternalSecret":true`)
+	assert.NotContains(t, buf.String(), "server-secret")
+	assert.NotContains(t, buf.String(), "turn-secret")
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion parses a TLS version like 1.2.
+func parseTLSVersion(value string) (uint16, error) {
+	version, ok := tlsVersions[value]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, must be one of 1.0, 1.1, 1.2 or 1.3", value)
+	}
+	return version, nil
+}
+
+// parseCipherSuites parses IANA cipher suite names like
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Suites with known security issues
+// are rejected.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	known := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	var ids []uint16
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
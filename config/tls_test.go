@@ -0,0 +1,28 @@
+package config
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	version, err := parseTLSVersion("1.3")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+
+	_, err = parseTLSVersion("1.4")
+	assert.Error(t, err)
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	suites, err := parseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, suites)
+
+	_, err = parseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.Error(t, err, "insecure suites are rejected")
+	_, err = parseCipherSuites([]string{"bogus"})
+	assert.Error(t, err)
+}
@@ -4,12 +4,32 @@ import (
 	"os"
 	"time"
 
+	"github.com/AsterZephyr/Scree-go-AZlearn/config"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-// Init initializes the logger.
-func Init(lvl zerolog.Level) {
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}).Level(lvl)
+var sampled = log.Logger
+
+// Init initializes the logger. The format is either config.LogFormatConsole
+// for human readable output or config.LogFormatJSON for log aggregators.
+// When samplingRate is greater than 1, only every n-th debug event of the
+// Sampled logger is written.
+func Init(lvl zerolog.Level, format string, samplingRate uint32) {
+	if format == config.LogFormatJSON {
+		log.Logger = zerolog.New(os.Stdout).With().Timestamp().Logger().Level(lvl)
+	} else {
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}).Level(lvl)
+	}
+	sampled = log.Logger
+	if samplingRate > 1 {
+		// only debug events are sampled, everything above is always written.
+		sampled = log.Logger.Sample(&zerolog.LevelSampler{DebugSampler: &zerolog.BasicSampler{N: samplingRate}})
+	}
 	log.Debug().Msg("Logger initialized")
 }
+
+// Sampled returns the logger for high-frequency events like per message logs.
+func Sampled() *zerolog.Logger {
+	return &sampled
+}
@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+var redactIP atomic.Bool
+
+// RedactIP enables or disables masking of client IPs in logs. IPv4 addresses
+// keep their /24 network, IPv6 addresses their /64 network.
+func RedactIP(enabled bool) {
+	redactIP.Store(enabled)
+}
+
+// IP returns the ip for logging, masked when RedactIP is enabled.
+func IP(ip net.IP) string {
+	if ip == nil || !redactIP.Load() {
+		return ip.String()
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String()
+}
+
+// Addr returns the address for logging. It accepts an ip or host:port, only
+// the ip is masked when RedactIP is enabled.
+func Addr(addr string) string {
+	if !redactIP.Load() {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return addr
+	}
+	if port == "" {
+		return IP(ip)
+	}
+	return net.JoinHostPort(IP(ip), port)
+}
@@ -0,0 +1,23 @@
+package logger
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactIP(t *testing.T) {
+	assert.Equal(t, "192.0.2.33", IP(net.ParseIP("192.0.2.33")))
+	assert.Equal(t, "192.0.2.33:5050", Addr("192.0.2.33:5050"))
+
+	RedactIP(true)
+	defer RedactIP(false)
+
+	assert.Equal(t, "192.0.2.0", IP(net.ParseIP("192.0.2.33")))
+	assert.Equal(t, "2001:db8:1:2::", IP(net.ParseIP("2001:db8:1:2:3:4:5:6")))
+	assert.Equal(t, "192.0.2.0:5050", Addr("192.0.2.33:5050"))
+	assert.Equal(t, "[2001:db8::]:3478", Addr("[2001:db8::1]:3478"))
+	assert.Equal(t, "192.0.2.0", Addr("192.0.2.33"))
+	assert.Equal(t, "@", Addr("@"), "unix sockets have no ip")
+}
@@ -1,17 +1,29 @@
 package router
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"math"
+	"net"
 	"net/http"
+	"path"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/AsterZephyr/Scree-go-AZlearn/auth"
 	"github.com/AsterZephyr/Scree-go-AZlearn/config"
+	"github.com/AsterZephyr/Scree-go-AZlearn/config/mode"
+	"github.com/AsterZephyr/Scree-go-AZlearn/logger"
 	"github.com/AsterZephyr/Scree-go-AZlearn/ui"
 	"github.com/AsterZephyr/Scree-go-AZlearn/ws"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/xid"
 	"github.com/rs/zerolog/hlog"
 	"github.com/rs/zerolog/log"
 )
@@ -22,26 +34,57 @@ type Health struct {
 	Reason  string `json:"reason,omitempty"`
 }
 
+type ExternalIP struct {
+	V4 string `json:"v4,omitempty"`
+	V6 string `json:"v6,omitempty"`
+}
+
 type UIConfig struct {
-	AuthMode                 string `json:"authMode"`
-	User                     string `json:"user"`
-	LoggedIn                 bool   `json:"loggedIn"`
-	Version                  string `json:"version"`
-	RoomName                 string `json:"roomName"`
-	CloseRoomWhenOwnerLeaves bool   `json:"closeRoomWhenOwnerLeaves"`
+	AuthMode                 string   `json:"authMode"`
+	User                     string   `json:"user"`
+	LoggedIn                 bool     `json:"loggedIn"`
+	Version                  string   `json:"version"`
+	RoomName                 string   `json:"roomName"`
+	CloseRoomWhenOwnerLeaves bool     `json:"closeRoomWhenOwnerLeaves"`
+	RequireUserName          bool     `json:"requireUserName"`
+	EventTypes               []string `json:"eventTypes"`
+	BasePath                 string   `json:"basePath"`
 }
 
-func Router(conf config.Config, rooms *ws.Rooms, users *auth.Users, version string) *mux.Router {
-	router := mux.NewRouter()
-	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+type VersionInfo struct {
+	Version    string `json:"version"`
+	CommitHash string `json:"commitHash"`
+	GoVersion  string `json:"goVersion"`
+	Mode       string `json:"mode"`
+}
+
+func Router(conf config.Config, rooms *ws.Rooms, users *auth.Users, version, commitHash string) *mux.Router {
+	root := mux.NewRouter()
+	router := root
+	if conf.BasePath != "" {
+		// 没有结尾斜杠时重定向，否则UI的相对路径会指向上一级目录
+		root.Path(conf.BasePath).Handler(http.RedirectHandler(conf.BasePath+"/", http.StatusMovedPermanently))
+		router = root.PathPrefix(conf.BasePath).Subrouter()
+	}
+	root.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// https://github.com/gorilla/mux/issues/416
 		accessLogger(r, 404, 0, 0)
 	})
-	router.Use(hlog.AccessHandler(accessLogger))
-	router.Use(handlers.CORS(handlers.AllowedMethods([]string{"GET", "POST"}), handlers.AllowedOriginValidator(conf.CheckOrigin)))
+	root.Use(hlog.AccessHandler(accessLogger))
+	root.Use(handlers.CORS(handlers.AllowedMethods([]string{"GET", "POST"}), handlers.AllowedOriginValidator(conf.CheckOrigin)))
+
+	if conf.HTTPCompression {
+		root.Use(compress(conf.BasePath + "/stream"))
+	}
+
+	root.Use(contentSecurityPolicy(withFrameAncestors(conf.ContentSecurityPolicy, conf.FrameAncestors)))
+
+	if conf.HSTSMaxAgeSeconds > 0 {
+		root.Use(strictTransportSecurity(conf.HSTSMaxAgeSeconds, conf.HSTSIncludeSubDomains, conf.HSTSPreload))
+	}
 
 	// 添加权限策略头，允许屏幕共享
-	router.Use(func(next http.Handler) http.Handler {
+	root.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Permissions-Policy", "display-capture=*")
 			next.ServeHTTP(w, r)
@@ -58,6 +101,28 @@ func Router(conf config.Config, rooms *ws.Rooms, users *auth.Users, version stri
 	router.HandleFunc("/stream", rooms.Upgrade)
 	router.Methods("POST").Path("/login").HandlerFunc(users.Authenticate)
 	router.Methods("POST").Path("/logout").HandlerFunc(users.Logout)
+	router.Methods("POST").Path("/logout-all").HandlerFunc(users.LogoutAll)
+	iceLimiter := auth.NewRateLimiter(conf.ICEServersRateLimit, time.Minute)
+	router.Methods("GET").Path("/ice-servers").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, loggedIn := users.CurrentUser(r)
+		if !loggedIn {
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return
+		}
+		if retry, ok := iceLimiter.Allow(user); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		servers, err := rooms.ICEServers(user, net.ParseIP(users.ClientIP(r)))
+		if err != "" {
+			http.Error(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(servers)
+	})
 	router.Methods("GET").Path("/config").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user, loggedIn := users.CurrentUser(r)
 		_ = json.NewEncoder(w).Encode(&UIConfig{
@@ -65,12 +130,27 @@ func Router(conf config.Config, rooms *ws.Rooms, users *auth.Users, version stri
 			LoggedIn:                 loggedIn,
 			User:                     user,
 			Version:                  version,
-			RoomName:                 rooms.RandRoomName(),
+			RoomName:                 rooms.UniqueRoomName(),
 			CloseRoomWhenOwnerLeaves: conf.CloseRoomWhenOwnerLeaves,
+			RequireUserName:          conf.RequireUserName,
+			EventTypes:               ws.RegisteredEventTypes(),
+			BasePath:                 conf.BasePath + "/",
+		})
+	})
+	router.Methods("GET").Path("/version").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&VersionInfo{
+			Version:    version,
+			CommitHash: commitHash,
+			GoVersion:  runtime.Version(),
+			Mode:       mode.Get(),
 		})
 	})
 	router.Methods("GET").Path("/health").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		i, err := rooms.Count()
+		if err == "" && !rooms.TurnHealthy() {
+			err = "turn server unreachable"
+		}
 		status := "up"
 		if err != "" {
 			status = "down"
@@ -82,31 +162,227 @@ func Router(conf config.Config, rooms *ws.Rooms, users *auth.Users, version stri
 			Reason:  err,
 		})
 	})
+	// livez只检查进程是否存活，不经过主循环，主循环阻塞时health会失败
+	router.Methods("GET").Path("/livez").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Health{
+			Status:  "up",
+			Clients: rooms.ConnectedCount(),
+		})
+	})
+	router.Methods("GET").Path("/admin/rooms").Handler(adminAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats, err := rooms.Stats()
+		if err != "" {
+			http.Error(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(stats)
+	}), users, conf.AdminUsers))
+	router.Methods("POST").Path("/admin/rooms/{id}/drain").Handler(adminAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		found, err := rooms.Drain(mux.Vars(r)["id"])
+		if err != "" {
+			http.Error(w, err, http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "room not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}), users, conf.AdminUsers))
+	router.Methods("POST").Path("/admin/rooms/{id}/sessions/{sid}/ice-restart").Handler(adminAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sid, err := xid.FromString(mux.Vars(r)["sid"])
+		if err != nil {
+			http.Error(w, "invalid session id", http.StatusBadRequest)
+			return
+		}
+		found, msg := rooms.RestartICE(mux.Vars(r)["id"], sid)
+		if msg != "" {
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}), users, conf.AdminUsers))
+	router.Methods("POST").Path("/admin/refresh-ip").Handler(adminAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v4, v6, err := conf.TurnIPProvider.Refresh()
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not refresh external ip")
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		log.Info().Str("v4", v4.String()).Str("v6", v6.String()).Msg("Refreshed external ip")
+		result := ExternalIP{}
+		if v4 != nil {
+			result.V4 = v4.String()
+		}
+		if v6 != nil {
+			result.V6 = v6.String()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	}), users, conf.AdminUsers))
 	if conf.Prometheus {
 		log.Info().Msg("Prometheus enabled")
-		router.Methods("GET").Path("/metrics").Handler(basicAuth(promhttp.Handler(), users))
+		auth.RegisterMetrics(prometheus.DefaultRegisterer)
+		if conf.MetricsAddress == "" {
+			router.Methods("GET").Path("/metrics").Handler(metricsAuth(promhttp.Handler(), users, conf.MetricsToken))
+		}
 	}
 
-	ui.Register(router)
+	ui.Register(router, conf.BasePath)
+
+	return root
+}
+
+// MetricsRouter creates a router only serving the prometheus metrics, used when
+// the metrics are exposed on a separate address.
+func MetricsRouter(conf config.Config, users *auth.Users) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(hlog.AccessHandler(accessLogger))
 
+	var handler http.Handler = promhttp.Handler()
+	if conf.MetricsBasicAuth {
+		handler = metricsAuth(handler, users, conf.MetricsToken)
+	}
+	router.Methods("GET").Path("/metrics").Handler(handler)
 	return router
 }
 
+// cspHostSanitizer 移除主机中能改变CSP结构的字符
+var cspHostSanitizer = strings.NewReplacer(";", "", ",", "", " ", "", "'", "")
+
+// contentSecurityPolicy 设置CSP头，策略中的{host}会被替换为请求的主机
+func contentSecurityPolicy(policy string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Security-Policy", strings.ReplaceAll(policy, "{host}", cspHostSanitizer.Replace(r.Host)))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// strictTransportSecurity 为TLS请求设置HSTS头，明文http请求不发送
+func strictTransportSecurity(maxAge int, includeSubDomains, preload bool) mux.MiddlewareFunc {
+	value := "max-age=" + strconv.Itoa(maxAge)
+	if includeSubDomains {
+		value += "; includeSubDomains"
+	}
+	if preload {
+		value += "; preload"
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil {
+				w.Header().Set("Strict-Transport-Security", value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// withFrameAncestors 将允许嵌入的来源写入策略
+// 策略中没有frame-ancestors指令时会追加，CSP关闭时只发送该指令
+func withFrameAncestors(policy string, ancestors []string) string {
+	if !strings.Contains(policy, "frame-ancestors") {
+		if policy != "" {
+			policy += "; "
+		}
+		policy += "frame-ancestors {frame-ancestors}"
+	}
+	return strings.ReplaceAll(policy, "{frame-ancestors}", strings.Join(ancestors, " "))
+}
+
+// compressedExtensions 是已经压缩过的资源，再次压缩没有收益
+var compressedExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true,
+	".woff": true, ".woff2": true, ".gz": true, ".br": true, ".zip": true,
+}
+
+// compress 根据Accept-Encoding压缩响应
+// WebSocket路由会劫持连接，因此跳过
+func compress(streamPath string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		compressed := handlers.CompressHandler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == streamPath || compressedExtensions[strings.ToLower(path.Ext(r.URL.Path))] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			compressed.ServeHTTP(w, r)
+		})
+	}
+}
+
 func accessLogger(r *http.Request, status, size int, dur time.Duration) {
 	log.Debug().
 		Str("host", r.Host).
 		Int("status", status).
 		Int("size", size).
-		Str("ip", r.RemoteAddr).
+		Str("ip", logger.Addr(r.RemoteAddr)).
 		Str("path", r.URL.Path).
 		Str("duration", dur.String()).
 		Msg("HTTP")
 }
 
+// adminAuth only allows the users in admins, other valid users get 403.
+func adminAuth(handler http.Handler, users *auth.Users, admins []string) http.HandlerFunc {
+	return basicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		if !slices.Contains(admins, user) {
+			log.Info().Str("user", user).Str("path", r.URL.Path).Msg("Rejected admin request of non-admin user")
+			http.Error(w, "Forbidden.", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}), users)
+}
+
+// metricsTokenUser is the fixed username for basic auth with the metrics token.
+const metricsTokenUser = "metrics"
+
+// metricsAuth accepts the metrics token as bearer token or as basic auth
+// password of the user "metrics", so scrapers don't need a real user account.
+// Other requests need basic auth of a user. An empty token only allows users.
+func metricsAuth(handler http.Handler, users *auth.Users, token string) http.HandlerFunc {
+	userAuth := basicAuth(handler, users)
+	if token == "" {
+		return userAuth
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			if user, pass, basic := r.BasicAuth(); basic && user == metricsTokenUser {
+				provided, ok = pass, true
+			}
+		}
+		if !ok {
+			userAuth(w, r)
+			return
+		}
+
+		valid := subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+		auth.CountAttempt(auth.AttemptToken, valid)
+		if !valid {
+			w.Header().Set("WWW-Authenticate", `Basic realm="screego"`)
+			w.WriteHeader(401)
+			_, _ = w.Write([]byte("Unauthorized.\n"))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}
+}
+
 func basicAuth(handler http.Handler, users *auth.Users) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, pass, ok := r.BasicAuth()
 
+		if !ok {
+			auth.CountAttempt(auth.AttemptBasic, false)
+		}
 		if !ok || !users.Validate(user, pass) {
 			w.Header().Set("WWW-Authenticate", `Basic realm="screego"`)
 			w.WriteHeader(401)
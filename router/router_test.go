@@ -0,0 +1,478 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/auth"
+	"github.com/AsterZephyr/Scree-go-AZlearn/config"
+	"github.com/AsterZephyr/Scree-go-AZlearn/config/ipdns"
+	"github.com/AsterZephyr/Scree-go-AZlearn/ui"
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestWebSocketHandshake(t *testing.T) {
+	conf := config.Config{
+		AuthMode:          config.AuthModeTurn,
+		CheckOrigin:       func(origin string) bool { return origin == "" },
+		TurnIPProvider:    &ipdns.Static{V4: net.ParseIP("127.0.0.1")},
+		TurnPorts:         []string{"3478"},
+		SessionCookieName: "user",
+	}
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: conf.SessionCookieName})
+	require.NoError(t, err)
+
+	// the turn server is only used for rooms in turn mode.
+	rooms := ws.NewRooms(nil, users, conf)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rooms.Start(ctx)
+
+	srv := httptest.NewServer(Router(conf, rooms, users, "test", "test"))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/stream", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = conn.WriteJSON(map[string]interface{}{
+		"type":    "create",
+		"payload": map[string]interface{}{"id": "room", "mode": "stun", "username": "user1"},
+	})
+	require.NoError(t, err)
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	typed := ws.Typed{}
+	require.NoError(t, conn.ReadJSON(&typed))
+	assert.Equal(t, "room", typed.Type)
+
+	room := struct {
+		ID    string `json:"id"`
+		Users []struct {
+			Name  string `json:"name"`
+			Owner bool   `json:"owner"`
+		} `json:"users"`
+	}{}
+	require.NoError(t, json.Unmarshal(typed.Payload, &room))
+	assert.Equal(t, "room", room.ID)
+	require.Len(t, room.Users, 1)
+	assert.Equal(t, "user1", room.Users[0].Name)
+	assert.True(t, room.Users[0].Owner)
+
+	count, reason := rooms.Count()
+	assert.Equal(t, "", reason)
+	assert.Equal(t, 1, count)
+}
+
+func TestWebSocketHandshake_shards(t *testing.T) {
+	conf := config.Config{
+		AuthMode:          config.AuthModeNone,
+		CheckOrigin:       func(origin string) bool { return origin == "" },
+		TurnIPProvider:    &ipdns.Static{V4: net.ParseIP("127.0.0.1")},
+		TurnPorts:         []string{"3478"},
+		SessionCookieName: "user",
+		EventLoopShards:   4,
+	}
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: conf.SessionCookieName})
+	require.NoError(t, err)
+
+	rooms := ws.NewRooms(nil, users, conf)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rooms.Start(ctx)
+
+	srv := httptest.NewServer(Router(conf, rooms, users, "test", "test"))
+	defer srv.Close()
+
+	roomUsers := func(conn *websocket.Conn) int {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		typed := ws.Typed{}
+		require.NoError(t, conn.ReadJSON(&typed))
+		require.Equal(t, "room", typed.Type)
+		room := struct {
+			Users []struct{} `json:"users"`
+		}{}
+		require.NoError(t, json.Unmarshal(typed.Payload, &room))
+		return len(room.Users)
+	}
+	connect := func(event, room string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/stream", nil)
+		require.NoError(t, err)
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{
+			"type":    event,
+			"payload": map[string]interface{}{"id": room, "mode": "stun"},
+		}))
+		return conn
+	}
+
+	// the clients start on a shard chosen by their id and must be moved to the shard of the room.
+	owner := connect("create", "room")
+	defer owner.Close()
+	assert.Equal(t, 1, roomUsers(owner))
+
+	for i := 0; i < 8; i++ {
+		other := connect("create", fmt.Sprint("other", i))
+		defer other.Close()
+		assert.Equal(t, 1, roomUsers(other))
+	}
+
+	guest := connect("join", "room")
+	defer guest.Close()
+	assert.Equal(t, 2, roomUsers(guest))
+	assert.Equal(t, 2, roomUsers(owner))
+
+	count, reason := rooms.Count()
+	assert.Equal(t, "", reason)
+	assert.Equal(t, 10, count)
+}
+
+func TestBasePath(t *testing.T) {
+	conf := config.Config{
+		AuthMode:          config.AuthModeTurn,
+		CheckOrigin:       func(origin string) bool { return origin == "" },
+		TurnIPProvider:    &ipdns.Static{V4: net.ParseIP("127.0.0.1")},
+		SessionCookieName: "user",
+		BasePath:          "/screego",
+	}
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: conf.SessionCookieName})
+	require.NoError(t, err)
+	rooms := ws.NewRooms(nil, users, conf)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rooms.Start(ctx)
+	r := Router(conf, rooms, users, "test", "test")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/screego", nil))
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/screego/", rec.Header().Get("Location"))
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/screego/config", nil))
+	uiConfig := UIConfig{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&uiConfig))
+	assert.Equal(t, "/screego/", uiConfig.BasePath)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/config", nil))
+	assert.Empty(t, rec.Body.String(), "routes must only be served under the base path")
+}
+
+func TestCompression(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(compress("/stream"))
+	body := strings.Repeat("screego ", 100)
+	r.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	})
+
+	for path, encoding := range map[string]string{"/config": "gzip", "/stream": "", "/og-banner.png": ""} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, encoding, rec.Header().Get("Content-Encoding"), path)
+	}
+}
+
+func TestUICaching(t *testing.T) {
+	r := mux.NewRouter()
+	ui.Register(r, "")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/index.html", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+
+	req := httptest.NewRequest("GET", "/index.html", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Zero(t, rec.Body.Len())
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/assets/missing.js", nil))
+	assert.Empty(t, rec.Header().Get("Cache-Control"))
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(contentSecurityPolicy("connect-src 'self' wss://{host}"))
+	r.Path("/config").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "http://screego.example/config", nil))
+	assert.Equal(t, "connect-src 'self' wss://screego.example", rec.Header().Get("Content-Security-Policy"))
+}
+
+func TestStrictTransportSecurity(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(strictTransportSecurity(31536000, true, true))
+	r.Path("/config").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "https://screego.example/config", nil))
+	assert.Equal(t, "max-age=31536000; includeSubDomains; preload", rec.Header().Get("Strict-Transport-Security"))
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "http://screego.example/config", nil))
+	assert.Empty(t, rec.Header().Get("Strict-Transport-Security"))
+}
+
+func TestWithFrameAncestors(t *testing.T) {
+	ancestors := []string{"'self'", "https://portal.example.com"}
+	assert.Equal(t, "default-src 'self'; frame-ancestors 'self' https://portal.example.com",
+		withFrameAncestors("default-src 'self'; frame-ancestors {frame-ancestors}", ancestors))
+	assert.Equal(t, "default-src 'self'; frame-ancestors 'self' https://portal.example.com",
+		withFrameAncestors("default-src 'self'", ancestors))
+	assert.Equal(t, "frame-ancestors 'self' https://portal.example.com", withFrameAncestors("", ancestors))
+}
+
+func TestAdminRooms(t *testing.T) {
+	conf := config.Config{
+		AuthMode:          config.AuthModeNone,
+		CheckOrigin:       func(origin string) bool { return origin == "" },
+		TurnIPProvider:    &ipdns.Static{V4: net.ParseIP("127.0.0.1")},
+		TurnPorts:         []string{"3478"},
+		SessionCookieName: "user",
+		AdminUsers:        []string{"admin"},
+	}
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: conf.SessionCookieName})
+	require.NoError(t, err)
+	hash, err := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users.Lookup["admin"] = string(hash)
+	users.Lookup["member"] = string(hash)
+
+	rooms := ws.NewRooms(nil, users, conf)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rooms.Start(ctx)
+
+	srv := httptest.NewServer(Router(conf, rooms, users, "test", "test"))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/stream", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type":    "create",
+		"payload": map[string]interface{}{"id": "room", "mode": "stun", "username": "owner"},
+	}))
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	require.NoError(t, conn.ReadJSON(&ws.Typed{}))
+
+	resp, err := http.Get(srv.URL + "/admin/rooms")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err := http.NewRequest("GET", srv.URL+"/admin/rooms", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("member", "admin")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "users that aren't admins are rejected")
+
+	req, err = http.NewRequest("GET", srv.URL+"/admin/rooms", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "admin")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	stats := []ws.RoomStats{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	require.Len(t, stats, 1)
+	assert.Equal(t, "room", stats[0].ID)
+	require.Len(t, stats[0].Users, 1)
+	assert.Equal(t, "owner", stats[0].Users[0].Name)
+	assert.Equal(t, 0, stats[0].Users[0].Sessions)
+}
+
+func TestAdminDrainRoom(t *testing.T) {
+	conf := config.Config{
+		AuthMode:          config.AuthModeNone,
+		CheckOrigin:       func(origin string) bool { return origin == "" },
+		TurnIPProvider:    &ipdns.Static{V4: net.ParseIP("127.0.0.1")},
+		TurnPorts:         []string{"3478"},
+		SessionCookieName: "user",
+		AdminUsers:        []string{"admin"},
+	}
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: conf.SessionCookieName})
+	require.NoError(t, err)
+	hash, err := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users.Lookup["admin"] = string(hash)
+
+	rooms := ws.NewRooms(nil, users, conf)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rooms.Start(ctx)
+
+	srv := httptest.NewServer(Router(conf, rooms, users, "test", "test"))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/stream", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type":    "create",
+		"payload": map[string]interface{}{"id": "room", "mode": "stun", "username": "owner"},
+	}))
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	require.NoError(t, conn.ReadJSON(&ws.Typed{}))
+
+	drain := func(id string, auth bool) int {
+		req, err := http.NewRequest("POST", srv.URL+"/admin/rooms/"+id+"/drain", nil)
+		require.NoError(t, err)
+		if auth {
+			req.SetBasicAuth("admin", "admin")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusUnauthorized, drain("room", false))
+	assert.Equal(t, http.StatusNotFound, drain("other", true))
+	assert.Equal(t, http.StatusAccepted, drain("room", true))
+
+	msg := ws.Typed{}
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "drain", msg.Type)
+}
+
+func TestAdminRefreshIP(t *testing.T) {
+	conf := config.Config{
+		AuthMode:          config.AuthModeNone,
+		CheckOrigin:       func(origin string) bool { return origin == "" },
+		TurnIPProvider:    &ipdns.Static{V4: net.ParseIP("192.0.2.1"), V6: net.ParseIP("2001:db8::1")},
+		TurnPorts:         []string{"3478"},
+		SessionCookieName: "user",
+		AdminUsers:        []string{"admin"},
+	}
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: conf.SessionCookieName})
+	require.NoError(t, err)
+	hash, err := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users.Lookup["admin"] = string(hash)
+
+	srv := httptest.NewServer(Router(conf, ws.NewRooms(nil, users, conf), users, "test", "test"))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/admin/refresh-ip", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err := http.NewRequest("POST", srv.URL+"/admin/refresh-ip", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "admin")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var ip ExternalIP
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ip))
+	assert.Equal(t, ExternalIP{V4: "192.0.2.1", V6: "2001:db8::1"}, ip)
+}
+
+func TestAdminAuth(t *testing.T) {
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: "user"})
+	require.NoError(t, err)
+	hash, err := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users.Lookup["admin"] = string(hash)
+	users.Lookup["member"] = string(hash)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	status := func(admins []string, user, pass string) int {
+		req := httptest.NewRequest("POST", "/admin/refresh-ip", nil)
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		rec := httptest.NewRecorder()
+		adminAuth(handler, users, admins)(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, status([]string{"admin"}, "", ""))
+	assert.Equal(t, http.StatusUnauthorized, status([]string{"admin"}, "admin", "wrong"))
+	assert.Equal(t, http.StatusForbidden, status([]string{"admin"}, "member", "pass"))
+	assert.Equal(t, http.StatusOK, status([]string{"admin"}, "admin", "pass"))
+	assert.Equal(t, http.StatusForbidden, status(nil, "admin", "pass"), "no admins disables the endpoints")
+}
+
+func TestMetricsToken(t *testing.T) {
+	conf := config.Config{MetricsBasicAuth: true, MetricsToken: "scrape"}
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: "user"})
+	require.NoError(t, err)
+	hash, err := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users.Lookup["admin"] = string(hash)
+
+	srv := httptest.NewServer(MetricsRouter(conf, users))
+	defer srv.Close()
+
+	status := func(prepare func(req *http.Request)) int {
+		req, err := http.NewRequest("GET", srv.URL+"/metrics", nil)
+		require.NoError(t, err)
+		prepare(req)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, status(func(req *http.Request) {}))
+	assert.Equal(t, http.StatusOK, status(func(req *http.Request) { req.Header.Set("Authorization", "Bearer scrape") }))
+	assert.Equal(t, http.StatusUnauthorized, status(func(req *http.Request) { req.Header.Set("Authorization", "Bearer wrong") }))
+	assert.Equal(t, http.StatusOK, status(func(req *http.Request) { req.SetBasicAuth("metrics", "scrape") }))
+	assert.Equal(t, http.StatusUnauthorized, status(func(req *http.Request) { req.SetBasicAuth("metrics", "wrong") }))
+	assert.Equal(t, http.StatusOK, status(func(req *http.Request) { req.SetBasicAuth("admin", "admin") }), "users can still scrape")
+}
+
+func TestMetricsAddress(t *testing.T) {
+	conf := config.Config{
+		AuthMode:          config.AuthModeTurn,
+		CheckOrigin:       func(origin string) bool { return origin == "" },
+		TurnIPProvider:    &ipdns.Static{V4: net.ParseIP("127.0.0.1")},
+		SessionCookieName: "user",
+		Prometheus:        true,
+		MetricsAddress:    "127.0.0.1:9090",
+	}
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: conf.SessionCookieName})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	Router(conf, ws.NewRooms(nil, users, conf), users, "test", "test").ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Empty(t, rec.Body.String(), "the metrics are only served on the metrics address")
+
+	rec = httptest.NewRecorder()
+	MetricsRouter(conf, users).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "basic auth is disabled on the metrics address")
+	assert.Contains(t, rec.Body.String(), "screego_logout_all_total")
+
+	rec = httptest.NewRecorder()
+	MetricsRouter(conf, users).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEOptions configures automatic certificates, e.g. from Let's Encrypt.
+type ACMEOptions struct {
+	// Domains are the domains certificates are requested for.
+	Domains []string
+	// CacheDir stores the account key and the certificates across restarts.
+	CacheDir string
+	// Email is the contact address of the ACME account, may be empty.
+	Email string
+	// HTTPAddress serves the HTTP-01 challenges, the ACME server connects to
+	// port 80 of the domains. Other requests are redirected to https.
+	HTTPAddress string
+}
+
+// serveACME serves srv with certificates obtained and renewed by ACME.
+func serveACME(srv *http.Server, listener net.Listener, opts *ACMEOptions, event *zerolog.Event) error {
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(opts.Domains...),
+		Cache:      autocert.DirCache(opts.CacheDir),
+		Email:      opts.Email,
+	}
+
+	challenges := &http.Server{
+		Addr:              opts.HTTPAddress,
+		Handler:           manager.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Info().Str("addr", opts.HTTPAddress).Msg("Start HTTP for ACME challenges")
+		if err := challenges.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("ACME challenge http server, certificates can't be obtained or renewed")
+		}
+	}()
+	defer challenges.Close()
+
+	if srv.TLSConfig == nil {
+		srv.TLSConfig = &tls.Config{}
+	}
+	srv.TLSConfig.GetCertificate = manager.GetCertificate
+	event.Strs("acmeDomains", opts.Domains).Msg("Start HTTP with tls")
+	return srv.ServeTLS(listener, "", "")
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// certificate serves the configured TLS certificate. It is reloaded when the
+// files change and optionally has a stapled OCSP response that is refreshed
+// in the background.
+type certificate struct {
+	certFile, keyFile string
+	current           atomic.Pointer[tls.Certificate]
+	// reloaded notifies the staple goroutine about a new certificate.
+	reloaded chan struct{}
+
+	// modified are the modification times of the loaded files. Only
+	// accessed by the watch goroutine.
+	modified [2]time.Time
+	// stapleExpiry is the NextUpdate of the stapled response. Only accessed
+	// by the staple goroutine.
+	stapleExpiry time.Time
+}
+
+func loadCertificate(certFile, keyFile string) (*certificate, error) {
+	c := &certificate{certFile: certFile, keyFile: keyFile, reloaded: make(chan struct{}, 1)}
+	c.modified = c.modTimes()
+	cert, err := readCertificate(certFile, keyFile, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	c.current.Store(cert)
+	return c, nil
+}
+
+// readCertificate loads the key pair and checks that the certificate is
+// valid at now.
+func readCertificate(certFile, keyFile string, now time.Time) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("the certificate is only valid from %s to %s", leaf.NotBefore, leaf.NotAfter)
+	}
+	return &cert, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c *certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.current.Load(), nil
+}
+
+// watch reloads the certificate every interval if the files were modified,
+// until done is closed.
+func (c *certificate) watch(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.reloadIfModified(time.Now())
+		case <-done:
+			return
+		}
+	}
+}
+
+// reloadIfModified loads the certificate if the files were modified since the
+// last load. An invalid certificate is logged and the previous one is kept,
+// the files are checked again once they are modified the next time.
+func (c *certificate) reloadIfModified(now time.Time) {
+	modified := c.modTimes()
+	if modified == c.modified {
+		return
+	}
+	c.modified = modified
+
+	cert, err := readCertificate(c.certFile, c.keyFile, now)
+	if err != nil {
+		log.Error().Err(err).Str("cert", c.certFile).Msg("Could not reload TLS certificate, keeping the previous one")
+		return
+	}
+	c.current.Store(cert)
+	select {
+	case c.reloaded <- struct{}{}:
+	default:
+	}
+	log.Info().Str("cert", c.certFile).Msg("Reloaded TLS certificate")
+}
+
+func (c *certificate) modTimes() [2]time.Time {
+	var result [2]time.Time
+	for i, file := range []string{c.certFile, c.keyFile} {
+		if info, err := os.Stat(file); err == nil {
+			result[i] = info.ModTime()
+		}
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeyPair writes a self-signed certificate valid until notAfter and
+// sets the modification time of the files to modified.
+func writeKeyPair(t *testing.T, dir string, notAfter, modified time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	require.NoError(t, os.Chtimes(certFile, modified, modified))
+	require.NoError(t, os.Chtimes(keyFile, modified, modified))
+	return certFile, keyFile
+}
+
+func TestCertificate_reloadIfModified(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Minute)
+	certFile, keyFile := writeKeyPair(t, dir, time.Now().Add(time.Hour), start)
+	c, err := loadCertificate(certFile, keyFile)
+	require.NoError(t, err)
+	first := c.current.Load()
+
+	c.reloadIfModified(time.Now())
+	assert.Same(t, first, c.current.Load(), "unchanged files aren't loaded again")
+
+	writeKeyPair(t, dir, time.Now().Add(2*time.Hour), start.Add(time.Second))
+	c.reloadIfModified(time.Now())
+	renewed := c.current.Load()
+	assert.NotEqual(t, first.Certificate, renewed.Certificate)
+	assert.Len(t, c.reloaded, 1, "the stapler is notified")
+
+	writeKeyPair(t, dir, time.Now().Add(-time.Minute), start.Add(2*time.Second))
+	c.reloadIfModified(time.Now())
+	assert.Same(t, renewed, c.current.Load(), "expired certificates aren't used")
+
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+	c.reloadIfModified(time.Now())
+	assert.Same(t, renewed, c.current.Load(), "invalid files aren't used")
+}
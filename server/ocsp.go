@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	ocspClient = &http.Client{Timeout: 10 * time.Second}
+	// ocspRetry is the delay before fetching the OCSP response again after
+	// an error.
+	ocspRetry = 5 * time.Minute
+)
+
+// staple keeps the OCSP response of the certificate up to date until done is
+// closed. If the OCSP responder is unreachable, the certificate is served
+// without stapling once the previous response expired.
+func (c *certificate) staple(done <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(c.refreshStaple(time.Now())):
+		case <-c.reloaded:
+		case <-done:
+			return
+		}
+	}
+}
+
+// refreshStaple fetches a new OCSP response and returns the delay until the
+// next refresh.
+func (c *certificate) refreshStaple(now time.Time) time.Duration {
+	cert := c.current.Load()
+	raw, resp, err := fetchOCSP(cert)
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not fetch OCSP response")
+		if cert.OCSPStaple != nil && now.After(c.stapleExpiry) {
+			log.Warn().Msg("OCSP response expired, serving the certificate without stapling")
+			c.store(cert, nil)
+		}
+		return ocspRetry
+	}
+	if !c.store(cert, raw) {
+		// the certificate was reloaded while fetching, staple the new one
+		return 0
+	}
+	c.stapleExpiry = resp.NextUpdate
+	log.Info().Time("nextUpdate", resp.NextUpdate).Msg("Updated OCSP staple")
+
+	// refresh halfway to the next update, responders without NextUpdate
+	// have new information available at any time
+	if resp.NextUpdate.IsZero() {
+		return time.Hour
+	}
+	return max(resp.NextUpdate.Sub(now)/2, ocspRetry)
+}
+
+// store replaces the staple of cert. It returns false if cert isn't the
+// current certificate anymore.
+func (c *certificate) store(cert *tls.Certificate, staple []byte) bool {
+	updated := *cert
+	updated.OCSPStaple = staple
+	return c.current.CompareAndSwap(cert, &updated)
+}
+
+// fetchOCSP requests the OCSP response for the leaf of cert from its
+// responder. The issuer must be the second certificate of the chain.
+func fetchOCSP(cert *tls.Certificate) ([]byte, *ocsp.Response, error) {
+	if len(cert.Certificate) < 2 {
+		return nil, nil, errors.New("the certificate file contains no issuer certificate")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(leaf.OCSPServer) == 0 {
+		return nil, nil, errors.New("the certificate has no OCSP responder")
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpResp, err := ocspClient.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("OCSP responder returned %s", httpResp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.Status != ocsp.Good {
+		return nil, nil, fmt.Errorf("OCSP status of the certificate isn't good: %d", resp.Status)
+	}
+	return raw, resp, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+// testChain returns a certificate signed by a test CA whose OCSP responder
+// answers with status.
+func testChain(t *testing.T, status *int) (*tls.Certificate, *httptest.Server) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       *status,
+			SerialNumber: big.NewInt(2),
+			ThisUpdate:   time.Now(),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}, caKey)
+		require.NoError(t, err)
+		_, _ = w.Write(resp)
+	}))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{responder.URL},
+	}, ca, key.Public(), caKey)
+	require.NoError(t, err)
+
+	return &tls.Certificate{Certificate: [][]byte{leafDER, caDER}, PrivateKey: crypto.Signer(key)}, responder
+}
+
+func TestCertificate_refreshStaple(t *testing.T) {
+	status := ocsp.Good
+	cert, responder := testChain(t, &status)
+	defer responder.Close()
+	c := &certificate{}
+	c.current.Store(cert)
+
+	now := time.Now()
+	wait := c.refreshStaple(now)
+	assert.InDelta(t, 30*time.Minute, wait, float64(time.Minute))
+	staple := c.current.Load().OCSPStaple
+	assert.NotEmpty(t, staple)
+
+	status = ocsp.Revoked
+	assert.Equal(t, ocspRetry, c.refreshStaple(now))
+	assert.Equal(t, staple, c.current.Load().OCSPStaple, "the staple is kept until it expires")
+
+	responder.Close()
+	assert.Equal(t, ocspRetry, c.refreshStaple(now.Add(2*time.Hour)))
+	assert.Nil(t, c.current.Load().OCSPStaple, "expired staples are removed")
+}
+
+func TestFetchOCSP_requiresIssuer(t *testing.T) {
+	status := ocsp.Good
+	cert, responder := testChain(t, &status)
+	defer responder.Close()
+
+	_, _, err := fetchOCSP(&tls.Certificate{Certificate: cert.Certificate[:1]})
+	assert.Error(t, err)
+}
@@ -2,15 +2,23 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/AsterZephyr/Scree-go-AZlearn/util"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 var (
@@ -20,54 +28,184 @@ var (
 	}
 )
 
-func Start(mux *mux.Router, address, cert, key string) error {
-	server, shutdown := startServer(mux, address, cert, key)
-	shutdownOnInterruptSignal(server, 2*time.Second, shutdown)
+// Options configures the http server. A zero timeout disables the respective
+// timeout.
+type Options struct {
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// SocketMode are the permissions of the unix socket, if listening on one.
+	SocketMode fs.FileMode
+	// ActivationName is the FileDescriptorName of the socket passed by
+	// systemd socket activation. If such a socket exists, it is used instead
+	// of listening on the address.
+	ActivationName string
+	// ProxyProtocolUpstreams are the networks of load balancers that send a
+	// PROXY protocol v2 header. Empty disables PROXY protocol.
+	ProxyProtocolUpstreams []*net.IPNet
+	// TLS is the base configuration for TLS connections, e.g. the minimum
+	// version. Nil uses the Go defaults.
+	TLS *tls.Config
+	// OCSPStapling staples the OCSP response of the certificate to TLS
+	// handshakes. The response is refreshed in the background.
+	OCSPStapling bool
+	// CertReloadInterval is how often the certificate files are checked for
+	// changes, e.g. after a renewal. Zero disables reloading.
+	CertReloadInterval time.Duration
+	// ACME obtains certificates automatically instead of using the cert and
+	// key files. Nil disables ACME.
+	ACME *ACMEOptions
+	// OnShutdown is called when SIGINT or SIGTERM is received, before the
+	// server shuts down, e.g. to stop the components serving the requests.
+	OnShutdown func()
+}
+
+func Start(mux *mux.Router, address, cert, key string, opts Options) error {
+	server, shutdown := startServer(mux, address, cert, key, opts)
+	shutdownOnInterruptSignal(server, 2*time.Second, shutdown, opts.OnShutdown)
 	return waitForServerToClose(shutdown)
 }
 
-func startServer(mux *mux.Router, address, cert, key string) (*http.Server, chan error) {
+func startServer(mux *mux.Router, address, cert, key string, opts Options) (*http.Server, chan error) {
+	h2 := &http2.Server{IdleTimeout: opts.IdleTimeout}
 	srv := &http.Server{
-		Addr:    address,
-		Handler: mux,
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		// WebSocket connections are hijacked, the write deadline is cleared
+		// on upgrade, so this only affects regular requests.
+		WriteTimeout: opts.WriteTimeout,
+		IdleTimeout:  opts.IdleTimeout,
+	}
+	if cert != "" || key != "" || opts.ACME != nil {
+		if opts.TLS != nil {
+			srv.TLSConfig = opts.TLS.Clone()
+		}
+		if err := http2.ConfigureServer(srv, h2); err != nil {
+			log.Warn().Err(err).Msg("Could not enable HTTP/2")
+		}
+	} else {
+		// WebSocket upgrades are plain HTTP/1.1 requests and pass through h2c.
+		srv.Handler = h2c.NewHandler(mux, h2)
 	}
 
 	shutdown := make(chan error)
 	go func() {
-		err := listenAndServe(srv, address, cert, key)
+		err := listenAndServe(srv, address, cert, key, opts)
 		shutdown <- err
 	}()
 	return srv, shutdown
 }
 
-func listenAndServe(srv *http.Server, address, cert, key string) error {
+func listenAndServe(srv *http.Server, address, cert, key string, opts Options) error {
 	var err error
 	var listener net.Listener
 
-	if strings.HasPrefix(address, "unix:") {
-		listener, err = net.Listen("unix", address[5:])
+	if activated := activatedListener(opts.ActivationName); activated != nil {
+		log.Info().Str("name", opts.ActivationName).Msg("Using socket passed by systemd")
+		listener, address = activated, activated.Addr().String()
+	} else if strings.HasPrefix(address, "unix:") {
+		listener, err = listenUnix(address[5:], opts.SocketMode)
 	} else {
 		listener, err = net.Listen("tcp", address)
 	}
 	if err != nil {
 		return err
 	}
-	if cert != "" || key != "" {
-		log.Info().Str("addr", address).Msg("Start HTTP with tls")
-		return srv.ServeTLS(listener, cert, key)
+	if len(opts.ProxyProtocolUpstreams) > 0 {
+		listener = util.ProxyListener(listener, opts.ProxyProtocolUpstreams)
+	}
+	if cert != "" || key != "" || opts.ACME != nil {
+		event := log.Info().Str("addr", address)
+		if srv.TLSConfig != nil {
+			event = event.Str("minVersion", tls.VersionName(srv.TLSConfig.MinVersion)).Strs("cipherSuites", cipherSuiteNames(srv.TLSConfig.CipherSuites))
+		}
+		if opts.ACME != nil {
+			return serveACME(srv, listener, opts.ACME, event)
+		}
+		c, err := loadCertificate(cert, key)
+		if err != nil {
+			return err
+		}
+		stop := make(chan struct{})
+		defer close(stop)
+		if opts.CertReloadInterval > 0 {
+			go c.watch(stop, opts.CertReloadInterval)
+		}
+		if opts.OCSPStapling {
+			go c.staple(stop)
+		}
+		if srv.TLSConfig == nil {
+			srv.TLSConfig = &tls.Config{}
+		}
+		srv.TLSConfig.GetCertificate = c.GetCertificate
+		event.Bool("ocspStapling", opts.OCSPStapling).Dur("certReloadInterval", opts.CertReloadInterval).Msg("Start HTTP with tls")
+		return srv.ServeTLS(listener, "", "")
 	} else {
 		log.Info().Str("addr", address).Msg("Start HTTP")
 		return srv.Serve(listener)
 	}
 }
 
-func shutdownOnInterruptSignal(server *http.Server, timeout time.Duration, shutdown chan<- error) {
+func cipherSuiteNames(ids []uint16) []string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, tls.CipherSuiteName(id))
+	}
+	return names
+}
+
+func activatedListener(name string) net.Listener {
+	if name == "" {
+		return nil
+	}
+	return util.ActivatedListener(name)
+}
+
+// listenUnix listens on the unix socket at path. A stale socket left behind by
+// a previous process is removed, a socket still in use results in an error.
+func listenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		log.Info().Str("path", path).Msg("Removing stale unix socket")
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// shutdownOnInterruptSignal shuts the server down on SIGINT and on SIGTERM,
+// which docker and systemd send to stop the process.
+func shutdownOnInterruptSignal(server *http.Server, timeout time.Duration, shutdown chan<- error, onShutdown func()) {
 	interrupt := make(chan os.Signal, 1)
-	notifySignal(interrupt, os.Interrupt)
+	notifySignal(interrupt, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		<-interrupt
-		log.Info().Msg("Received interrupt. Shutting down...")
+		sig := <-interrupt
+		log.Info().Str("signal", sig.String()).Msg("Received interrupt. Shutting down...")
+		if onShutdown != nil {
+			onShutdown()
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
 		if err := serverShutdown(server, ctx); err != nil {
@@ -6,7 +6,9 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"syscall"
 	"testing"
 	"time"
 
@@ -25,7 +27,7 @@ func TestShutdownOnErrorWhileShutdown(t *testing.T) {
 	finished := make(chan error)
 
 	go func() {
-		finished <- Start(mux.NewRouter(), ":"+strconv.Itoa(port()), "", "")
+		finished <- Start(mux.NewRouter(), ":"+strconv.Itoa(port()), "", "", Options{})
 	}()
 
 	select {
@@ -40,7 +42,7 @@ func TestShutdownAfterError(t *testing.T) {
 	finished := make(chan error)
 
 	go func() {
-		finished <- Start(mux.NewRouter(), ":-5", "", "")
+		finished <- Start(mux.NewRouter(), ":-5", "", "", Options{})
 	}()
 
 	select {
@@ -58,7 +60,7 @@ func TestShutdown(t *testing.T) {
 	finished := make(chan error)
 
 	go func() {
-		finished <- Start(mux.NewRouter(), ":"+strconv.Itoa(port()), "", "")
+		finished <- Start(mux.NewRouter(), ":"+strconv.Itoa(port()), "", "", Options{})
 	}()
 
 	select {
@@ -69,13 +71,73 @@ func TestShutdown(t *testing.T) {
 	}
 }
 
+func TestShutdown_sigterm(t *testing.T) {
+	dispose := fakeSignal(t, syscall.SIGTERM)
+	defer dispose()
+
+	stopped := make(chan struct{})
+	finished := make(chan error)
+	go func() {
+		finished <- Start(mux.NewRouter(), ":"+strconv.Itoa(port()), "", "", Options{OnShutdown: func() { close(stopped) }})
+	}()
+
+	select {
+	case <-time.After(1 * time.Second):
+		t.Fatal("Server should be closed")
+	case err := <-finished:
+		assert.Nil(t, err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("OnShutdown should be called")
+	}
+}
+
+func TestStartServerTimeouts(t *testing.T) {
+	srv, shutdown := startServer(mux.NewRouter(), ":-5", "", "", Options{
+		ReadHeaderTimeout: time.Second,
+		WriteTimeout:      2 * time.Second,
+		IdleTimeout:       3 * time.Second,
+	})
+	assert.NotNil(t, <-shutdown)
+	assert.Equal(t, time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 2*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 3*time.Second, srv.IdleTimeout)
+}
+
+func TestListenUnixRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "screego.sock")
+
+	stale, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listenUnix(path, 0o600)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	_, err = listenUnix(path, 0o600)
+	assert.Error(t, err, "socket in use must not be removed")
+}
+
 func fakeInterrupt(t *testing.T) func() {
+	return fakeSignal(t, os.Interrupt)
+}
+
+func fakeSignal(t *testing.T, signal os.Signal) func() {
 	oldNotify := notifySignal
 	notifySignal = func(c chan<- os.Signal, sig ...os.Signal) {
 		assert.Contains(t, sig, os.Interrupt)
+		assert.Contains(t, sig, syscall.SIGTERM)
 		go func() {
 			time.Sleep(100 * time.Millisecond)
-			c <- os.Interrupt
+			c <- signal
 		}()
 	}
 	return func() {
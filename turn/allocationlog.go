@@ -0,0 +1,42 @@
+package turn
+
+import (
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// allocationLog 控制中继分配日志的级别和采样，独立于其他日志
+type allocationLog struct {
+	disabled bool
+	level    zerolog.Level
+	every    uint32        // 只记录每第every次分配
+	count    atomic.Uint32 // 已分配的次数
+}
+
+// newAllocationLog 根据配置创建分配日志，mode是off、debug或info
+func newAllocationLog(mode string, every uint32) *allocationLog {
+	l := &allocationLog{level: zerolog.DebugLevel, every: every}
+	switch mode {
+	case "off":
+		l.disabled = true
+	case "info":
+		l.level = zerolog.InfoLevel
+	}
+	return l
+}
+
+// event 返回本次分配的日志事件，不需要记录时返回nil，zerolog会忽略对nil事件的调用
+func (l *allocationLog) event() *zerolog.Event {
+	if l == nil {
+		return log.Debug()
+	}
+	if l.disabled {
+		return nil
+	}
+	if l.every > 1 && (l.count.Add(1)-1)%l.every != 0 {
+		return nil
+	}
+	return log.WithLevel(l.level)
+}
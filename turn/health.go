@@ -0,0 +1,87 @@
+package turn
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// healthCheckTimeout 是一次STUN绑定请求等待响应的时间
+const healthCheckTimeout = 2 * time.Second
+
+// monitor 定期向本地TURN监听器发送STUN绑定请求并记录结果
+// 状态变化时记录日志，结果通过Healthy和screego_turn_healthy暴露
+func (a *InternalServer) monitor(addr *net.UDPAddr, interval time.Duration) {
+	target := localAddr(addr)
+	for {
+		err := stunBinding(target, healthCheckTimeout)
+		healthy := err == nil
+		if a.healthy.Swap(healthy) != healthy {
+			if healthy {
+				log.Info().Str("addr", target.String()).Msg("TURN health check recovered")
+			} else {
+				log.Error().Err(err).Str("addr", target.String()).Msg("TURN health check failed")
+			}
+		}
+		if healthy {
+			turnHealthy.Set(1)
+		} else {
+			turnHealthy.Set(0)
+		}
+		select {
+		case <-time.After(interval):
+		case <-a.done:
+			return
+		}
+	}
+}
+
+// localAddr 将未指定的监听地址替换为对应协议族的回环地址
+func localAddr(addr *net.UDPAddr) *net.UDPAddr {
+	target := *addr
+	if target.IP == nil || target.IP.IsUnspecified() {
+		if target.IP != nil && target.IP.To4() == nil {
+			target.IP = net.IPv6loopback
+		} else {
+			target.IP = net.IPv4(127, 0, 0, 1)
+		}
+	}
+	return &target
+}
+
+// stunBinding 发送一个STUN绑定请求并校验响应
+func stunBinding(addr *net.UDPAddr, timeout time.Duration) error {
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	request := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	if _, err := conn.Write(request.Raw); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	response := &stun.Message{Raw: buf[:n]}
+	if err := response.Decode(); err != nil {
+		return err
+	}
+	if response.TransactionID != request.TransactionID {
+		return fmt.Errorf("unexpected transaction id")
+	}
+	if response.Type != stun.BindingSuccess {
+		return fmt.Errorf("unexpected response %s", response.Type)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package turn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStunBinding(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 1500)
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		request := &stun.Message{Raw: buf[:n]}
+		if request.Decode() != nil {
+			return
+		}
+		response := stun.MustBuild(stun.NewTransactionIDSetter(request.TransactionID), stun.BindingSuccess)
+		_, _ = conn.WriteToUDP(response.Raw, addr)
+	}()
+
+	addr := localAddr(conn.LocalAddr().(*net.UDPAddr))
+	assert.True(t, addr.IP.IsLoopback())
+	assert.NoError(t, stunBinding(addr, time.Second))
+
+	// nobody answers the second request
+	assert.Error(t, stunBinding(addr, 100*time.Millisecond))
+}
@@ -0,0 +1,25 @@
+package turn
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	turnCredentialsIssuedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "screego_turn_credentials_issued_total",
+		Help: "The total number of TURN credentials issued",
+	})
+	turnCredentialsRevokedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "screego_turn_credentials_revoked_total",
+		Help: "The total number of TURN credentials revoked",
+	})
+	turnCredentialsActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "screego_turn_credentials_active",
+		Help: "The number of currently valid TURN credentials of the internal TURN server",
+	})
+	turnHealthy = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "screego_turn_healthy",
+		Help: "1 if the last health check of the internal TURN server succeeded, 0 otherwise",
+	})
+)
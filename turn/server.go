@@ -6,13 +6,16 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/turn/v4"
 	"github.com/rs/zerolog/log"
 	"github.com/AsterZephyr/Scree-go-AZlearn/config"
 	"github.com/AsterZephyr/Scree-go-AZlearn/config/ipdns"
+	"github.com/AsterZephyr/Scree-go-AZlearn/logger"
 	"github.com/AsterZephyr/Scree-go-AZlearn/util"
 )
 
@@ -23,13 +26,25 @@ type Server interface {
 	Credentials(id string, addr net.IP) (string, string)
 	// Disallow 撤销指定用户名的访问权限
 	Disallow(username string)
+	// DisallowPrefix 撤销所有以prefix开头的用户名的访问权限
+	DisallowPrefix(prefix string)
+	// Healthy 返回最近一次健康检查是否成功
+	Healthy() bool
+	// TTL 返回新签发凭证的有效期，0表示凭证在撤销前一直有效
+	TTL() time.Duration
+	// Close 停止TURN服务器，已分配的中继随之关闭
+	Close() error
 }
 
 // InternalServer 实现了内部TURN服务器
 // 直接在Screego服务器内部运行TURN服务
 type InternalServer struct {
-	lock   sync.RWMutex     // 用于保护lookup映射的读写锁
-	lookup map[string]Entry // 存储用户名到凭证条目的映射
+	lock    sync.RWMutex     // 用于保护lookup映射的读写锁
+	lookup  map[string]Entry // 存储用户名到凭证条目的映射
+	healthy atomic.Bool      // 最近一次健康检查的结果
+	authLog *allocationLog   // 认证成功的日志，与分配日志使用相同的级别和采样，为nil时以debug级别记录
+	server  *turn.Server     // pion的TURN服务器，为nil时没有启动
+	done    chan struct{}    // 服务器停止时关闭，用于停止健康检查
 }
 
 // ExternalServer 实现了外部TURN服务器连接
@@ -52,7 +67,8 @@ const Realm = "screego"
 // 扩展了turn库的RelayAddressGenerator接口
 type Generator struct {
 	turn.RelayAddressGenerator
-	IPProvider ipdns.Provider // 提供IP地址的服务
+	IPProvider ipdns.Provider  // 提供IP地址的服务
+	Log        *allocationLog // 分配日志，为nil时以debug级别记录每次分配
 }
 
 // AllocatePacketConn 分配一个网络连接和地址用于TURN中继
@@ -71,16 +87,52 @@ func (r *Generator) AllocatePacketConn(network string, requestedPort int) (net.P
 		return conn, addr, err
 	}
 
-	// 根据网络情况选择合适的IP地址
-	if v6 == nil || (relayAddr.IP.To4() != nil && v4 != nil) {
-		relayAddr.IP = v4
-	} else {
-		relayAddr.IP = v6
+	// 根据网络情况选择合适的IP地址，不可路由的地址回退到另一个地址族
+	relayAddr.IP, err = relayIP(v4, v6, relayAddr.IP.To4() != nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	r.Log.event().Str("addr", addr.String()).Str("relayaddr", relayAddr.String()).Msg("TURN allocated")
+	return conn, &relayAddr, nil
+}
+
+// relayIP 选择发给客户端的中继地址，preferV4为true时优先使用IPv4
+// 客户端无法访问的地址（链路本地、未指定地址等）被跳过，回环地址和IPv6唯一本地地址只在没有其他地址时使用
+// 两个地址都不可用时返回错误
+// 私有IPv4地址仍然可用，局域网内的部署会使用它们
+func relayIP(v4, v6 net.IP, preferV4 bool) (net.IP, error) {
+	candidates := []net.IP{v6, v4}
+	if v6 == nil || (preferV4 && v4 != nil) {
+		candidates = []net.IP{v4, v6}
+	}
+	for _, ip := range candidates {
+		if ip == nil {
+			continue
+		}
+		if routable(ip) {
+			return ip, nil
+		}
+		log.Warn().Str("ip", ip.String()).Msg("TURN relay address isn't routable, trying the other address family")
 	}
-	if err == nil {
-		log.Debug().Str("addr", addr.String()).Str("relayaddr", relayAddr.String()).Msg("TURN allocated")
+	// 没有可路由的地址时使用本地地址，例如TurnExternalIP=127.0.0.1的本地部署
+	for _, ip := range candidates {
+		if ip != nil && local(ip) {
+			log.Warn().Str("ip", ip.String()).Msg("TURN relay address is local, only clients on this host or network can reach it")
+			return ip, nil
+		}
 	}
-	return conn, &relayAddr, err
+	return nil, fmt.Errorf("no routable relay address in v4=%s v6=%s", v4, v6)
+}
+
+// routable 返回ip是否可以作为中继地址发给客户端
+func routable(ip net.IP) bool {
+	return !ip.IsUnspecified() && !ip.IsLinkLocalUnicast() && !ip.IsMulticast() && !local(ip)
+}
+
+// local 返回ip是否是回环地址或IPv6唯一本地地址 fc00::/7，只有本机或本地网络中的客户端可以访问
+func local(ip net.IP) bool {
+	return ip.IsLoopback() || (ip.To4() == nil && ip[0]&0xfe == 0xfc)
 }
 
 // Start 根据配置启动TURN服务器
@@ -105,40 +157,51 @@ func newExternalServer(conf config.Config) (Server, error) {
 // newInternalServer 创建并启动一个内部TURN服务器
 // 设置UDP和TCP监听器，配置权限和认证
 func newInternalServer(conf config.Config) (Server, error) {
-	// 创建UDP监听器
-	udpListener, err := net.ListenPacket("udp", conf.TurnAddress)
-	if err != nil {
-		return nil, fmt.Errorf("udp: could not listen on %s: %s", conf.TurnAddress, err)
+	var err error
+	// 创建UDP监听器，优先使用systemd socket activation传入的套接字
+	udpListener := util.ActivatedPacketConn("turn")
+	if udpListener != nil {
+		log.Info().Str("addr", udpListener.LocalAddr().String()).Msg("Using TURN udp socket passed by systemd")
+	} else {
+		udpListener, err = net.ListenPacket("udp", conf.TurnAddress)
+		if err != nil {
+			return nil, fmt.Errorf("udp: could not listen on %s: %s", conf.TurnAddress, err)
+		}
 	}
 	// 创建TCP监听器
-	tcpListener, err := net.Listen("tcp", conf.TurnAddress)
-	if err != nil {
-		return nil, fmt.Errorf("tcp: could not listen on %s: %s", conf.TurnAddress, err)
+	tcpListener := util.ActivatedListener("turn")
+	if tcpListener != nil {
+		log.Info().Str("addr", tcpListener.Addr().String()).Msg("Using TURN tcp socket passed by systemd")
+	} else {
+		tcpListener, err = net.Listen("tcp", conf.TurnAddress)
+		if err != nil {
+			return nil, fmt.Errorf("tcp: could not listen on %s: %s", conf.TurnAddress, err)
+		}
+	}
+	// 负载均衡器发送PROXY协议头时，使用头中的客户端地址进行权限检查
+	if conf.ProxyProtocol {
+		tcpListener = util.ProxyListener(tcpListener, conf.ProxyProtocolTrustedUpstreamsParsed)
 	}
 
 	// 创建服务器实例
-	svr := &InternalServer{lookup: map[string]Entry{}}
+	// 生成器无法得知分配请求的用户名，用户名和客户端地址在认证时记录
+	svr := &InternalServer{lookup: map[string]Entry{}, authLog: newAllocationLog(conf.TurnAllocationLog, conf.TurnAllocationLogRate), done: make(chan struct{})}
+	svr.healthy.Store(true)
 
 	// 创建中继地址生成器
 	gen := &Generator{
 		RelayAddressGenerator: generator(conf),
 		IPProvider:            conf.TurnIPProvider,
+		Log:                   newAllocationLog(conf.TurnAllocationLog, conf.TurnAllocationLogRate),
 	}
 
 	// 定义权限处理函数，用于控制哪些对等方可以连接
 	var permissions turn.PermissionHandler = func(clientAddr net.Addr, peerIP net.IP) bool {
-		// 检查是否在拒绝列表中
-		for _, cidr := range conf.TurnDenyPeersParsed {
-			if cidr.Contains(peerIP) {
-				return false
-			}
-		}
-
-		return true
+		return peerAllowed(conf.TurnDenyPeersParsed, conf.TurnAllowPeersParsed, peerIP)
 	}
 
 	// 创建并启动TURN服务器
-	_, err = turn.NewServer(turn.ServerConfig{
+	svr.server, err = turn.NewServer(turn.ServerConfig{
 		Realm:       Realm,
 		AuthHandler: svr.authenticate, // 设置认证处理函数
 		ListenerConfigs: []turn.ListenerConfig{
@@ -153,9 +216,34 @@ func newInternalServer(conf config.Config) (Server, error) {
 	}
 
 	log.Info().Str("addr", conf.TurnAddress).Msg("Start TURN/STUN")
+	turnHealthy.Set(1)
+	if conf.TurnHealthCheckSeconds > 0 {
+		go svr.monitor(udpListener.LocalAddr().(*net.UDPAddr), time.Duration(conf.TurnHealthCheckSeconds)*time.Second)
+	}
 	return svr, nil
 }
 
+// peerAllowed 检查是否允许中继到peerIP
+// 拒绝列表优先，允许列表不为空时只允许其中的地址
+func peerAllowed(deny, allow []*net.IPNet, peerIP net.IP) bool {
+	// 检查是否在拒绝列表中
+	for _, cidr := range deny {
+		if cidr.Contains(peerIP) {
+			return false
+		}
+	}
+	if len(allow) == 0 {
+		return true
+	}
+	// 检查是否在允许列表中
+	for _, cidr := range allow {
+		if cidr.Contains(peerIP) {
+			return true
+		}
+	}
+	return false
+}
+
 // generator 根据配置创建合适的中继地址生成器
 // 如果配置了端口范围，则使用端口范围生成器
 func generator(conf config.Config) turn.RelayAddressGenerator {
@@ -176,6 +264,7 @@ func (a *InternalServer) allow(username, password string, addr net.IP) {
 		addr:     addr,
 		password: turn.GenerateAuthKey(username, Realm, password),
 	}
+	turnCredentialsActive.Set(float64(len(a.lookup)))
 }
 
 // Disallow 实现Server接口，撤销指定用户名的访问权限
@@ -184,15 +273,73 @@ func (a *InternalServer) Disallow(username string) {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
+	if _, ok := a.lookup[username]; !ok {
+		return
+	}
 	delete(a.lookup, username)
+	turnCredentialsRevokedTotal.Inc()
+	turnCredentialsActive.Set(float64(len(a.lookup)))
+}
+
+// DisallowPrefix 实现Server接口，删除所有以prefix开头的用户条目
+func (a *InternalServer) DisallowPrefix(prefix string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for username := range a.lookup {
+		if strings.HasPrefix(username, prefix) {
+			delete(a.lookup, username)
+			turnCredentialsRevokedTotal.Inc()
+		}
+	}
+	turnCredentialsActive.Set(float64(len(a.lookup)))
+}
+
+// DisallowPrefix 实现Server接口，外部服务器的凭证会在TTL到期后自动失效
+func (a *ExternalServer) DisallowPrefix(prefix string) {
+	// 不支持，将在TTL到期后自动失效
 }
 
 // Disallow 实现Server接口，对于外部服务器不支持直接撤销
-// 外部服务器的凭证会在TTL到期后自动失效
+// 外部服务器的凭证会在TTL到期后自动失效，因此不计入撤销的凭证
 func (a *ExternalServer) Disallow(username string) {
 	// 不支持，将在TTL到期后自动失效
 }
 
+// Healthy 实现Server接口，返回最近一次健康检查的结果
+func (a *InternalServer) Healthy() bool {
+	return a.healthy.Load()
+}
+
+// Healthy 实现Server接口，外部服务器不做检查
+func (a *ExternalServer) Healthy() bool {
+	return true
+}
+
+// Close 实现Server接口，关闭监听的连接和所有中继
+func (a *InternalServer) Close() error {
+	if a.server == nil {
+		return nil
+	}
+	close(a.done)
+	return a.server.Close()
+}
+
+// Close 实现Server接口，外部服务器不由Screego运行
+func (a *ExternalServer) Close() error {
+	return nil
+}
+
+// TTL 实现Server接口，内部服务器的凭证在会话结束撤销前一直有效
+func (a *InternalServer) TTL() time.Duration {
+	return 0
+}
+
+// TTL 实现Server接口，返回外部服务器凭证的有效期
+func (a *ExternalServer) TTL() time.Duration {
+	return a.ttl
+}
+
 // authenticate 是TURN服务器的认证回调函数
 // 检查用户名是否存在并返回对应的密码
 func (a *InternalServer) authenticate(username, realm string, addr net.Addr) ([]byte, bool) {
@@ -202,11 +349,11 @@ func (a *InternalServer) authenticate(username, realm string, addr net.Addr) ([]
 	entry, ok := a.lookup[username]
 
 	if !ok {
-		log.Debug().Interface("addr", addr).Str("username", username).Msg("TURN username not found")
+		log.Debug().Str("addr", logger.Addr(addr.String())).Str("username", username).Msg("TURN username not found")
 		return nil, false
 	}
 
-	log.Debug().Interface("addr", addr.String()).Str("realm", realm).Msg("TURN authenticated")
+	a.authLog.event().Str("addr", logger.Addr(addr.String())).Str("username", username).Str("realm", realm).Msg("TURN authenticated")
 	return entry.password, true
 }
 
@@ -215,6 +362,7 @@ func (a *InternalServer) authenticate(username, realm string, addr net.Addr) ([]
 func (a *InternalServer) Credentials(id string, addr net.IP) (string, string) {
 	password := util.RandString(20)
 	a.allow(id, password, addr)
+	turnCredentialsIssuedTotal.Inc()
 	return id, password
 }
 
@@ -227,5 +375,6 @@ func (a *ExternalServer) Credentials(id string, addr net.IP) (string, string) {
 	mac := hmac.New(sha1.New, a.secret)
 	_, _ = mac.Write([]byte(username))
 	password := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	turnCredentialsIssuedTotal.Inc()
 	return username, password
 }
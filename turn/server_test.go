@@ -0,0 +1,142 @@
+package turn
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/config/ipdns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisallowPrefix(t *testing.T) {
+	svr := &InternalServer{lookup: map[string]Entry{}}
+	svr.Credentials("session1host", net.IPv4(127, 0, 0, 1))
+	svr.Credentials("session1client", net.IPv4(127, 0, 0, 1))
+	svr.Credentials("session2host", net.IPv4(127, 0, 0, 1))
+
+	svr.DisallowPrefix("session1")
+
+	assert.Len(t, svr.lookup, 1)
+	assert.Contains(t, svr.lookup, "session2host")
+}
+
+func TestPeerAllowed(t *testing.T) {
+	cidrs := func(values ...string) (result []*net.IPNet) {
+		for _, value := range values {
+			_, cidr, err := net.ParseCIDR(value)
+			assert.NoError(t, err)
+			result = append(result, cidr)
+		}
+		return result
+	}
+	deny := cidrs("10.0.0.0/8", "fe80::/10")
+	allow := cidrs("10.1.0.0/16", "198.51.100.0/24")
+
+	assert.True(t, peerAllowed(deny, nil, net.ParseIP("192.0.2.1")), "no allow-list allows everything not denied")
+	assert.False(t, peerAllowed(deny, nil, net.ParseIP("10.1.2.3")))
+
+	assert.True(t, peerAllowed(deny, allow, net.ParseIP("198.51.100.7")))
+	assert.False(t, peerAllowed(deny, allow, net.ParseIP("192.0.2.1")), "peers outside the allow-list are denied")
+	assert.False(t, peerAllowed(deny, allow, net.ParseIP("10.1.2.3")), "the deny-list takes precedence")
+	assert.False(t, peerAllowed(deny, allow, net.ParseIP("fe80::1")))
+}
+
+func TestRelayIP(t *testing.T) {
+	v4 := net.ParseIP("192.0.2.1")
+	v6 := net.ParseIP("2001:db8::1")
+
+	for name, tc := range map[string]struct {
+		v4, v6   net.IP
+		preferV4 bool
+		expected net.IP
+	}{
+		"prefers v4":                {v4, v6, true, v4},
+		"prefers v6":                {v4, v6, false, v6},
+		"private v4 is usable":      {net.ParseIP("192.168.178.2"), nil, true, net.ParseIP("192.168.178.2")},
+		"link-local v6 falls back":  {v4, net.ParseIP("fe80::1"), false, v4},
+		"ULA v6 falls back":         {v4, net.ParseIP("fd12:3456::1"), false, v4},
+		"link-local v4 falls back":  {net.ParseIP("169.254.1.1"), v6, true, v6},
+		"unspecified v4 falls back": {net.IPv4zero, v6, true, v6},
+		"only v6 is configured":     {nil, v6, true, v6},
+		"loopback v4 is usable":     {net.ParseIP("127.0.0.1"), nil, true, net.ParseIP("127.0.0.1")},
+		"loopback v6 falls back":    {v4, net.IPv6loopback, false, v4},
+		"only ULA v6 is usable":     {net.ParseIP("169.254.1.1"), net.ParseIP("fc00::1"), true, net.ParseIP("fc00::1")},
+	} {
+		ip, err := relayIP(tc.v4, tc.v6, tc.preferV4)
+		assert.NoError(t, err, name)
+		assert.Equal(t, tc.expected, ip, name)
+	}
+
+	_, err := relayIP(net.ParseIP("169.254.1.1"), net.ParseIP("fe80::1"), true)
+	assert.Error(t, err, "neither address is routable")
+	_, err = relayIP(nil, net.ParseIP("fe80::1"), false)
+	assert.Error(t, err)
+}
+
+func TestGenerator_skipsUnroutableRelayAddress(t *testing.T) {
+	gen := &Generator{
+		RelayAddressGenerator: &RelayAddressGeneratorNone{},
+		IPProvider:            &ipdns.Static{V4: net.ParseIP("192.0.2.1"), V6: net.ParseIP("fe80::1")},
+	}
+	conn, addr, err := gen.AllocatePacketConn("udp", 0)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "192.0.2.1", addr.(*net.UDPAddr).IP.String())
+
+	gen.IPProvider = &ipdns.Static{V6: net.ParseIP("fe80::1")}
+	_, _, err = gen.AllocatePacketConn("udp", 0)
+	assert.Error(t, err)
+}
+
+func TestAllocationLog(t *testing.T) {
+	assert.Nil(t, newAllocationLog("off", 1).event())
+
+	sampled := newAllocationLog("info", 3)
+	logged := 0
+	for i := 0; i < 9; i++ {
+		if sampled.event() != nil {
+			logged++
+		}
+	}
+	assert.Equal(t, 3, logged)
+}
+
+func TestAuthenticate_logsUsername(t *testing.T) {
+	buf := &bytes.Buffer{}
+	previous := log.Logger
+	log.Logger = zerolog.New(buf)
+	defer func() { log.Logger = previous }()
+
+	svr := &InternalServer{lookup: map[string]Entry{}, authLog: newAllocationLog("info", 1)}
+	username, _ := svr.Credentials("session1host", net.IPv4(127, 0, 0, 1))
+	_, ok := svr.authenticate(username, Realm, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000})
+	assert.True(t, ok)
+	assert.Contains(t, buf.String(), `"username":"session1host"`)
+	assert.Contains(t, buf.String(), `"addr":"192.0.2.1:5000"`)
+
+	buf.Reset()
+	svr.authLog = newAllocationLog("off", 1)
+	_, ok = svr.authenticate(username, Realm, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000})
+	assert.True(t, ok)
+	assert.Empty(t, buf.String())
+}
+
+func TestDisallow_countsOnlyRevocableCredentials(t *testing.T) {
+	svr := &InternalServer{lookup: map[string]Entry{}}
+	username, _ := svr.Credentials("session1host", net.IPv4(127, 0, 0, 1))
+
+	before := testutil.ToFloat64(turnCredentialsRevokedTotal)
+	svr.Disallow(username)
+	assert.Equal(t, before+1, testutil.ToFloat64(turnCredentialsRevokedTotal))
+
+	external := &ExternalServer{secret: []byte("0123456789abcdef"), ttl: time.Hour}
+	username, _ = external.Credentials("session2host", net.IPv4(127, 0, 0, 1))
+	external.Disallow(username)
+	assert.Equal(t, before+1, testutil.ToFloat64(turnCredentialsRevokedTotal), "external credentials can't be revoked")
+}
@@ -1,10 +1,14 @@
 package ui
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"io"
 	"io/fs"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
@@ -14,11 +18,12 @@ import (
 var buildFiles embed.FS
 var files, _ = fs.Sub(buildFiles, "build")
 
-// Register registers the ui on the root path.
-func Register(r *mux.Router) {
+// Register registers the ui on the root path of r, which is mounted under
+// basePath.
+func Register(r *mux.Router, basePath string) {
 	r.Handle("/", serveFile("index.html", "text/html"))
 	r.Handle("/index.html", serveFile("index.html", "text/html"))
-	r.Handle("/assets/{resource}", http.FileServer(http.FS(files)))
+	r.Handle("/assets/{resource}", immutable(http.StripPrefix(basePath, http.FileServer(http.FS(files)))))
 
 	r.Handle("/favicon.ico", serveFile("favicon.ico", "image/x-icon"))
 	r.Handle("/logo.svg", serveFile("logo.svg", "image/svg+xml"))
@@ -37,8 +42,27 @@ func serveFile(name, contentType string) http.HandlerFunc {
 		log.Panic().Err(err).Msgf("could not read %s", file)
 	}
 
-	return func(writer http.ResponseWriter, reg *http.Request) {
+	sum := sha256.Sum256(content)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	return func(writer http.ResponseWriter, req *http.Request) {
 		writer.Header().Set("Content-Type", contentType)
-		_, _ = writer.Write(content)
+		// The files aren't fingerprinted, browsers must revalidate them with
+		// the ETag, which results in an empty 304 response if unchanged.
+		writer.Header().Set("Cache-Control", "no-cache")
+		writer.Header().Set("ETag", etag)
+		http.ServeContent(writer, req, name, time.Time{}, bytes.NewReader(content))
 	}
 }
+
+// immutable marks the response as cacheable forever. The assets built by vite
+// contain a content hash in their file name, so a changed asset has a new url.
+func immutable(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		// missing assets must not be cached, they may exist after an update
+		if _, err := fs.Stat(files, "assets/"+mux.Vars(req)["resource"]); err == nil {
+			writer.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		handler.ServeHTTP(writer, req)
+	})
+}
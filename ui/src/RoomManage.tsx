@@ -73,7 +73,8 @@ const CreateRoom = ({room, config}: Pick<UseRoom, 'room'> & {config: UIConfig})
 export const RoomManage = ({room, config}: {room: FCreateRoom; config: UseConfig}) => {
     const [showLogin, setShowLogin] = React.useState(false);
 
-    const canCreateRoom = config.authMode !== 'all';
+    const canCreateRoom =
+        config.authMode !== 'all' && config.authMode !== 'http' && config.authMode !== 'proxy';
     const loginVisible = !config.loggedIn && (showLogin || !canCreateRoom);
 
     return (
@@ -6,12 +6,15 @@ export enum ShareMode {
 type Typed<Base, Type extends string> = {type: Type; payload: Base};
 
 export interface UIConfig {
-    authMode: 'turn' | 'none' | 'all';
+    authMode: 'turn' | 'none' | 'all' | 'http' | 'proxy';
     user: string;
     loggedIn: boolean;
     version: string;
     roomName: string;
     closeRoomWhenOwnerLeaves: boolean;
+    requireUserName: boolean;
+    eventTypes: string[];
+    basePath: string;
 }
 
 export interface RoomConfiguration {
@@ -19,6 +22,9 @@ export interface RoomConfiguration {
     closeOnOwnerLeave?: boolean;
     mode: RoomMode;
     username?: string;
+    roomDelta?: boolean;
+    watchOnDemand?: boolean;
+    welcome?: string;
 }
 
 export enum RoomMode {
@@ -31,6 +37,8 @@ export interface JoinConfiguration {
     id: string;
     password?: string;
     username?: string;
+    roomDelta?: boolean;
+    watchOnDemand?: boolean;
 }
 
 export interface StringMessage {
@@ -47,12 +55,15 @@ export interface ICEServer {
     urls: string[];
     credential: string;
     username: string;
+    ttl?: number;
 }
 
 export interface RoomInfo {
     id: string;
     share: ShareMode;
     mode: RoomMode;
+    locked: boolean;
+    recording: boolean;
     users: RoomUser[];
 }
 
@@ -60,29 +71,85 @@ export interface RoomUser {
     id: string;
     name: string;
     streaming: boolean;
+    paused: boolean;
     you: boolean;
     owner: boolean;
 }
 
+export interface RoomDeltaInfo {
+    id: string;
+    locked: boolean;
+    recording: boolean;
+    added?: RoomUser[];
+    changed?: RoomUser[];
+    removed?: string[];
+}
+
 export interface P2PMessage<T> {
     sid: string;
     value: T;
+    ackId?: string;
 }
 
 export type Room = Typed<RoomInfo, 'room'>;
+export type RoomDelta = Typed<RoomDeltaInfo, 'roomdelta'>;
 export type Error = Typed<StringMessage, 'Error'>;
 export type HostSession = Typed<P2PSession, 'hostsession'>;
 export type Name = Typed<{username: string}, 'name'>;
 export type ClientSession = Typed<P2PSession, 'clientsession'>;
 export type HostICECandidate = Typed<P2PMessage<RTCIceCandidate>, 'hostice'>;
 export type ClientICECandidate = Typed<P2PMessage<RTCIceCandidate>, 'clientice'>;
+export type HostICEEnd = Typed<{sid: string}, 'hosticeend'>;
+export type ClientICEEnd = Typed<{sid: string}, 'clienticeend'>;
 export type HostOffer = Typed<P2PMessage<RTCSessionDescriptionInit>, 'hostoffer'>;
 export type ClientAnswer = Typed<P2PMessage<RTCSessionDescriptionInit>, 'clientanswer'>;
+export type DataChannelOffer = Typed<P2PMessage<RTCSessionDescriptionInit>, 'datachannel-offer'>;
+export type DataChannelAnswer = Typed<P2PMessage<RTCSessionDescriptionInit>, 'datachannel-answer'>;
 export type StartSharing = Typed<{}, 'share'>;
 export type StopShare = Typed<{}, 'stopshare'>;
 export type RoomCreate = Typed<RoomConfiguration & {joinIfExist?: boolean}, 'create'>;
 export type JoinRoom = Typed<JoinConfiguration, 'join'>;
 export type EndShare = Typed<string, 'endshare'>;
+export type StreamPaused = Typed<string, 'streampaused'>;
+export type StreamResumed = Typed<string, 'streamresumed'>;
+export type PauseStream = Typed<{}, 'pausestream'>;
+export type ResumeStream = Typed<{}, 'resumestream'>;
+export type Watch = Typed<{id: string}, 'watch'>;
+export type Unwatch = Typed<{id: string}, 'unwatch'>;
+export type StartRecording = Typed<{}, 'startrecording'>;
+export type StopRecording = Typed<{}, 'stoprecording'>;
+export type Recording = Typed<{recording: boolean}, 'recording'>;
+export type Welcome = Typed<{message: string}, 'welcome'>;
+export type ResumeToken = Typed<{token: string; graceMillis: number}, 'resumetoken'>;
+export type MySessionsRequest = Typed<{}, 'mysessions'>;
+export type MySessions = Typed<
+    {sessions: {id: string; peer: string; role: 'host' | 'client'}[]},
+    'mysessions'
+>;
+export type RefreshICE = Typed<{sid: string}, 'refreshice'>;
+export type ICERestart = Typed<
+    {id: string; iceServers: ICEServer[]; initiate: boolean},
+    'icerestart'
+>;
+export type Drain = Typed<{graceMillis: number}, 'drain'>;
+export type Ack = Typed<{sid: string; ackId: string; delivered?: boolean}, 'ack'>;
+export type SessionStats = Typed<
+    {
+        sid: string;
+        stats: {
+            bitrate: number;
+            packetLoss: number;
+            rtt: number;
+            candidateType: string;
+            bytesSent?: number;
+            bytesReceived?: number;
+        };
+    },
+    'sessionstats'
+>;
+export type SessionRejected = Typed<{peer: string; reason: string}, 'sessionrejected'>;
+export type Lock = Typed<{}, 'lock'>;
+export type Unlock = Typed<{}, 'unlock'>;
 
 export type IncomingMessage =
     | Room
@@ -93,7 +160,11 @@ export type IncomingMessage =
     | ClientICECandidate
     | HostOffer
     | EndShare
-    | ClientAnswer;
+    | ClientAnswer
+    | HostICEEnd
+    | ClientICEEnd
+    | ICERestart
+    | Welcome;
 
 export type OutgoingMessage =
     | RoomCreate
@@ -104,4 +175,10 @@ export type OutgoingMessage =
     | HostOffer
     | StopShare
     | ClientAnswer
-    | StartSharing;
+    | StartSharing
+    | HostICEEnd
+    | ClientICEEnd
+    | RefreshICE
+    | MySessionsRequest
+    | Lock
+    | Unlock;
@@ -3,3 +3,5 @@ const slashes = protocol.concat('//');
 const path = pathname.endsWith('/') ? pathname : pathname.substring(0, pathname.lastIndexOf('/'));
 const url = slashes.concat(port ? hostname.concat(':', port) : hostname) + path;
 export const urlWithSlash = url.endsWith('/') ? url : url.concat('/');
+export const wsUrl = (basePath: string): string =>
+    slashes.replace('http', 'ws').concat(port ? hostname.concat(':', port) : hostname) + basePath;
@@ -20,6 +20,9 @@ export const useConfig = (): UseConfig => {
         version: 'unknown',
         roomName: 'unknown',
         closeRoomWhenOwnerLeaves: true,
+        requireUserName: false,
+        eventTypes: [],
+        basePath: '/',
     });
 
     const refetch = React.useCallback(async () => {
@@ -64,6 +67,8 @@ export const authModeToRoomMode = (authMode: UIConfig['authMode'], loggedIn: boo
     }
     switch (authMode) {
         case 'all':
+        case 'http':
+        case 'proxy':
             return RoomMode.Turn;
         case 'turn':
             return RoomMode.Turn;
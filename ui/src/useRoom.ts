@@ -11,7 +11,7 @@ import {
     UIConfig,
 } from './message';
 import {loadSettings, resolveCodecPlaceholder} from './settings';
-import {urlWithSlash} from './url';
+import {wsUrl} from './url';
 import {authModeToRoomMode} from './useConfig';
 import {getFromURL, useRoomID} from './useRoomID';
 
@@ -39,6 +39,22 @@ export interface UseRoom {
 const relayConfig: Partial<RTCConfiguration> =
     window.location.search.indexOf('forceTurn=true') !== -1 ? {iceTransportPolicy: 'relay'} : {};
 
+// compressionHint asks for the smallest WebSocket messages when the browser
+// signals that the user wants to save data, e.g. on metered connections.
+const compressionHint = (): string =>
+    (navigator as Navigator & {connection?: {saveData?: boolean}}).connection?.saveData
+        ? '?compression=size'
+        : '';
+
+// scheduleRefresh requests new TURN credentials before the shortest credential
+// lifetime of the ice servers ends. Credentials without a ttl don't expire.
+const scheduleRefresh = (ice: ICEServer[], refresh: () => void) => {
+    const ttl = Math.min(...ice.map((server) => server.ttl || Infinity));
+    if (ttl !== Infinity) {
+        setTimeout(refresh, ttl * 800);
+    }
+};
+
 const hostSession = async ({
     sid,
     ice,
@@ -55,6 +71,7 @@ const hostSession = async ({
     const peer = new RTCPeerConnection({...relayConfig, iceServers: ice});
     peer.onicecandidate = (event) => {
         if (!event.candidate) {
+            send({type: 'hosticeend', payload: {sid: sid}});
             return;
         }
         send({type: 'hostice', payload: {sid: sid, value: event.candidate}});
@@ -128,6 +145,7 @@ const clientSession = async ({
     const peer = new RTCPeerConnection({...relayConfig, iceServers: ice});
     peer.onicecandidate = (event) => {
         if (!event.candidate) {
+            send({type: 'clienticeend', payload: {sid: sid}});
             return;
         }
         send({type: 'clientice', payload: {sid: sid, value: event.candidate}});
@@ -168,7 +186,7 @@ export const useRoom = (config: UIConfig): UseRoom => {
         (create) => {
             return new Promise<void>((resolve) => {
                 const ws = (conn.current = new WebSocket(
-                    urlWithSlash.replace('http', 'ws') + 'stream'
+                    wsUrl(config.basePath) + 'stream' + compressionHint()
                 ));
                 const send = (message: OutgoingMessage) => {
                     if (ws.readyState === ws.OPEN) ws.send(JSON.stringify(message));
@@ -196,10 +214,20 @@ export const useRoom = (config: UIConfig): UseRoom => {
                                 current ? {...current, ...event.payload} : current
                             );
                             return;
-                        case 'hostsession':
+                        case 'hostsession': {
+                            const {id, iceServers} = event.payload;
+                            const refresh = () =>
+                                host.current[id] &&
+                                send({type: 'refreshice', payload: {sid: id}});
+                            if (host.current[id]) {
+                                host.current[id].setConfiguration({...relayConfig, iceServers});
+                                scheduleRefresh(iceServers, refresh);
+                                return;
+                            }
                             if (!stream.current) {
                                 return;
                             }
+                            scheduleRefresh(iceServers, refresh);
                             hostSession({
                                 sid: event.payload.id,
                                 stream: stream.current!,
@@ -210,8 +238,20 @@ export const useRoom = (config: UIConfig): UseRoom => {
                                 host.current[event.payload.id] = peer;
                             });
                             return;
+                        }
                         case 'clientsession':
                             const {id: sid, peer} = event.payload;
+                            const refreshClient = () =>
+                                client.current[sid] &&
+                                send({type: 'refreshice', payload: {sid}});
+                            scheduleRefresh(event.payload.iceServers, refreshClient);
+                            if (client.current[sid]) {
+                                client.current[sid].setConfiguration({
+                                    ...relayConfig,
+                                    iceServers: event.payload.iceServers,
+                                });
+                                return;
+                            }
                             clientSession({
                                 sid,
                                 send,
@@ -250,11 +290,28 @@ export const useRoom = (config: UIConfig): UseRoom => {
                         case 'clientice':
                             host.current[event.payload.sid]?.addIceCandidate(event.payload.value);
                             return;
+                        case 'clienticeend':
+                            host.current[event.payload.sid]?.addIceCandidate();
+                            return;
                         case 'clientanswer':
                             host.current[event.payload.sid]?.setRemoteDescription(
                                 event.payload.value
                             );
                             return;
+                        case 'icerestart':
+                            (async () => {
+                                const {id, iceServers, initiate} = event.payload;
+                                const hostPeer = host.current[id];
+                                const peer = hostPeer ?? client.current[id];
+                                peer?.setConfiguration({...relayConfig, iceServers});
+                                if (!initiate || !hostPeer) {
+                                    return;
+                                }
+                                const offer = await hostPeer.createOffer({iceRestart: true});
+                                await hostPeer.setLocalDescription(offer);
+                                send({type: 'hostoffer', payload: {value: offer, sid: id}});
+                            })();
+                            return;
                         case 'hostoffer':
                             (async () => {
                                 await client.current[event.payload.sid]?.setRemoteDescription(
@@ -274,6 +331,12 @@ export const useRoom = (config: UIConfig): UseRoom => {
                         case 'hostice':
                             client.current[event.payload.sid]?.addIceCandidate(event.payload.value);
                             return;
+                        case 'hosticeend':
+                            client.current[event.payload.sid]?.addIceCandidate();
+                            return;
+                        case 'welcome':
+                            enqueueSnackbar(event.payload.message, {variant: 'info'});
+                            return;
                         case 'endshare':
                             client.current[event.payload]?.close();
                             host.current[event.payload]?.close();
@@ -311,7 +374,7 @@ export const useRoom = (config: UIConfig): UseRoom => {
                 };
             });
         },
-        [setState, enqueueSnackbar, setRoomID]
+        [setState, enqueueSnackbar, setRoomID, config.basePath]
     );
 
     const share = async () => {
@@ -0,0 +1,38 @@
+package util
+
+import (
+	"net"
+	"sync"
+)
+
+// activatedFiles are the sockets passed by systemd socket activation. They are
+// only read once, as the activation environment is cleared afterwards.
+var activatedFiles = sync.OnceValue(activationFiles)
+
+// ActivatedListener returns the stream socket passed by systemd socket
+// activation with the FileDescriptorName name, or nil if there is none.
+func ActivatedListener(name string) net.Listener {
+	for _, f := range activatedFiles() {
+		if f.Name() != name {
+			continue
+		}
+		if l, err := net.FileListener(f); err == nil {
+			return l
+		}
+	}
+	return nil
+}
+
+// ActivatedPacketConn returns the datagram socket passed by systemd socket
+// activation with the FileDescriptorName name, or nil if there is none.
+func ActivatedPacketConn(name string) net.PacketConn {
+	for _, f := range activatedFiles() {
+		if f.Name() != name {
+			continue
+		}
+		if conn, err := net.FilePacketConn(f); err == nil {
+			return conn
+		}
+	}
+	return nil
+}
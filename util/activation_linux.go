@@ -0,0 +1,56 @@
+package util
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd.
+const listenFdsStart = 3
+
+// activationFiles parses the systemd socket activation environment, see
+// sd_listen_fds(3).
+func activationFiles() []*os.File {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	names := listenFds(os.Getpid())
+	if len(names) == 0 {
+		return nil
+	}
+	files := make([]*os.File, 0, len(names))
+	for i, name := range names {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+		files = append(files, os.NewFile(uintptr(fd), name))
+	}
+	return files
+}
+
+// listenFds returns the names of the file descriptors passed to the process
+// pid, one per descriptor and "unknown" if it has no name. It returns nil if
+// the environment is invalid or meant for another process.
+func listenFds(pid int) []string {
+	if listenPid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || listenPid != pid {
+		return nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	result := make([]string, count)
+	for i := range result {
+		result[i] = "unknown"
+		if i < len(names) && names[i] != "" {
+			result[i] = names[i]
+		}
+	}
+	return result
+}
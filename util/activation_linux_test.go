@@ -0,0 +1,55 @@
+package util
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenFds(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	other := strconv.Itoa(os.Getpid() + 1)
+
+	for name, tc := range map[string]struct {
+		pid, fds, names string
+		expected        []string
+	}{
+		"named":         {pid, "2", "http:turn", []string{"http", "turn"}},
+		"unnamed":       {pid, "2", "", []string{"unknown", "unknown"}},
+		"fewer names":   {pid, "3", "http::turn", []string{"http", "unknown", "turn"}},
+		"more names":    {pid, "1", "http:turn", []string{"http"}},
+		"other process": {other, "2", "http:turn", nil},
+		"invalid pid":   {"abc", "2", "http:turn", nil},
+		"missing pid":   {"", "2", "http:turn", nil},
+		"no fds":        {pid, "0", "", nil},
+		"negative fds":  {pid, "-1", "", nil},
+		"invalid fds":   {pid, "two", "http:turn", nil},
+		"missing fds":   {pid, "", "http", nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tc.pid)
+			t.Setenv("LISTEN_FDS", tc.fds)
+			t.Setenv("LISTEN_FDNAMES", tc.names)
+			assert.Equal(t, tc.expected, listenFds(os.Getpid()))
+		})
+	}
+}
+
+func TestActivationFiles_otherProcess(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "http")
+
+	assert.Nil(t, activationFiles())
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_, ok := os.LookupEnv(key)
+		assert.False(t, ok, "%s is cleared so child processes don't inherit it", key)
+	}
+}
+
+func TestActivated_fallsBackWithoutActivation(t *testing.T) {
+	assert.Nil(t, ActivatedListener("http"), "the caller listens normally")
+	assert.Nil(t, ActivatedPacketConn("turn"))
+}
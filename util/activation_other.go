@@ -0,0 +1,10 @@
+//go:build !linux
+
+package util
+
+import "os"
+
+// activationFiles is a no-op, socket activation is only supported on linux.
+func activationFiles() []*os.File {
+	return nil
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Blocklist matches names that contain a blocked word. Matching is case
+// insensitive and also finds words inside other words. A nil or empty
+// Blocklist blocks nothing.
+type Blocklist struct {
+	matcher *regexp.Regexp
+}
+
+// NewBlocklist compiles the words into a single matcher.
+func NewBlocklist(words []string) *Blocklist {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return &Blocklist{}
+	}
+	return &Blocklist{matcher: regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))}
+}
+
+// ReadBlocklist creates a Blocklist from the words and the words in the file,
+// one per line. Empty lines and lines starting with # are ignored. An empty
+// path only uses the given words.
+func ReadBlocklist(path string, words []string) (*Blocklist, error) {
+	all := append([]string{}, words...)
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			all = append(all, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return NewBlocklist(all), nil
+}
+
+// Blocked returns whether the name contains a blocked word.
+func (b *Blocklist) Blocked(name string) bool {
+	return b != nil && b.matcher != nil && b.matcher.MatchString(name)
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocklist(t *testing.T) {
+	var empty *Blocklist
+	assert.False(t, empty.Blocked("anything"))
+	assert.False(t, NewBlocklist(nil).Blocked("anything"))
+	assert.False(t, NewBlocklist([]string{" ", ""}).Blocked("anything"))
+
+	list := NewBlocklist([]string{"bad", "w.rd"})
+	assert.True(t, list.Blocked("Bad Otter"))
+	assert.True(t, list.Blocked("very-badger"))
+	assert.True(t, list.Blocked("a w.rd"))
+	assert.False(t, list.Blocked("a word"), "words are matched literally")
+	assert.False(t, list.Blocked("Brave Otter"))
+}
+
+func TestReadBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocked.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\n\nugly\n  rude  \n"), 0o600))
+
+	list, err := ReadBlocklist(path, []string{"bad"})
+	require.NoError(t, err)
+	assert.True(t, list.Blocked("Ugly Duck"))
+	assert.True(t, list.Blocked("rude-red-fox"))
+	assert.True(t, list.Blocked("bad"))
+	assert.False(t, list.Blocked("comment"))
+
+	_, err = ReadBlocklist(filepath.Join(t.TempDir(), "missing"), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIP resolves ip addresses to countries with a MaxMind DB (mmdb) file, e.g.
+// GeoLite2-Country or GeoIP2-City. It is safe for concurrent use.
+type GeoIP struct {
+	reader *maxminddb.Reader
+}
+
+// geoIPRecord contains the fields of a country or city record that are used.
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// ReadGeoIP loads the MaxMind DB at path.
+func ReadGeoIP(path string) (*GeoIP, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: %w", err)
+	}
+	return &GeoIP{reader: reader}, nil
+}
+
+// NewGeoIP parses a MaxMind DB.
+func NewGeoIP(content []byte) (*GeoIP, error) {
+	reader, err := maxminddb.FromBytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: %w", err)
+	}
+	return &GeoIP{reader: reader}, nil
+}
+
+// Country returns the ISO 3166-1 country code of ip, or "" if it is unknown.
+// The registered country is used if the database contains no location.
+func (g *GeoIP) Country(ip net.IP) string {
+	if g == nil || ip == nil {
+		return ""
+	}
+	var record geoIPRecord
+	if err := g.reader.Lookup(ip, &record); err != nil {
+		return ""
+	}
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode
+	}
+	return record.RegisteredCountry.ISOCode
+}
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// metadataMarker precedes the metadata at the end of a MaxMind DB file.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+func mmdbString(s string) []byte {
+	return append([]byte{2<<5 | byte(len(s))}, s...)
+}
+
+func mmdbUint16(v uint16) []byte {
+	return []byte{5<<5 | 2, byte(v >> 8), byte(v)}
+}
+
+func mmdbMap(pairs ...[]byte) []byte {
+	result := []byte{7<<5 | byte(len(pairs)/2)}
+	for _, pair := range pairs {
+		result = append(result, pair...)
+	}
+	return result
+}
+
+// testGeoIP creates an IPv4 database with 24 bit records and two nodes:
+// 0.0.0.0/1 is in DE, 128.0.0.0/2 only has a registered country (US) and
+// 192.0.0.0/2 is unknown.
+func testGeoIP(t *testing.T) *GeoIP {
+	de := mmdbMap(mmdbString("country"), mmdbMap(mmdbString("iso_code"), mmdbString("DE")))
+	us := mmdbMap(mmdbString("registered_country"), mmdbMap(mmdbString("iso_code"), mmdbString("US")))
+	data := append(append([]byte{}, de...), us...)
+
+	const nodes = 2
+	record := func(v int) []byte { return []byte{byte(v >> 16), byte(v >> 8), byte(v)} }
+	var content []byte
+	content = append(content, record(nodes+16)...)         // node 0, bit 0: DE
+	content = append(content, record(1)...)                // node 0, bit 1: node 1
+	content = append(content, record(nodes+16+len(de))...) // node 1, bit 0: US
+	content = append(content, record(nodes)...)            // node 1, bit 1: not found
+	content = append(content, make([]byte, 16)...)
+	content = append(content, data...)
+	content = append(content, metadataMarker...)
+	content = append(content, mmdbMap(
+		mmdbString("node_count"), mmdbUint16(nodes),
+		mmdbString("record_size"), mmdbUint16(24),
+		mmdbString("ip_version"), mmdbUint16(4),
+	)...)
+
+	db, err := NewGeoIP(content)
+	require.NoError(t, err)
+	return db
+}
+
+func TestGeoIP_Country(t *testing.T) {
+	db := testGeoIP(t)
+	assert.Equal(t, "DE", db.Country(net.ParseIP("10.0.0.1")))
+	assert.Equal(t, "DE", db.Country(net.ParseIP("::ffff:10.0.0.1")))
+	assert.Equal(t, "US", db.Country(net.ParseIP("150.0.0.1")), "falls back to the registered country")
+	assert.Equal(t, "", db.Country(net.ParseIP("200.0.0.1")))
+	assert.Equal(t, "", db.Country(net.ParseIP("2001:db8::1")), "IPv4 databases have no IPv6 addresses")
+	assert.Equal(t, "", db.Country(nil))
+
+	var disabled *GeoIP
+	assert.Equal(t, "", disabled.Country(net.ParseIP("10.0.0.1")))
+}
+
+func TestNewGeoIP_invalid(t *testing.T) {
+	_, err := NewGeoIP([]byte("not a database"))
+	assert.Error(t, err)
+
+	_, err = NewGeoIP(append(append([]byte{}, metadataMarker...), mmdbMap(
+		mmdbString("node_count"), mmdbUint16(1000),
+		mmdbString("record_size"), mmdbUint16(24),
+		mmdbString("ip_version"), mmdbUint16(4),
+	)...))
+	assert.Error(t, err, "the search tree exceeds the file")
+}
@@ -0,0 +1,167 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyHeaderTimeout is the time a trusted upstream has to send the PROXY
+// protocol header after the connection was accepted.
+var ProxyHeaderTimeout = 5 * time.Second
+
+// ProxyListener wraps listener so that connections from trusted upstreams must
+// start with a PROXY protocol v2 header. The client address from the header
+// replaces the remote address of the connection. Connections from other
+// addresses are passed through unchanged, so clients cannot spoof their
+// address. Connections over unix sockets are always trusted.
+//
+// The header is read on the first Read or RemoteAddr call, so a slow upstream
+// does not block Accept.
+func ProxyListener(listener net.Listener, trusted []*net.IPNet) net.Listener {
+	return &proxyListener{Listener: listener, trusted: trusted}
+}
+
+type proxyListener struct {
+	net.Listener
+	trusted []*net.IPNet
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn}, nil
+}
+
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	for _, cidr := range l.trusted {
+		if cidr.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+type proxyConn struct {
+	net.Conn
+	once   sync.Once
+	remote net.Addr
+	err    error
+
+	deadlineLock sync.Mutex
+	readDeadline time.Time
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.deadlineLock.Lock()
+		restore := c.readDeadline
+		c.deadlineLock.Unlock()
+
+		if err := c.Conn.SetReadDeadline(time.Now().Add(ProxyHeaderTimeout)); err != nil {
+			c.err = err
+			return
+		}
+		c.remote, c.err = readProxyHeader(c.Conn)
+		if err := c.Conn.SetReadDeadline(restore); err != nil && c.err == nil {
+			c.err = err
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	c.readDeadline = t
+	c.deadlineLock.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	c.readDeadline = t
+	c.deadlineLock.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// readProxyHeader reads a PROXY protocol v2 header from r and returns the
+// client address. The address is nil for LOCAL connections, e.g. health checks
+// of the load balancer, and for address families other than IPv4 and IPv6.
+func readProxyHeader(r io.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("proxy protocol: could not read header: %w", err)
+	}
+	if !bytes.Equal(header[:12], proxyV2Signature) {
+		return nil, errors.New("proxy protocol: missing v2 header")
+	}
+	if version := header[12] >> 4; version != 2 {
+		return nil, fmt.Errorf("proxy protocol: unsupported version %d", version)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("proxy protocol: could not read addresses: %w", err)
+	}
+
+	switch command := header[12] & 0x0f; command {
+	case 0x0:
+		return nil, nil
+	case 0x1:
+	default:
+		return nil, fmt.Errorf("proxy protocol: unsupported command %d", command)
+	}
+
+	switch family := header[13] >> 4; family {
+	case 0x1:
+		if len(payload) < 12 {
+			return nil, errors.New("proxy protocol: IPv4 addresses too short")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:4]).To16(),
+			Port: int(binary.BigEndian.Uint16(payload[8:10])),
+		}, nil
+	case 0x2:
+		if len(payload) < 36 {
+			return nil, errors.New("proxy protocol: IPv6 addresses too short")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:16]),
+			Port: int(binary.BigEndian.Uint16(payload[32:34])),
+		}, nil
+	default:
+		return nil, nil
+	}
+}
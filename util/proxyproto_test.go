@@ -0,0 +1,82 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func proxyHeader(command, family byte, addresses []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	ipv4 := []byte{203, 0, 113, 7, 10, 0, 0, 1, 0x1f, 0x90, 0x13, 0xba}
+	addr, err := readProxyHeader(bytes.NewReader(proxyHeader(0x1, 0x11, ipv4)))
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.7:8080", addr.String())
+
+	ipv6 := make([]byte, 36)
+	copy(ipv6, net.ParseIP("2001:db8::1"))
+	binary.BigEndian.PutUint16(ipv6[32:], 443)
+	addr, err = readProxyHeader(bytes.NewReader(proxyHeader(0x1, 0x21, ipv6)))
+	require.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:443", addr.String())
+
+	addr, err = readProxyHeader(bytes.NewReader(proxyHeader(0x0, 0x00, nil)))
+	require.NoError(t, err)
+	assert.Nil(t, addr, "LOCAL keeps the connection address")
+
+	_, err = readProxyHeader(bytes.NewReader([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n")))
+	assert.Error(t, err)
+	_, err = readProxyHeader(bytes.NewReader(proxyHeader(0x1, 0x11, ipv4[:4])))
+	assert.Error(t, err)
+	_, err = readProxyHeader(bytes.NewReader(proxyHeader(0x1, 0x11, ipv4)[:20]))
+	assert.Error(t, err)
+}
+
+func TestProxyListener(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, other, _ := net.ParseCIDR("192.0.2.0/24")
+
+	accept := func(trusted *net.IPNet, payload []byte) (net.Addr, []byte, error) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		listener = ProxyListener(listener, []*net.IPNet{trusted})
+
+		client, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		_, err = client.Write(payload)
+		require.NoError(t, err)
+		client.Close()
+
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+		body, err := io.ReadAll(conn)
+		return conn.RemoteAddr(), body, err
+	}
+
+	ipv4 := []byte{203, 0, 113, 7, 10, 0, 0, 1, 0x1f, 0x90, 0x13, 0xba}
+	addr, body, err := accept(loopback, append(proxyHeader(0x1, 0x11, ipv4), "hello"...))
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.7:8080", addr.String())
+	assert.Equal(t, "hello", string(body))
+
+	addr, body, err = accept(other, []byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", addr.(*net.TCPAddr).IP.String(), "untrusted connections are passed through")
+	assert.Equal(t, "hello", string(body))
+
+	_, _, err = accept(loopback, []byte("hello"))
+	assert.Error(t, err, "trusted upstreams must send the header")
+}
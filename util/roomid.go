@@ -0,0 +1,33 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxRoomIDLength is the maximum number of characters of a room id.
+const MaxRoomIDLength = 64
+
+// ValidateRoomID checks that id only contains letters, digits, '-', '_' and
+// '.', so it can be used in urls and logs without escaping.
+func ValidateRoomID(id string) error {
+	if id == "" {
+		return errors.New("id must be set")
+	}
+	if utf8.RuneCountInString(id) > MaxRoomIDLength {
+		return fmt.Errorf("id must not be longer than %d characters", MaxRoomIDLength)
+	}
+	for _, c := range id {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("-_.", c) {
+			return fmt.Errorf("id contains the invalid character %q", c)
+		}
+	}
+	// "." and ".." are path segments
+	if strings.Trim(id, ".") == "" {
+		return errors.New("id must not only contain dots")
+	}
+	return nil
+}
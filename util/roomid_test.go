@@ -0,0 +1,41 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRoomID(t *testing.T) {
+	for _, id := range []string{
+		"standup",
+		"nice-blue-lion",
+		"Team_42.daily",
+		"grün",
+		strings.Repeat("a", MaxRoomIDLength),
+		strings.Repeat("ü", MaxRoomIDLength),
+	} {
+		assert.NoError(t, ValidateRoomID(id), id)
+	}
+
+	for _, id := range []string{
+		"",
+		strings.Repeat("a", MaxRoomIDLength+1),
+		"two words",
+		"a/b",
+		"../admin",
+		".",
+		"..",
+		"room?x=1",
+		"room#top",
+		"<script>",
+		"line\nbreak",
+		"null\x00byte",
+		"tab\tstop",
+		"invalid\xffutf8",
+		"\u202eevil",
+	} {
+		assert.Error(t, ValidateRoomID(id), "%q", id)
+	}
+}
@@ -40,15 +40,57 @@ var colors = []string{
 	"white", "yellow",
 }
 
-func r(r *rand.Rand, l []string) string {
-	return l[r.Intn(len(l)-1)]
+// Names contains the word lists used to generate user and room names.
+type Names struct {
+	Adjectives *WordList
+	Colors     *WordList
+	Nouns      *WordList
 }
 
-func NewUserName(s *rand.Rand) string {
+// DefaultNames returns the built-in word lists.
+func DefaultNames() Names {
+	return Names{
+		Adjectives: NewWordList(adjectives),
+		Colors:     NewWordList(colors),
+		Nouns:      NewWordList(animals),
+	}
+}
+
+// ReadNames returns the built-in word lists, replacing the adjectives and
+// nouns with the lists read from the given files if they are set.
+func ReadNames(adjectivesFile, nounsFile string) (Names, error) {
+	names := DefaultNames()
+	var err error
+	if adjectivesFile != "" {
+		if names.Adjectives, err = ReadWordList(adjectivesFile); err != nil {
+			return names, err
+		}
+	}
+	if nounsFile != "" {
+		if names.Nouns, err = ReadWordList(nounsFile); err != nil {
+			return names, err
+		}
+	}
+	return names, nil
+}
+
+// UserName generates a user name like "Brave Otter".
+func (n Names) UserName(s *rand.Rand) string {
 	title := cases.Title(language.English)
-	return title.String(r(s, adjectives)) + " " + title.String(r(s, animals))
+	return title.String(n.Adjectives.Pick(s)) + " " + title.String(n.Nouns.Pick(s))
+}
+
+// RoomName generates a room name like "brave-amber-otter".
+func (n Names) RoomName(s *rand.Rand) string {
+	return n.Adjectives.Pick(s) + "-" + n.Colors.Pick(s) + "-" + n.Nouns.Pick(s)
+}
+
+var defaultNames = DefaultNames()
+
+func NewUserName(s *rand.Rand) string {
+	return defaultNames.UserName(s)
 }
 
 func NewRoomName(s *rand.Rand) string {
-	return r(s, adjectives) + "-" + r(s, colors) + "-" + r(s, animals)
+	return defaultNames.RoomName(s)
 }
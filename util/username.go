@@ -0,0 +1,65 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeUserName converts name to NFC and checks that it's at most
+// maxLength user-perceived characters long and doesn't contain control,
+// private use or bidi override characters. An empty name is returned as is,
+// maxLength <= 0 disables the length check.
+func NormalizeUserName(name string, maxLength int) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", errors.New("username is not valid utf-8")
+	}
+	// Bound the work before normalizing, a name can't be shorter in bytes
+	// than in graphemes.
+	if maxLength > 0 && utf8.RuneCountInString(name) > maxLength*maxRunesPerGrapheme {
+		return "", fmt.Errorf("username must not be longer than %d characters", maxLength)
+	}
+	name = norm.NFC.String(name)
+	for _, c := range name {
+		if disallowedNameRune(c) {
+			return "", fmt.Errorf("username contains the invalid character %U", c)
+		}
+	}
+	if maxLength > 0 && GraphemeCount(name) > maxLength {
+		return "", fmt.Errorf("username must not be longer than %d characters", maxLength)
+	}
+	return name, nil
+}
+
+// maxRunesPerGrapheme limits the runes accepted per allowed character before
+// the name is normalized, e.g. a family emoji has 7 runes.
+const maxRunesPerGrapheme = 8
+
+// disallowedNameRune reports whether c changes how surrounding text is
+// rendered or isn't visible at all. The zero width joiner is allowed because
+// emoji sequences need it.
+func disallowedNameRune(c rune) bool {
+	switch {
+	case c == zeroWidthJoiner:
+		return false
+	case unicode.Is(unicode.Bidi_Control, c):
+		return true
+	case unicode.In(c, unicode.Cc, unicode.Co, unicode.Cs, unicode.Zl, unicode.Zp):
+		return true
+	case unicode.Is(unicode.Noncharacter_Code_Point, c):
+		return true
+	}
+	return false
+}
+
+const zeroWidthJoiner = '\u200d'
+
+// GraphemeCount returns the number of user-perceived characters in s, the
+// extended grapheme clusters of UAX #29.
+func GraphemeCount(s string) int {
+	return uniseg.GraphemeClusterCount(s)
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphemeCount(t *testing.T) {
+	for s, expected := range map[string]int{
+		"":                         0,
+		"anna":                     4,
+		"grün":                     4,
+		"Jose\u0301":               4,
+		"👍🏽":                       1,
+		"👩\u200d👩\u200d👧\u200d👦":   1,
+		"🇩🇪🇫🇷":                     2,
+		"🇩🇪🇫":                      2,
+		"❤\ufe0f":                  1,
+		"a\u200db":                 2,
+		"한국어":                      3,
+		"🏳\ufe0f\u200d🌈":           1,
+		"👨\u200d💻👩\u200d🔬":         2,
+		"🇺🇸":                       1,
+		"🇩🇪🇫🇷🇮":                    3,
+		"\u1100\u1161\u11a8":       1,
+		"\u1100\u1100\u1161":       1,
+		"\u1100\u1161\u1100\u1161": 2,
+	} {
+		assert.Equal(t, expected, GraphemeCount(s), "%q", s)
+	}
+}
+
+func TestNormalizeUserName(t *testing.T) {
+	name, err := NormalizeUserName("Jose\u0301", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "José", name)
+
+	name, err = NormalizeUserName("👩\u200d👩\u200d👧\u200d👦 🇩🇪", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "👩\u200d👩\u200d👧\u200d👦 🇩🇪", name)
+
+	name, err = NormalizeUserName(strings.Repeat("a", 100), 0)
+	assert.NoError(t, err)
+	assert.Len(t, name, 100)
+
+	for _, invalid := range []string{
+		strings.Repeat("a", 5),
+		strings.Repeat("e\u0301", 5),
+		strings.Repeat("a\u0300\u0301\u0302\u0303\u0304\u0305\u0306\u0307\u0308", 4),
+		"\u202eevil",
+		"left\u2066right",
+		"line\nbreak",
+		"null\x00byte",
+		"private\ue000",
+		"invalid\xffutf8",
+	} {
+		_, err := NormalizeUserName(invalid, 4)
+		assert.Error(t, err, "%q", invalid)
+	}
+}
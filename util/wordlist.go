@@ -0,0 +1,82 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WordList is a list of words, each drawn with a probability proportional to
+// its weight.
+type WordList struct {
+	words      []string
+	cumulative []int
+}
+
+// NewWordList creates a WordList where every word has the weight 1.
+func NewWordList(words []string) *WordList {
+	list := &WordList{}
+	for _, word := range words {
+		list.add(word, 1)
+	}
+	return list
+}
+
+// ReadWordList reads a WordList from a file containing one word per line.
+// A word may be followed by whitespace and a positive integer weight, the
+// default weight is 1. Empty lines and lines starting with # are ignored.
+func ReadWordList(path string) (*WordList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &WordList{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		weight := 1
+		switch len(fields) {
+		case 1:
+		case 2:
+			weight, err = strconv.Atoi(fields[1])
+			if err != nil || weight <= 0 {
+				return nil, fmt.Errorf("%s:%d: weight must be a positive integer, got %q", path, lineNumber, fields[1])
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: expected 'word [weight]', got %q", path, lineNumber, line)
+		}
+		list.add(fields[0], weight)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(list.words) == 0 {
+		return nil, fmt.Errorf("%s: contains no words", path)
+	}
+	return list, nil
+}
+
+func (w *WordList) add(word string, weight int) {
+	total := 0
+	if len(w.cumulative) > 0 {
+		total = w.cumulative[len(w.cumulative)-1]
+	}
+	w.words = append(w.words, word)
+	w.cumulative = append(w.cumulative, total+weight)
+}
+
+// Pick draws a random word.
+func (w *WordList) Pick(r *rand.Rand) string {
+	n := r.Intn(w.cumulative[len(w.cumulative)-1])
+	return w.words[sort.SearchInts(w.cumulative, n+1)]
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWordList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nouns")
+	require.NoError(t, os.WriteFile(path, []byte("# animals\notter 3\n\nfalcon\n"), 0o600))
+
+	list, err := ReadWordList(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"otter", "falcon"}, list.words)
+
+	counts := map[string]int{}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 4000; i++ {
+		counts[list.Pick(r)]++
+	}
+	assert.InDelta(t, 3000, counts["otter"], 150)
+	assert.InDelta(t, 1000, counts["falcon"], 150)
+}
+
+func TestReadWordList_invalid(t *testing.T) {
+	for _, content := range []string{"otter zero\n", "otter 0\n", "otter 1 2\n", "# empty\n"} {
+		path := filepath.Join(t.TempDir(), "nouns")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err := ReadWordList(path)
+		assert.Error(t, err, content)
+	}
+}
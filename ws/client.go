@@ -1,12 +1,18 @@
 package ws
 
 import (
+	"compress/flate"
 	"fmt"
+	"hash/fnv"
+	"math"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/AsterZephyr/Scree-go-AZlearn/logger"
 	"github.com/gorilla/websocket"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
@@ -20,6 +26,25 @@ var ping = func(conn *websocket.Conn) error {
 	return conn.WriteMessage(websocket.PingMessage, nil)
 }
 
+// compressionLevels 将压缩级别的名称映射为flate的压缩级别
+var compressionLevels = map[string]int{
+	"speed":    flate.BestSpeed,
+	"balanced": 6,
+	"size":     flate.BestCompression,
+}
+
+// compressionLevel 返回连接使用的压缩级别
+// hint是客户端在升级请求中提示的级别名称，无效或为空时使用配置的默认级别
+func compressionLevel(hint, fallback string) int {
+	if level, ok := compressionLevels[hint]; ok {
+		return level
+	}
+	if level, ok := compressionLevels[fallback]; ok {
+		return level
+	}
+	return compressionLevels["balanced"]
+}
+
 // writeJSON 向WebSocket连接写入JSON消息
 var writeJSON = func(conn *websocket.Conn, v interface{}) error {
 	return conn.WriteJSON(v)
@@ -35,10 +60,17 @@ type Client struct {
 	conn *websocket.Conn    // WebSocket连接
 	info ClientInfo         // 客户端信息
 	once once               // 确保关闭操作只执行一次
-	read chan<- ClientMessage // 读取到的消息发送到此通道
+
+	sendLock sync.Mutex // 保证发送到分片的消息顺序，读取协程和关闭操作都会发送
+	shard    *Rooms     // 处理该客户端事件的分片，由sendLock保护
+	routed   bool       // 是否已按房间ID选择过分片，由sendLock保护
+	closed   bool       // 是否已发送断开连接事件，由sendLock保护
+
+	clients *atomic.Int64 // 打开的连接数，所有分片共享，见Rooms.ConnectedCount
 }
 
 // ClientMessage 表示从客户端接收到的消息
+// ClientMessage按值在通道中传递，不会单独分配内存；其中的事件在处理后被放回对象池
 type ClientMessage struct {
 	Info               ClientInfo // 客户端信息
 	SkipConnectedCheck bool       // 是否跳过连接检查
@@ -50,13 +82,33 @@ type ClientInfo struct {
 	ID                xid.ID             // 客户端唯一标识符
 	Authenticated     bool               // 是否已认证
 	AuthenticatedUser string             // 认证用户名
-	Write             chan outgoing.Message // 发送消息的通道
+	Write             *outbox            // 发往客户端的消息队列
 	Addr              net.IP             // 客户端IP地址
+	Seq               *atomic.Uint64     // 最后收到的消息序列号，由用户保存，恢复后的连接继续使用
+}
+
+// duplicate 返回序列号为seq的消息是否已经收到过，否则记录为最后收到的序列号
+// 没有序列号的消息不会被视为重复
+func (i ClientInfo) duplicate(seq uint64) bool {
+	if seq == 0 || i.Seq == nil {
+		return false
+	}
+	for {
+		last := i.Seq.Load()
+		if seq <= last {
+			return true
+		}
+		if i.Seq.CompareAndSwap(last, seq) {
+			return false
+		}
+	}
 }
 
 // newClient 创建一个新的WebSocket客户端
 // 初始化客户端信息并返回客户端实例
-func newClient(conn *websocket.Conn, req *http.Request, read chan ClientMessage, authenticatedUser string, authenticated, trustProxy bool) *Client {
+func newClient(conn *websocket.Conn, req *http.Request, shard *Rooms, id xid.ID, authenticatedUser string, authenticated, trustProxy bool) *Client {
+	write := newOutbox()
+	write.limit = shard.config.ClientQueueLimit
 	// 获取客户端IP地址
 	ip := conn.RemoteAddr().(*net.TCPAddr).IP
 	// 如果配置了信任代理，则尝试从X-Real-IP头获取真实IP
@@ -70,12 +122,16 @@ func newClient(conn *websocket.Conn, req *http.Request, read chan ClientMessage,
 		info: ClientInfo{
 			Authenticated:     authenticated,
 			AuthenticatedUser: authenticatedUser,
-			ID:                xid.New(),
+			ID:                id,
 			Addr:              ip,
-			Write:             make(chan outgoing.Message, 1),
+			Write:             write,
+			Seq:               new(atomic.Uint64),
 		},
-		read: read,
+		shard:   shard,
+		clients: shard.clients,
 	}
+	client.clients.Add(1)
+	connectedClients.Inc()
 	client.debug().Msg("WebSocket New Connection")
 	return client
 }
@@ -85,17 +141,16 @@ func newClient(conn *websocket.Conn, req *http.Request, read chan ClientMessage,
 func (c *Client) CloseOnError(code int, reason string) {
 	c.once.Do(func() {
 		// 发送断开连接事件
-		go func() {
-			c.read <- ClientMessage{
-				Info: c.info,
-				Incoming: &Disconnected{
-					Code:   code,
-					Reason: reason,
-				},
-			}
-		}()
+		go c.send(ClientMessage{
+			Info: c.info,
+			Incoming: &Disconnected{
+				Code:   code,
+				Reason: reason,
+			},
+		})
 		// 关闭WebSocket连接
 		c.writeCloseMessage(code, reason)
+		c.release()
 	})
 }
 
@@ -104,9 +159,53 @@ func (c *Client) CloseOnError(code int, reason string) {
 func (c *Client) CloseOnDone(code int, reason string) {
 	c.once.Do(func() {
 		c.writeCloseMessage(code, reason)
+		c.release()
 	})
 }
 
+// release 在连接关闭后减少连接数，只在once中调用一次
+func (c *Client) release() {
+	c.clients.Add(-1)
+	connectedClients.Dec()
+}
+
+// send 将消息发送到负责该客户端的分片
+// 客户端第一次创建或加入房间时移交到房间所在的分片，之后的消息都发送到该分片，
+// 因此同一房间的事件总是由同一个循环按顺序处理。
+// 主循环已停止或已发送断开连接事件时丢弃消息并返回false
+func (c *Client) send(msg ClientMessage) bool {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+	if c.closed {
+		return false
+	}
+	if _, ok := msg.Incoming.(*Disconnected); ok {
+		c.closed = true
+	}
+	if e, ok := msg.Incoming.(roomEvent); ok && !c.routed {
+		c.routed = true
+		// 房间ID为空时由当前分片生成一个属于自己的房间名
+		if target := c.shard.shardFor(e.roomID()); e.roomID() != "" && target != c.shard {
+			if !c.sendTo(c.shard, ClientMessage{Info: c.info, Incoming: &Handoff{}}) ||
+				!c.sendTo(target, ClientMessage{Info: c.info, Incoming: Connected{}, SkipConnectedCheck: true}) {
+				return false
+			}
+			c.shard = target
+		}
+	}
+	return c.sendTo(c.shard, msg)
+}
+
+// sendTo 将消息发送到给定分片，分片的循环已停止时返回false
+func (c *Client) sendTo(shard *Rooms, msg ClientMessage) bool {
+	select {
+	case shard.Incoming <- msg:
+		return true
+	case <-shard.done:
+		return false
+	}
+}
+
 // writeCloseMessage 向客户端发送关闭消息并关闭连接
 func (c *Client) writeCloseMessage(code int, reason string) {
 	message := websocket.FormatCloseMessage(code, reason)
@@ -135,28 +234,58 @@ func (c *Client) startReading(pongWait time.Duration) {
 		}
 		// 不支持二进制消息
 		if t == websocket.BinaryMessage {
+			messageDecodeErrorsTotal.WithLabelValues("binary").Inc()
 			c.CloseOnError(websocket.CloseUnsupportedData, "unsupported binary message type")
 			return
 		}
 
 		// 解析接收到的消息
-		incoming, err := ReadTypedIncoming(m)
+		incoming, seq, err := ReadTypedIncoming(m)
 		if err != nil {
 			c.CloseOnError(websocket.CloseUnsupportedData, fmt.Sprintf("malformed message: %s", err))
 			return
 		}
-		c.debug().Interface("event", fmt.Sprintf("%T", incoming)).Interface("payload", incoming).Msg("WebSocket Receive")
-		// 将消息发送到读取通道
-		c.read <- ClientMessage{Info: c.info, Incoming: incoming}
+		// 丢弃重复或乱序的消息，没有序列号的消息照常处理
+		if c.info.duplicate(seq) {
+			c.sampledDebug().Uint64("seq", seq).Uint64("last", c.info.Seq.Load()).Str("event", incoming.Type()).Msg("WebSocket Duplicate")
+			releaseEvent(incoming)
+			continue
+		}
+		c.sampledDebug().Str("event", incoming.Type()).Interface("payload", incoming).Msg("WebSocket Receive")
+		// 将消息发送到读取通道，主循环停止后不再读取
+		if !c.send(ClientMessage{Info: c.info, Incoming: incoming}) {
+			c.CloseOnDone(websocket.CloseGoingAway, "server shutting down")
+			return
+		}
 	}
 }
 
+// jitter 将period随机偏移最多±fraction，偏移由客户端ID决定
+// 同时连接的客户端（例如服务重启后）因此不会同时发送ping
+func jitter(period time.Duration, fraction float64, id xid.ID) time.Duration {
+	if fraction <= 0 {
+		return period
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(id.Bytes())
+	// 将哈希映射到[-1, 1]
+	offset := float64(h.Sum32())/math.MaxUint32*2 - 1
+	return period + time.Duration(float64(period)*fraction*offset)
+}
+
 // startWriteHandler 开始向客户端写入消息
 // 处理发送消息、定期ping和错误处理
-func (c *Client) startWriteHandler(pingPeriod time.Duration) {
+// lifetime大于0时，连接存在超过lifetime后以CloseGoingAway关闭，客户端会重新连接
+func (c *Client) startWriteHandler(pingPeriod, lifetime time.Duration) {
 	// 创建定期ping的定时器
 	pingTicker := time.NewTicker(pingPeriod)
 	defer pingTicker.Stop()
+	var expired <-chan time.Time
+	if lifetime > 0 {
+		lifetimeTimer := time.NewTimer(lifetime)
+		defer lifetimeTimer.Stop()
+		expired = lifetimeTimer.C
+	}
 	defer func() {
 		c.debug().Msg("WebSocket Done")
 	}()
@@ -165,29 +294,37 @@ func (c *Client) startWriteHandler(pingPeriod time.Duration) {
 	// 持续处理写入操作
 	for {
 		select {
-		case message := <-c.info.Write:
-			// 处理关闭消息
-			if msg, ok := message.(outgoing.CloseWriter); ok {
-				c.debug().Str("reason", msg.Reason).Int("code", msg.Code).Msg("WebSocket Close")
-				c.CloseOnDone(msg.Code, msg.Reason)
+		case <-c.info.Write.ready:
+			// 客户端跟不上必须送达的消息，丢弃消息会破坏信令，因此断开连接
+			if c.info.Write.isOverflowed() {
+				c.debug().Int("limit", c.info.Write.limit).Msg("WebSocket outgoing queue overflowed")
+				c.CloseOnError(websocket.CloseTryAgainLater, CloseQueueOverflow)
 				return
 			}
+			for _, message := range c.info.Write.pop() {
+				// 处理关闭消息
+				if msg, ok := message.(outgoing.CloseWriter); ok {
+					c.debug().Str("reason", msg.Reason).Int("code", msg.Code).Msg("WebSocket Close")
+					c.CloseOnDone(msg.Code, msg.Reason)
+					return
+				}
 
-			// 设置写入超时
-			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			// 将消息转换为类型化消息
-			typed, err := ToTypedOutgoing(message)
-			c.debug().Interface("event", typed.Type).Interface("payload", typed.Payload).Msg("WebSocket Send")
-			if err != nil {
-				c.debug().Err(err).Msg("could not get typed message, exiting connection.")
-				c.CloseOnError(websocket.CloseNormalClosure, "malformed outgoing "+err.Error())
-				continue
-			}
+				// 设置写入超时
+				_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+				// 将消息转换为类型化消息
+				typed, err := ToTypedOutgoing(message)
+				c.sampledDebug().Interface("event", typed.Type).Interface("payload", typed.Payload).Msg("WebSocket Send")
+				if err != nil {
+					c.debug().Err(err).Msg("could not get typed message, exiting connection.")
+					c.CloseOnError(websocket.CloseNormalClosure, "malformed outgoing "+err.Error())
+					continue
+				}
 
-			// 写入JSON消息
-			if err := writeJSON(c.conn, typed); err != nil {
-				c.printWebSocketError("write", err)
-				c.CloseOnError(websocket.CloseNormalClosure, "write error"+err.Error())
+				// 写入JSON消息
+				if err := writeJSON(c.conn, typed); err != nil {
+					c.printWebSocketError("write", err)
+					c.CloseOnError(websocket.CloseNormalClosure, "write error"+err.Error())
+				}
 			}
 		case <-pingTicker.C:
 			// 定期发送ping消息
@@ -196,6 +333,9 @@ func (c *Client) startWriteHandler(pingPeriod time.Duration) {
 				c.printWebSocketError("ping", err)
 				c.CloseOnError(websocket.CloseNormalClosure, "ping timeout")
 			}
+		case <-expired:
+			c.debug().Dur("lifetime", lifetime).Msg("WebSocket lifetime exceeded")
+			c.CloseOnError(websocket.CloseGoingAway, CloseLifetimeExceeded)
 		}
 	}
 }
@@ -203,7 +343,13 @@ func (c *Client) startWriteHandler(pingPeriod time.Duration) {
 // debug 返回一个带有客户端信息的日志事件
 // 用于记录与客户端相关的调试信息
 func (c *Client) debug() *zerolog.Event {
-	return log.Debug().Str("id", c.info.ID.String()).Str("ip", c.info.Addr.String())
+	return log.Debug().Str("id", c.info.ID.String()).Str("ip", logger.IP(c.info.Addr))
+}
+
+// sampledDebug 返回一个带有客户端信息的采样日志事件
+// 用于每条消息都会触发的高频调试日志，启用日志采样时只记录其中一部分
+func (c *Client) sampledDebug() *zerolog.Event {
+	return logger.Sampled().Debug().Str("id", c.info.ID.String()).Str("ip", logger.IP(c.info.Addr))
 }
 
 // printWebSocketError 打印WebSocket错误
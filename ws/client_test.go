@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/config"
+	"github.com/gorilla/websocket"
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJitter_staysWithinBounds(t *testing.T) {
+	period := 5 * time.Second
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 1000; i++ {
+		id := xid.New()
+		interval := jitter(period, 0.1, id)
+		assert.GreaterOrEqual(t, interval, 4500*time.Millisecond)
+		assert.LessOrEqual(t, interval, 5500*time.Millisecond)
+		assert.Equal(t, interval, jitter(period, 0.1, id), "the jitter is stable per client")
+		seen[interval] = true
+	}
+	assert.Greater(t, len(seen), 100, "clients get different intervals")
+
+	assert.Equal(t, period, jitter(period, 0, xid.New()))
+}
+
+func TestCompressionLevel(t *testing.T) {
+	assert.Equal(t, 1, compressionLevel("speed", "balanced"))
+	assert.Equal(t, 9, compressionLevel("size", "speed"))
+	assert.Equal(t, 1, compressionLevel("", "speed"), "no hint uses the configured level")
+	assert.Equal(t, 6, compressionLevel("bogus", "balanced"))
+}
+
+func TestClientInfo_duplicate(t *testing.T) {
+	info := ClientInfo{Seq: new(atomic.Uint64)}
+	assert.False(t, info.duplicate(0))
+	assert.False(t, info.duplicate(1))
+	assert.True(t, info.duplicate(1), "a replayed message is a duplicate")
+	assert.False(t, info.duplicate(3))
+	assert.True(t, info.duplicate(2), "an older message is dropped")
+	assert.False(t, info.duplicate(0), "messages without a sequence number are never dropped")
+	assert.Equal(t, uint64(3), info.Seq.Load())
+
+	assert.False(t, ClientInfo{}.duplicate(1))
+}
+
+func TestStartReading_dropsDuplicates(t *testing.T) {
+	rooms := NewRooms(nil, nil, config.Config{EventQueueSize: 10})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+		require.NoError(t, err)
+		go newClient(conn, req, rooms, xid.New(), "", false, false).startReading(time.Minute)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	for _, msg := range []string{
+		`{"type":"name","seq":1,"payload":{"username":"first"}}`,
+		`{"type":"name","seq":1,"payload":{"username":"replayed"}}`,
+		`{"type":"name","payload":{"username":"unsequenced"}}`,
+		`{"type":"name","seq":2,"payload":{"username":"second"}}`,
+	} {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(msg)))
+	}
+
+	var names []string
+	for len(names) < 3 {
+		select {
+		case msg := <-rooms.Incoming:
+			names = append(names, msg.Incoming.(*Name).UserName)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+	}
+	assert.Equal(t, []string{"first", "unsequenced", "second"}, names)
+	conn.Close()
+}
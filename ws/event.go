@@ -1,5 +1,12 @@
 package ws
 
+import "github.com/rs/zerolog"
+
 type Event interface {
-	Execute(*Rooms, ClientInfo) error
+	// Execute 处理事件，logger已带有当前房间和用户的字段
+	Execute(*Rooms, ClientInfo, zerolog.Logger) error
+	// Validate 在解码后校验事件内容
+	Validate() error
+	// Type 返回事件类型，已注册的事件与消息中的type相同，用于日志和指标
+	Type() string
 }
@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+// init 注册ack事件处理器
+// 在包初始化时被调用，将事件处理函数注册到事件处理系统中
+func init() {
+	register("ack", func() Event {
+		return &Ack{}
+	})
+}
+
+// ackTimeout 是等待接收方确认点对点消息的时间，超时后通知发送方消息未送达
+var ackTimeout = 5 * time.Second
+
+// maxAckIDLength 是确认ID的最大长度
+const maxAckIDLength = 64
+
+// pendingAck 标识一条等待确认的点对点消息
+type pendingAck struct {
+	SID   xid.ID
+	AckID string
+}
+
+// Ack 表示接收方确认收到了带有ackId的点对点消息
+// 确认是可选的，只有发送方在消息中设置了ackId时才需要确认
+type Ack struct {
+	SID   xid.ID `json:"sid"`
+	AckID string `json:"ackId"`
+}
+
+// Execute 处理确认事件，通知原发送方消息已送达
+func (e *Ack) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	room, err := rooms.CurrentRoom(current)
+	if err != nil {
+		return err
+	}
+
+	session, ok := room.Sessions[e.SID]
+	if !ok {
+		logger.Debug().Str("id", e.SID.String()).Msg("unknown session")
+		return nil
+	}
+	if session.Host != current.ID && session.Client != current.ID {
+		return fmt.Errorf("permission denied for session %s", e.SID)
+	}
+
+	key := pendingAck{SID: e.SID, AckID: e.AckID}
+	sender, ok := room.acks[key]
+	// 发送方不能确认自己的消息
+	if !ok || sender == current.ID {
+		return nil
+	}
+	delete(room.acks, key)
+	if user, ok := room.Users[sender]; ok {
+		user.Write(outgoing.Ack{SID: e.SID, AckID: e.AckID, Delivered: true})
+	}
+	return nil
+}
+
+// Validate 校验确认事件是否包含会话ID和确认ID
+func (e *Ack) Validate() error {
+	if err := validateSID(e.SID); err != nil {
+		return err
+	}
+	if e.AckID == "" {
+		return errors.New("ackId must be set")
+	}
+	return validateAckID(e.AckID)
+}
+
+func (*Ack) Type() string {
+	return "ack"
+}
+
+// AckTimeout 在确认超时后由定时器发送到主循环，仅供内部使用
+type AckTimeout struct {
+	Room  string
+	SID   xid.ID
+	AckID string
+}
+
+// Execute 如果消息仍未被确认，通知发送方消息未送达
+func (e *AckTimeout) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	room, ok := rooms.Rooms[e.Room]
+	if !ok {
+		return nil
+	}
+	key := pendingAck{SID: e.SID, AckID: e.AckID}
+	sender, ok := room.acks[key]
+	if !ok {
+		return nil
+	}
+	delete(room.acks, key)
+	if user, ok := room.Users[sender]; ok {
+		user.Write(outgoing.Ack{SID: e.SID, AckID: e.AckID, Delivered: false})
+	}
+	return nil
+}
+
+func (e *AckTimeout) Validate() error {
+	return nil
+}
+
+func (*AckTimeout) Type() string {
+	return "acktimeout"
+}
+
+// expectAck 记录一条等待确认的点对点消息，ackID为空时不需要确认
+// 超时由定时器通过主循环处理，因此房间的状态只在主循环中修改
+func (r *Room) expectAck(rooms *Rooms, sid, sender xid.ID, ackID string) {
+	if ackID == "" {
+		return
+	}
+	if r.acks == nil {
+		r.acks = map[pendingAck]xid.ID{}
+	}
+	r.acks[pendingAck{SID: sid, AckID: ackID}] = sender
+	timeout := &AckTimeout{Room: r.ID, SID: sid, AckID: ackID}
+	time.AfterFunc(ackTimeout, func() {
+		select {
+		case rooms.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: timeout}:
+		case <-rooms.done:
+		}
+	})
+}
+
+// validateAckID 校验可选的确认ID的长度
+func validateAckID(ackID string) error {
+	if len(ackID) > maxAckIDLength {
+		return fmt.Errorf("ackId must not be longer than %d characters", maxAckIDLength)
+	}
+	return nil
+}
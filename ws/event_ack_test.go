@@ -0,0 +1,63 @@
+package ws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAck_notifiesSender(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.Incoming = make(chan ClientMessage, 10)
+	host := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	viewer := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, viewer, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.newSession(host.ID, viewer.ID, rooms, nil, nil)
+	sid, _ := room.session(host.ID, viewer.ID)
+	host.Write.pop()
+	viewer.Write.pop()
+
+	offer := &HostOffer{SID: sid, Value: []byte(`{"type":"offer","sdp":"v=0"}`), AckID: "1"}
+	assert.NoError(t, offer.Execute(rooms, host, zerolog.Nop()))
+	assert.Equal(t, "1", viewer.Write.pop()[0].(outgoing.HostOffer).AckID)
+
+	assert.NoError(t, (&Ack{SID: sid, AckID: "1"}).Execute(rooms, host, zerolog.Nop()), "the sender can't ack its own message")
+	assert.Empty(t, host.Write.pop())
+
+	assert.NoError(t, (&Ack{SID: sid, AckID: "1"}).Execute(rooms, viewer, zerolog.Nop()))
+	assert.Equal(t, []outgoing.Message{outgoing.Ack{SID: sid, AckID: "1", Delivered: true}}, host.Write.pop())
+	assert.Empty(t, room.acks)
+}
+
+func TestAck_timeout(t *testing.T) {
+	old := ackTimeout
+	ackTimeout = 10 * time.Millisecond
+	defer func() { ackTimeout = old }()
+
+	rooms := newTestRooms()
+	rooms.Incoming = make(chan ClientMessage, 10)
+	host := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	viewer := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, viewer, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.newSession(host.ID, viewer.ID, rooms, nil, nil)
+	sid, _ := room.session(host.ID, viewer.ID)
+	host.Write.pop()
+	viewer.Write.pop()
+
+	answer := &ClientAnswer{SID: sid, Value: []byte(`{"type":"answer","sdp":"v=0"}`), AckID: "a"}
+	assert.NoError(t, answer.Execute(rooms, viewer, zerolog.Nop()))
+	host.Write.pop()
+
+	// the timer hands the timeout to the event loop.
+	msg := <-rooms.Incoming
+	rooms.handle(msg)
+	assert.Equal(t, []outgoing.Message{outgoing.Ack{SID: sid, AckID: "a", Delivered: false}}, viewer.Write.pop())
+	assert.Empty(t, room.acks)
+}
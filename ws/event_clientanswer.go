@@ -3,7 +3,7 @@ package ws
 import (
 	"fmt"
 
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
 )
 
@@ -15,16 +15,21 @@ func init() {
 
 type ClientAnswer outgoing.P2PMessage
 
-func (e *ClientAnswer) Execute(rooms *Rooms, current ClientInfo) error {
+func (e *ClientAnswer) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	room, err := rooms.CurrentRoom(current)
 	if err != nil {
 		return err
 	}
 
+	// 过大的会话描述不转发，只通知发送方
+	if sdpTooLarge(rooms, current, e.SID, e.Value, logger) {
+		return nil
+	}
+
 	session, ok := room.Sessions[e.SID]
 
 	if !ok {
-		log.Debug().Str("id", e.SID.String()).Msg("unknown session")
+		logger.Debug().Str("id", e.SID.String()).Msg("unknown session")
 		return nil
 	}
 
@@ -32,7 +37,22 @@ func (e *ClientAnswer) Execute(rooms *Rooms, current ClientInfo) error {
 		return fmt.Errorf("permission denied for session %s", e.SID)
 	}
 
-	room.Users[session.Host].WriteTimeout(outgoing.ClientAnswer(*e))
+	room.expectAck(rooms, e.SID, current.ID, e.AckID)
+	room.Users[session.Host].Write(outgoing.ClientAnswer(*e))
 
 	return nil
 }
+
+func (e *ClientAnswer) Validate() error {
+	if err := validateSID(e.SID); err != nil {
+		return err
+	}
+	if err := validateAckID(e.AckID); err != nil {
+		return err
+	}
+	return validateSDP(e.Value)
+}
+
+func (*ClientAnswer) Type() string {
+	return "clientanswer"
+}
@@ -3,7 +3,7 @@ package ws
 import (
 	"fmt"
 
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
 )
 
@@ -15,7 +15,7 @@ func init() {
 
 type ClientICE outgoing.P2PMessage
 
-func (e *ClientICE) Execute(rooms *Rooms, current ClientInfo) error {
+func (e *ClientICE) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	room, err := rooms.CurrentRoom(current)
 	if err != nil {
 		return err
@@ -24,7 +24,7 @@ func (e *ClientICE) Execute(rooms *Rooms, current ClientInfo) error {
 	session, ok := room.Sessions[e.SID]
 
 	if !ok {
-		log.Debug().Str("id", e.SID.String()).Msg("unknown session")
+		logger.Debug().Str("id", e.SID.String()).Msg("unknown session")
 		return nil
 	}
 
@@ -32,7 +32,19 @@ func (e *ClientICE) Execute(rooms *Rooms, current ClientInfo) error {
 		return fmt.Errorf("permission denied for session %s", e.SID)
 	}
 
-	room.Users[session.Host].WriteTimeout(outgoing.ClientICE(*e))
+	room.expectAck(rooms, e.SID, current.ID, e.AckID)
+	room.Users[session.Host].Write(outgoing.ClientICE(*e))
 
 	return nil
 }
+
+func (e *ClientICE) Validate() error {
+	if err := validateSID(e.SID); err != nil {
+		return err
+	}
+	return validateAckID(e.AckID)
+}
+
+func (*ClientICE) Type() string {
+	return "clientice"
+}
@@ -0,0 +1,57 @@
+package ws
+
+import (
+	"fmt"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+)
+
+// init 注册clienticeend事件处理器
+// 在包初始化时被调用，将事件处理函数注册到事件处理系统中
+func init() {
+	register("clienticeend", func() Event {
+		return &ClientICEEnd{}
+	})
+}
+
+// ClientICEEnd 表示客户端的ICE候选收集已完成（trickle ICE的end-of-candidates）
+// 主机收到后可以停止等待更多候选，加快连接建立
+type ClientICEEnd outgoing.ICEEnd
+
+// Execute 验证权限并将end-of-candidates标记转发给对应的主机
+func (e *ClientICEEnd) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	// 获取当前用户所在的房间
+	room, err := rooms.CurrentRoom(current)
+	if err != nil {
+		return err
+	}
+
+	// 查找对应的会话
+	session, ok := room.Sessions[e.SID]
+
+	if !ok {
+		// 如果会话不存在，记录日志并忽略
+		logger.Debug().Str("id", e.SID.String()).Msg("unknown session")
+		return nil
+	}
+
+	// 验证当前用户是否是会话的客户端
+	if session.Client != current.ID {
+		return fmt.Errorf("permission denied for session %s", e.SID)
+	}
+
+	// 将标记转发给主机
+	room.Users[session.Host].Write(outgoing.ClientICEEnd(*e))
+
+	return nil
+}
+
+// Validate 校验消息是否包含会话ID
+func (e *ClientICEEnd) Validate() error {
+	return validateSID(e.SID)
+}
+
+func (*ClientICEEnd) Type() string {
+	return "clienticeend"
+}
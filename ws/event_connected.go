@@ -1,8 +1,18 @@
 package ws
 
+import "github.com/rs/zerolog"
+
 type Connected struct{}
 
-func (e Connected) Execute(rooms *Rooms, current ClientInfo) error {
+func (e Connected) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	rooms.connected[current.ID] = ""
 	return nil
 }
+
+func (e Connected) Validate() error {
+	return nil
+}
+
+func (Connected) Type() string {
+	return "connected"
+}
@@ -3,9 +3,13 @@ package ws
 import (
 	"errors"
 	"fmt"
+	"time"
+	"unicode/utf8"
 
 	"github.com/AsterZephyr/Scree-go-AZlearn/config"
+	"github.com/AsterZephyr/Scree-go-AZlearn/util"
 	"github.com/rs/xid"
+	"github.com/rs/zerolog"
 )
 
 func init() {
@@ -20,33 +24,55 @@ type Create struct {
 	CloseOnOwnerLeave bool           `json:"closeOnOwnerLeave"`
 	UserName          string         `json:"username"`
 	JoinIfExist       bool           `json:"joinIfExist,omitempty"`
+	RoomDelta         bool           `json:"roomDelta,omitempty"`
+	WatchOnDemand     bool           `json:"watchOnDemand,omitempty"`
+	Recorder          bool           `json:"recorder,omitempty"`
+	Welcome           string         `json:"welcome,omitempty"`
 }
 
-func (e *Create) Execute(rooms *Rooms, current ClientInfo) error {
+// maxWelcomeLength 是欢迎消息的最大字符数
+const maxWelcomeLength = 1000
+
+func (e *Create) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	if rooms.connected[current.ID] != "" {
 		return fmt.Errorf("cannot join room, you are already in one")
 	}
 
+	if e.ID == "" {
+		e.ID = rooms.uniqueRoomName()
+	} else {
+		e.ID = rooms.normalizeRoomID(e.ID)
+		if err := rooms.blockedName("room id", e.ID); err != nil {
+			return err
+		}
+	}
+
 	if _, ok := rooms.Rooms[e.ID]; ok {
 		if e.JoinIfExist {
-			join := &Join{UserName: e.UserName, ID: e.ID}
-			return join.Execute(rooms, current)
+			join := &Join{UserName: e.UserName, ID: e.ID, RoomDelta: e.RoomDelta, WatchOnDemand: e.WatchOnDemand, Recorder: e.Recorder}
+			return join.Execute(rooms, current, logger)
 		}
 
 		return fmt.Errorf("room with id %s does already exist", e.ID)
 	}
 
-	name := e.UserName
+	name, err := rooms.userName(e.UserName)
+	if err != nil {
+		return err
+	}
 	if current.Authenticated {
 		name = current.AuthenticatedUser
 	}
 	if name == "" {
+		if rooms.config.RequireUserName {
+			return errors.New("username must be set")
+		}
 		name = rooms.RandUserName()
 	}
 
 	switch rooms.config.AuthMode {
 	case config.AuthModeNone:
-	case config.AuthModeAll:
+	case config.AuthModeAll, config.AuthModeHTTP, config.AuthModeProxy:
 		if !current.Authenticated {
 			return errors.New("you need to login")
 		}
@@ -58,11 +84,16 @@ func (e *Create) Execute(rooms *Rooms, current ClientInfo) error {
 		return errors.New("invalid authmode:" + rooms.config.AuthMode)
 	}
 
+	reserved := rooms.isReserved(e.ID)
 	room := &Room{
 		ID:                e.ID,
-		CloseOnOwnerLeave: e.CloseOnOwnerLeave,
+		CloseOnOwnerLeave: e.CloseOnOwnerLeave && !reserved,
 		Mode:              e.Mode,
 		Sessions:          map[xid.ID]*RoomSession{},
+		lastStream:        time.Now(),
+		created:           time.Now(),
+		reserved:          reserved,
+		welcome:           e.Welcome,
 		Users: map[xid.ID]*User{
 			current.ID: {
 				ID:        current.ID,
@@ -70,14 +101,46 @@ func (e *Create) Execute(rooms *Rooms, current ClientInfo) error {
 				Streaming: false,
 				Owner:     true,
 				Addr:      current.Addr,
+				delta:     e.RoomDelta,
+				onDemand:  e.WatchOnDemand,
+				recorder:  e.Recorder,
+				since:     time.Now(),
 				_write:    current.Write,
 			},
 		},
 	}
+	rooms.issueResume(room.Users[current.ID])
 	rooms.connected[current.ID] = room.ID
 	rooms.Rooms[e.ID] = room
-	room.notifyInfoChanged()
+	rooms.markChanged(room)
 	usersJoinedTotal.Inc()
 	roomsCreatedTotal.Inc()
 	return nil
 }
+
+// Validate 校验创建参数，id为空时由服务器生成房间名，否则校验房间ID
+func (e *Create) Validate() error {
+	if e.ID != "" {
+		if err := util.ValidateRoomID(e.ID); err != nil {
+			return err
+		}
+	}
+	if utf8.RuneCountInString(e.Welcome) > maxWelcomeLength {
+		return fmt.Errorf("welcome must not be longer than %d characters", maxWelcomeLength)
+	}
+	switch e.Mode {
+	case ConnectionLocal, ConnectionSTUN, ConnectionTURN:
+		return nil
+	default:
+		return fmt.Errorf("invalid mode %q", e.Mode)
+	}
+}
+
+func (*Create) Type() string {
+	return "create"
+}
+
+// roomID 返回目标房间ID，用于选择处理该客户端的分片
+func (e *Create) roomID() string {
+	return e.ID
+}
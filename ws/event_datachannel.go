@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"fmt"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+// init 注册datachannel-offer和datachannel-answer事件处理器
+// 在包初始化时被调用，将事件处理函数注册到事件处理系统中
+func init() {
+	register("datachannel-offer", func() Event {
+		return &DataChannelOffer{}
+	})
+	register("datachannel-answer", func() Event {
+		return &DataChannelAnswer{}
+	})
+}
+
+// DataChannelOffer 表示为额外的DataChannel（例如文件传输）重新协商时发送的SDP offer
+// 会话的任意一方都可以发起，消息被转发给会话的另一方，不会创建新的会话
+type DataChannelOffer outgoing.P2PMessage
+
+// Execute 验证当前用户属于该会话，并将offer转发给另一方
+func (e *DataChannelOffer) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	if sdpTooLarge(rooms, current, e.SID, e.Value, logger) {
+		return nil
+	}
+	return relayToPeer(rooms, current, (*outgoing.P2PMessage)(e), logger, func(msg outgoing.P2PMessage) outgoing.Message {
+		return outgoing.DataChannelOffer(msg)
+	})
+}
+
+// DataChannelAnswer 表示对DataChannelOffer的SDP answer
+type DataChannelAnswer outgoing.P2PMessage
+
+// Execute 验证当前用户属于该会话，并将answer转发给另一方
+func (e *DataChannelAnswer) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	if sdpTooLarge(rooms, current, e.SID, e.Value, logger) {
+		return nil
+	}
+	return relayToPeer(rooms, current, (*outgoing.P2PMessage)(e), logger, func(msg outgoing.P2PMessage) outgoing.Message {
+		return outgoing.DataChannelAnswer(msg)
+	})
+}
+
+// relayToPeer 将消息转发给会话中的另一方
+// 未知的会话被忽略，不属于该会话的用户没有权限
+func relayToPeer(rooms *Rooms, current ClientInfo, e *outgoing.P2PMessage, logger zerolog.Logger, convert func(outgoing.P2PMessage) outgoing.Message) error {
+	// 获取当前用户所在的房间
+	room, err := rooms.CurrentRoom(current)
+	if err != nil {
+		return err
+	}
+
+	// 查找对应的会话
+	session, ok := room.Sessions[e.SID]
+	if !ok {
+		logger.Debug().Str("id", e.SID.String()).Msg("unknown session")
+		return nil
+	}
+
+	var peer xid.ID
+	switch current.ID {
+	case session.Host:
+		peer = session.Client
+	case session.Client:
+		peer = session.Host
+	default:
+		return fmt.Errorf("permission denied for session %s", e.SID)
+	}
+	room.expectAck(rooms, e.SID, current.ID, e.AckID)
+	room.Users[peer].Write(convert(*e))
+	return nil
+}
+
+// Validate 校验offer消息是否包含会话ID和完整的会话描述
+func (e *DataChannelOffer) Validate() error {
+	if err := validateSID(e.SID); err != nil {
+		return err
+	}
+	if err := validateAckID(e.AckID); err != nil {
+		return err
+	}
+	return validateSDP(e.Value)
+}
+
+func (*DataChannelOffer) Type() string {
+	return "datachannel-offer"
+}
+
+// Validate 校验answer消息是否包含会话ID和完整的会话描述
+func (e *DataChannelAnswer) Validate() error {
+	if err := validateSID(e.SID); err != nil {
+		return err
+	}
+	if err := validateAckID(e.AckID); err != nil {
+		return err
+	}
+	return validateSDP(e.Value)
+}
+
+func (*DataChannelAnswer) Type() string {
+	return "datachannel-answer"
+}
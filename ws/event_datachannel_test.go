@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataChannel_relaysToPeer(t *testing.T) {
+	rooms := newTestRooms()
+	host := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	viewer := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, viewer, zerolog.Nop()))
+	other := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, other, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.newSession(host.ID, viewer.ID, rooms, nil, nil)
+	sid, _ := room.session(host.ID, viewer.ID)
+	host.Write.pop()
+	viewer.Write.pop()
+
+	value := []byte(`{"type":"offer","sdp":"v=0"}`)
+	assert.NoError(t, (&DataChannelOffer{SID: sid, Value: value}).Execute(rooms, viewer, zerolog.Nop()))
+	assert.Equal(t, []outgoing.Message{outgoing.DataChannelOffer{SID: sid, Value: value}}, host.Write.pop())
+
+	assert.NoError(t, (&DataChannelAnswer{SID: sid, Value: value}).Execute(rooms, host, zerolog.Nop()))
+	assert.Equal(t, []outgoing.Message{outgoing.DataChannelAnswer{SID: sid, Value: value}}, viewer.Write.pop())
+
+	assert.Error(t, (&DataChannelOffer{SID: sid, Value: value}).Execute(rooms, other, zerolog.Nop()))
+}
+
+func TestHostOffer_maxSDPBytes(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.config.MaxSDPBytes = 40
+	host := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	viewer := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, viewer, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.newSession(host.ID, viewer.ID, rooms, nil, nil)
+	sid, _ := room.session(host.ID, viewer.ID)
+	host.Write.pop()
+	viewer.Write.pop()
+
+	large := []byte(`{"type":"offer","sdp":"v=0 with a lot of attributes"}`)
+	assert.NoError(t, (&HostOffer{SID: sid, Value: large}).Execute(rooms, host, zerolog.Nop()), "the sender stays connected")
+	assert.Empty(t, viewer.Write.pop())
+	msgs := host.Write.pop()
+	assert.Len(t, msgs, 1)
+	assert.IsType(t, outgoing.Error{}, msgs[0])
+
+	small := []byte(`{"type":"offer","sdp":"v=0"}`)
+	assert.NoError(t, (&HostOffer{SID: sid, Value: small}).Execute(rooms, host, zerolog.Nop()))
+	assert.Len(t, viewer.Write.pop(), 1)
+}
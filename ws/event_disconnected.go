@@ -2,9 +2,12 @@ package ws
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
 type Disconnected struct {
@@ -12,7 +15,7 @@ type Disconnected struct {
 	Reason string
 }
 
-func (e *Disconnected) Execute(rooms *Rooms, current ClientInfo) error {
+func (e *Disconnected) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	e.executeNoError(rooms, current)
 	return nil
 }
@@ -20,7 +23,7 @@ func (e *Disconnected) Execute(rooms *Rooms, current ClientInfo) error {
 func (e *Disconnected) executeNoError(rooms *Rooms, current ClientInfo) {
 	roomID := rooms.connected[current.ID]
 	delete(rooms.connected, current.ID)
-	writeTimeout[outgoing.Message](current.Write, outgoing.CloseWriter{Code: e.Code, Reason: e.Reason})
+	current.Write.push(outgoing.CloseWriter{Code: e.Code, Reason: e.Reason})
 
 	if roomID == "" {
 		return
@@ -39,39 +42,76 @@ func (e *Disconnected) executeNoError(rooms *Rooms, current ClientInfo) {
 		return
 	}
 
-	delete(room.Users, current.ID)
+	// keep the user and its sessions, the client may resume within the grace period
+	if grace := rooms.config.DisconnectGrace; grace > 0 && user.resume != "" {
+		rooms.awaitResume(room, user, grace)
+		return
+	}
+	rooms.leave(room, user)
+}
+
+// leave removes user from room, ends its sessions and closes the room if
+// needed.
+func (r *Rooms) leave(room *Room, user *User) {
+	roomID := room.ID
+	delete(room.Users, user.ID)
 	usersLeftTotal.Inc()
+	room.observeLeave(user)
+	if user.Streaming {
+		room.lastStream = time.Now()
+	}
 
 	for id, session := range room.Sessions {
-		if bytes.Equal(session.Client.Bytes(), current.ID.Bytes()) {
+		if bytes.Equal(session.Client.Bytes(), user.ID.Bytes()) {
 			host, ok := room.Users[session.Host]
 			if ok {
-				host.WriteTimeout(outgoing.EndShare(id))
+				host.Write(outgoing.EndShare(id))
 			}
-			room.closeSession(rooms, id)
+			room.closeSession(r, id)
 		}
-		if bytes.Equal(session.Host.Bytes(), current.ID.Bytes()) {
+		if bytes.Equal(session.Host.Bytes(), user.ID.Bytes()) {
 			client, ok := room.Users[session.Client]
 			if ok {
-				client.WriteTimeout(outgoing.EndShare(id))
+				client.Write(outgoing.EndShare(id))
 			}
-			room.closeSession(rooms, id)
+			room.closeSession(r, id)
 		}
 	}
 
 	if user.Owner && room.CloseOnOwnerLeave {
 		for _, member := range room.Users {
-			delete(rooms.connected, member.ID)
-			member.WriteTimeout(outgoing.CloseWriter{Code: websocket.CloseNormalClosure, Reason: CloseOwnerLeft})
+			delete(r.connected, member.ID)
+			member.Write(outgoing.CloseWriter{Code: websocket.CloseNormalClosure, Reason: CloseOwnerLeft})
 		}
-		rooms.closeRoom(roomID)
+		r.closeRoom(roomID)
 		return
 	}
 
 	if len(room.Users) == 0 {
-		rooms.closeRoom(roomID)
+		if room.reserved {
+			// reserved rooms stay open, the next user gets a fresh room
+			room.Locked = false
+			room.Recording = false
+			return
+		}
+		r.closeRoom(roomID)
 		return
 	}
 
-	room.notifyInfoChanged()
+	// the room stays open, hand it over so it can still be locked and managed
+	if user.Owner {
+		if owner := room.transferOwnership(); owner != nil {
+			log.Debug().Str("room", roomID).Str("owner", owner.ID.String()).Msg("Transferred room ownership")
+		}
+	}
+
+	r.markChanged(room)
+}
+
+func (e *Disconnected) Validate() error {
+	return nil
+}
+
+func (*Disconnected) Type() string {
+	return "disconnected"
 }
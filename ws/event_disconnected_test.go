@@ -0,0 +1,44 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisconnected_ownerLeavesRoomSurvives(t *testing.T) {
+	rooms := newTestRooms()
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionLocal, CloseOnOwnerLeave: false}).Execute(rooms, owner, zerolog.Nop()))
+	first := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, first, zerolog.Nop()))
+	second := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, second, zerolog.Nop()))
+	rooms.flushChanged()
+	first.Write.pop()
+	second.Write.pop()
+
+	assert.NoError(t, (&Disconnected{Code: websocket.CloseNormalClosure}).Execute(rooms, owner, zerolog.Nop()))
+	room, ok := rooms.Rooms["room"]
+	if !assert.True(t, ok, "the room stays open") {
+		return
+	}
+	assert.True(t, room.Users[first.ID].Owner, "the longest present user is the new owner")
+	assert.False(t, room.Users[second.ID].Owner)
+
+	rooms.flushChanged()
+	for _, client := range []ClientInfo{first, second} {
+		msgs := client.Write.pop()
+		if assert.Len(t, msgs, 1) {
+			for _, user := range msgs[0].(outgoing.Room).Users {
+				assert.Equal(t, user.ID == first.ID, user.Owner)
+			}
+		}
+	}
+
+	assert.NoError(t, (&Lock{}).Execute(rooms, first, zerolog.Nop()), "the new owner can manage the room")
+	assert.Error(t, (&Lock{}).Execute(rooms, second, zerolog.Nop()))
+}
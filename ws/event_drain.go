@@ -0,0 +1,82 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+// drainGrace 是通知成员重新连接后到关闭房间的时间
+var drainGrace = 5 * time.Second
+
+// Drain 通知房间的所有成员重新连接，并在drainGrace后关闭房间，仅供内部使用
+// 与直接关闭不同，客户端收到结构化的重连信号，可以通过负载均衡器在其他实例上重建房间
+type Drain struct {
+	ID       string
+	Response chan bool // 房间是否存在
+}
+
+func (e *Drain) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	room, ok := rooms.Rooms[e.ID]
+	if !ok {
+		writeTimeout(e.Response, false)
+		return nil
+	}
+	writeTimeout(e.Response, true)
+	if room.draining {
+		return nil
+	}
+
+	// 排空期间不允许新用户加入
+	room.draining = true
+	for _, user := range room.Users {
+		user.Write(outgoing.Drain{Grace: drainGrace.Milliseconds()})
+	}
+	logger.Info().Str("room", e.ID).Dur("grace", drainGrace).Msg("Draining room")
+
+	closeDrained := &DrainClose{room: room}
+	time.AfterFunc(drainGrace, func() {
+		select {
+		case rooms.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: closeDrained}:
+		case <-rooms.done:
+		}
+	})
+	return nil
+}
+
+func (e *Drain) Validate() error {
+	return nil
+}
+
+func (*Drain) Type() string {
+	return "drain"
+}
+
+// DrainClose 在排空的等待时间结束后关闭房间，仅供内部使用
+type DrainClose struct {
+	room *Room
+}
+
+// Execute 断开仍在房间中的成员并关闭房间
+// 期间已关闭并重新创建的同名房间不受影响
+func (e *DrainClose) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	if rooms.Rooms[e.room.ID] != e.room {
+		return nil
+	}
+	for _, member := range e.room.Users {
+		delete(rooms.connected, member.ID)
+		member.Write(outgoing.CloseWriter{Code: websocket.CloseGoingAway, Reason: CloseDrained})
+	}
+	rooms.closeRoom(e.room.ID)
+	return nil
+}
+
+func (e *DrainClose) Validate() error {
+	return nil
+}
+
+func (*DrainClose) Type() string {
+	return "drainclose"
+}
@@ -0,0 +1,48 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrain(t *testing.T) {
+	rooms := newTestRooms()
+	defer close(rooms.done)
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionLocal}).Execute(rooms, owner, zerolog.Nop()))
+	guest := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	rooms.flushChanged()
+	owner.Write.pop()
+	guest.Write.pop()
+
+	missing := &Drain{ID: "other", Response: make(chan bool, 1)}
+	assert.NoError(t, missing.Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.False(t, <-missing.Response)
+
+	drain := &Drain{ID: "room", Response: make(chan bool, 1)}
+	assert.NoError(t, drain.Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.True(t, <-drain.Response)
+	for _, client := range []ClientInfo{owner, guest} {
+		assert.Equal(t, []outgoing.Message{outgoing.Drain{Grace: drainGrace.Milliseconds()}}, client.Write.pop())
+	}
+
+	late := connectTestClient(rooms)
+	assert.Error(t, (&Join{ID: "room"}).Execute(rooms, late, zerolog.Nop()), "draining rooms can't be joined")
+
+	room := rooms.Rooms["room"]
+	assert.NoError(t, (&DrainClose{room: room}).Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.NotContains(t, rooms.Rooms, "room")
+	for _, client := range []ClientInfo{owner, guest} {
+		assert.Equal(t, []outgoing.Message{outgoing.CloseWriter{Code: websocket.CloseGoingAway, Reason: CloseDrained}}, client.Write.pop())
+		assert.NotContains(t, rooms.connected, client.ID)
+	}
+
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionLocal}).Execute(rooms, late, zerolog.Nop()))
+	assert.NoError(t, (&DrainClose{room: room}).Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.Contains(t, rooms.Rooms, "room", "a recreated room is not closed")
+}
@@ -0,0 +1,24 @@
+package ws
+
+import "github.com/rs/zerolog"
+
+// Handoff 将尚未加入房间的客户端从当前分片移除，客户端随后在房间所在的分片重新连接，仅供内部使用
+type Handoff struct{}
+
+func (e *Handoff) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	delete(rooms.connected, current.ID)
+	return nil
+}
+
+func (e *Handoff) Validate() error {
+	return nil
+}
+
+func (*Handoff) Type() string {
+	return "handoff"
+}
+
+// roomEvent 由指定目标房间的事件实现，用于选择处理客户端事件的分片
+type roomEvent interface {
+	roomID() string
+}
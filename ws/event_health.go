@@ -1,10 +1,20 @@
 package ws
 
+import "github.com/rs/zerolog"
+
 type Health struct {
 	Response chan int
 }
 
-func (e *Health) Execute(rooms *Rooms, current ClientInfo) error {
+func (e *Health) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	writeTimeout(e.Response, len(rooms.connected))
 	return nil
 }
+
+func (e *Health) Validate() error {
+	return nil
+}
+
+func (*Health) Type() string {
+	return "health"
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 
 	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 // init 注册hostice事件处理器
@@ -21,7 +21,7 @@ type HostICE outgoing.P2PMessage
 
 // Execute 处理主机发送的ICE候选信息
 // 验证权限并将ICE候选信息转发给对应的客户端
-func (e *HostICE) Execute(rooms *Rooms, current ClientInfo) error {
+func (e *HostICE) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	// 获取当前用户所在的房间
 	room, err := rooms.CurrentRoom(current)
 	if err != nil {
@@ -33,7 +33,7 @@ func (e *HostICE) Execute(rooms *Rooms, current ClientInfo) error {
 
 	if !ok {
 		// 如果会话不存在，记录日志并忽略
-		log.Debug().Str("id", e.SID.String()).Msg("unknown session")
+		logger.Debug().Str("id", e.SID.String()).Msg("unknown session")
 		return nil
 	}
 
@@ -43,7 +43,20 @@ func (e *HostICE) Execute(rooms *Rooms, current ClientInfo) error {
 	}
 
 	// 将ICE候选信息转发给客户端
-	room.Users[session.Client].WriteTimeout(outgoing.HostICE(*e))
+	room.expectAck(rooms, e.SID, current.ID, e.AckID)
+	room.Users[session.Client].Write(outgoing.HostICE(*e))
 
 	return nil
 }
+
+// Validate 校验ICE候选信息消息是否包含会话ID
+func (e *HostICE) Validate() error {
+	if err := validateSID(e.SID); err != nil {
+		return err
+	}
+	return validateAckID(e.AckID)
+}
+
+func (*HostICE) Type() string {
+	return "hostice"
+}
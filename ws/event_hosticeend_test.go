@@ -0,0 +1,40 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestICEEnd_relaysToPeer(t *testing.T) {
+	rooms := newTestRooms()
+	host := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	viewer := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, viewer, zerolog.Nop()))
+	other := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, other, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.newSession(host.ID, viewer.ID, rooms, nil, nil)
+	sid, _ := room.session(host.ID, viewer.ID)
+	host.Write.pop()
+	viewer.Write.pop()
+
+	assert.NoError(t, (&HostICEEnd{SID: sid}).Execute(rooms, host, zerolog.Nop()))
+	assert.Equal(t, []outgoing.Message{outgoing.HostICEEnd{SID: sid}}, viewer.Write.pop())
+
+	assert.NoError(t, (&ClientICEEnd{SID: sid}).Execute(rooms, viewer, zerolog.Nop()))
+	assert.Equal(t, []outgoing.Message{outgoing.ClientICEEnd{SID: sid}}, host.Write.pop())
+
+	assert.Error(t, (&HostICEEnd{SID: sid}).Execute(rooms, viewer, zerolog.Nop()), "only the host ends its candidates")
+	assert.Error(t, (&ClientICEEnd{SID: sid}).Execute(rooms, other, zerolog.Nop()), "only the client ends its candidates")
+	assert.Empty(t, host.Write.pop())
+	assert.Empty(t, viewer.Write.pop())
+
+	assert.NoError(t, (&HostICEEnd{SID: xid.New()}).Execute(rooms, host, zerolog.Nop()), "unknown sessions are ignored")
+	assert.Empty(t, viewer.Write.pop())
+	assert.Error(t, (&ClientICEEnd{}).Validate())
+}
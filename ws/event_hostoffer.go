@@ -4,7 +4,7 @@ import (
 	"fmt"
 
 	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 // init 注册hostoffer事件处理器
@@ -21,19 +21,24 @@ type HostOffer outgoing.P2PMessage
 
 // Execute 处理主机发送的SDP offer
 // 验证权限并将offer转发给对应的客户端
-func (e *HostOffer) Execute(rooms *Rooms, current ClientInfo) error {
+func (e *HostOffer) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	// 获取当前用户所在的房间
 	room, err := rooms.CurrentRoom(current)
 	if err != nil {
 		return err
 	}
 
+	// 过大的会话描述不转发，只通知发送方
+	if sdpTooLarge(rooms, current, e.SID, e.Value, logger) {
+		return nil
+	}
+
 	// 查找对应的会话
 	session, ok := room.Sessions[e.SID]
 
 	if !ok {
 		// 如果会话不存在，记录日志并忽略
-		log.Debug().Str("id", e.SID.String()).Msg("unknown session")
+		logger.Debug().Str("id", e.SID.String()).Msg("unknown session")
 		return nil
 	}
 
@@ -43,7 +48,23 @@ func (e *HostOffer) Execute(rooms *Rooms, current ClientInfo) error {
 	}
 
 	// 将offer转发给客户端
-	room.Users[session.Client].WriteTimeout(outgoing.HostOffer(*e))
+	room.expectAck(rooms, e.SID, current.ID, e.AckID)
+	room.Users[session.Client].Write(outgoing.HostOffer(*e))
 
 	return nil
 }
+
+// Validate 校验offer消息是否包含会话ID和完整的会话描述
+func (e *HostOffer) Validate() error {
+	if err := validateSID(e.SID); err != nil {
+		return err
+	}
+	if err := validateAckID(e.AckID); err != nil {
+		return err
+	}
+	return validateSDP(e.Value)
+}
+
+func (*HostOffer) Type() string {
+	return "hostoffer"
+}
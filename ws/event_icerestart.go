@@ -0,0 +1,99 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+// iceRestartGrace 是ICE重启后旧的TURN凭证仍然有效的时间，在此期间旧的连接可以继续使用
+var iceRestartGrace = 30 * time.Second
+
+// iceRestartDegradedReports 是触发自动ICE重启所需的连续劣化统计次数
+const iceRestartDegradedReports = 3
+
+// ICERestart 让会话的主机重启ICE，仅供内部使用
+type ICERestart struct {
+	Room     string
+	SID      xid.ID
+	Response chan bool // 会话是否存在
+}
+
+func (e *ICERestart) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	room, ok := rooms.Rooms[e.Room]
+	if !ok || room.Sessions[e.SID] == nil {
+		writeTimeout(e.Response, false)
+		return nil
+	}
+	writeTimeout(e.Response, true)
+	return rooms.restartICE(room, e.SID, logger)
+}
+
+func (e *ICERestart) Validate() error {
+	return nil
+}
+
+func (*ICERestart) Type() string {
+	return "icerestart"
+}
+
+// restartICE 为会话签发新的ICE服务器，并通知主机以新的配置重新协商
+// 旧的TURN凭证在iceRestartGrace后撤销，避免重启完成前中断现有连接
+func (r *Rooms) restartICE(room *Room, sid xid.ID, logger zerolog.Logger) error {
+	session := room.Sessions[sid]
+	host, hostOK := room.Users[session.Host]
+	client, clientOK := room.Users[session.Client]
+	if !hostOK || !clientOK {
+		return nil
+	}
+
+	v4, v6, err := r.turnIPs()
+	if err != nil {
+		return err
+	}
+
+	hostPrevious, hostGeneration := session.renewTurn(turnRoleHost)
+	clientPrevious, clientGeneration := session.renewTurn(turnRoleClient)
+	session.degraded = 0
+	session.lastRestart = time.Now()
+	iceRestartTotal.Inc()
+
+	host.Write(outgoing.ICERestart{
+		ID:         sid,
+		ICEServers: room.iceServers(r, sid, host, turnRoleHost, hostGeneration, v4, v6),
+		Initiate:   true,
+	})
+	client.Write(outgoing.ICERestart{
+		ID:         sid,
+		ICEServers: room.iceServers(r, sid, client, turnRoleClient, clientGeneration, v4, v6),
+	})
+	logger.Info().Str("room", room.ID).Str("id", sid.String()).Msg("Restarting ICE")
+
+	if room.Mode == ConnectionTURN {
+		r.revokeTurnLater(sid, turnRoleHost, hostPrevious, iceRestartGrace)
+		r.revokeTurnLater(sid, turnRoleClient, clientPrevious, iceRestartGrace)
+	}
+	return nil
+}
+
+// RestartICE 让房间中的会话重启ICE
+// 返回会话是否存在，以及主循环无法处理请求时的错误信息
+func (r *Rooms) RestartICE(roomID string, sid xid.ID) (bool, string) {
+	shard := r.shardFor(roomID)
+	e := ICERestart{Room: r.normalizeRoomID(roomID), SID: sid, Response: make(chan bool, 1)}
+	select {
+	case shard.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: &e}:
+	case <-shard.done:
+		return false, "main loop stopped"
+	case <-time.After(5 * time.Second):
+		return false, "main loop didn't accept a message within 5 second"
+	}
+	select {
+	case found := <-e.Response:
+		return found, ""
+	case <-time.After(5 * time.Second):
+		return false, "main loop didn't respond to a message within 5 second"
+	}
+}
@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestartICE(t *testing.T) {
+	iceRestartGrace = time.Hour
+	turnServer := &fakeTurn{lookup: map[string]bool{}}
+	rooms := newTestRooms()
+	rooms.turnServer = turnServer
+	rooms.config.ICERestartPacketLoss = 0.2
+	owner := connectTestClient(rooms)
+	guest := connectTestClient(rooms)
+
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionTURN}).Execute(rooms, owner, zerolog.Nop()))
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.Users[owner.ID].Streaming = true
+	room.newSession(owner.ID, guest.ID, rooms, net.IPv4(127, 0, 0, 1), nil)
+	sid, _ := room.session(owner.ID, guest.ID)
+	owner.Write.pop()
+	guest.Write.pop()
+
+	restart := &ICERestart{Room: "room", SID: sid, Response: make(chan bool, 1)}
+	assert.NoError(t, restart.Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.True(t, <-restart.Response)
+
+	hostName := sid.String() + "host1"
+	clientName := sid.String() + "client2"
+	assert.Equal(t, map[string]bool{
+		sid.String() + "host": true, sid.String() + "client": true,
+		hostName: true, clientName: true,
+	}, turnServer.lookup, "old credentials stay valid during the grace period")
+
+	msgs := owner.Write.pop()
+	if assert.Len(t, msgs, 1) {
+		msg := msgs[0].(outgoing.ICERestart)
+		assert.True(t, msg.Initiate)
+		assert.Equal(t, hostName, msg.ICEServers[0].Username)
+	}
+	msgs = guest.Write.pop()
+	if assert.Len(t, msgs, 1) {
+		msg := msgs[0].(outgoing.ICERestart)
+		assert.False(t, msg.Initiate)
+		assert.Equal(t, clientName, msg.ICEServers[0].Username)
+	}
+
+	degraded := &SessionStats{SID: sid, Stats: WebRTCStatsBlob{PacketLoss: 0.5}}
+	for i := 0; i < iceRestartDegradedReports; i++ {
+		assert.NoError(t, degraded.Execute(rooms, guest, zerolog.Nop()))
+	}
+	assert.Empty(t, owner.Write.pop(), "no restart within the grace period")
+
+	room.Sessions[sid].lastRestart = time.Time{}
+	room.Sessions[sid].degraded = 0
+	for i := 0; i < iceRestartDegradedReports; i++ {
+		assert.NoError(t, degraded.Execute(rooms, guest, zerolog.Nop()))
+	}
+	assert.Len(t, owner.Write.pop(), 1, "repeated packet loss restarts ICE")
+	assert.Equal(t, 4, room.Sessions[sid].generation)
+
+	room.closeSession(rooms, sid)
+	assert.Empty(t, turnServer.lookup, "closing the session revokes all generations")
+
+	missing := &ICERestart{Room: "missing", SID: sid, Response: make(chan bool, 1)}
+	assert.NoError(t, missing.Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.False(t, <-missing.Response)
+}
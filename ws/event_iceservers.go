@@ -0,0 +1,87 @@
+package ws
+
+import (
+	"net"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/logger"
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+// standaloneICETTL 是签发给独立客户端的TURN凭证的有效期，内部TURN服务器在到期后撤销凭证
+var standaloneICETTL = time.Hour
+
+// turnRoleStandalone 是独立客户端在TURN用户名中的角色
+const turnRoleStandalone = "standalone"
+
+// ICEServers 为不属于房间的独立WebRTC客户端签发ICE服务器，仅供内部使用
+type ICEServers struct {
+	User     string
+	Addr     net.IP
+	Response chan []outgoing.ICEServer
+}
+
+func (e *ICEServers) Execute(rooms *Rooms, current ClientInfo, log zerolog.Logger) error {
+	v4, v6, err := rooms.turnIPs()
+	if err != nil {
+		writeTimeout(e.Response, nil)
+		return err
+	}
+
+	id := xid.New()
+	username := rooms.turnUsername(id, turnRoleStandalone)
+	name, pw := rooms.turnServer.Credentials(username, e.Addr)
+	ttl := rooms.turnServer.TTL()
+	if ttl == 0 {
+		ttl = standaloneICETTL
+		time.AfterFunc(ttl, func() {
+			rooms.turnServer.Disallow(username)
+		})
+	}
+	standaloneICEServersTotal.Inc()
+	log.Info().Str("user", e.User).Str("ip", logger.IP(e.Addr)).Str("id", id.String()).Msg("Issued standalone ICE servers")
+
+	writeTimeout(e.Response, []outgoing.ICEServer{
+		{URLs: rooms.iceURLs("stun", e.Addr, v4, v6, false)},
+		{
+			URLs:       rooms.iceURLs("turn", e.Addr, v4, v6, true),
+			Credential: pw,
+			Username:   name,
+			TTL:        int64(ttl.Seconds()),
+		},
+	})
+	return nil
+}
+
+func (e *ICEServers) Validate() error {
+	return nil
+}
+
+func (*ICEServers) Type() string {
+	return "iceservers"
+}
+
+// ICEServers 为独立客户端签发ICE服务器，凭证绑定到请求方的IP地址
+// 返回ICE服务器，以及主循环无法处理请求时的错误信息
+func (r *Rooms) ICEServers(user string, addr net.IP) ([]outgoing.ICEServer, string) {
+	shard := r.shardFor(user)
+	e := ICEServers{User: user, Addr: addr, Response: make(chan []outgoing.ICEServer, 1)}
+	select {
+	case shard.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: &e}:
+	case <-shard.done:
+		return nil, "main loop stopped"
+	case <-time.After(5 * time.Second):
+		return nil, "main loop didn't accept a message within 5 second"
+	}
+	select {
+	case servers := <-e.Response:
+		if servers == nil {
+			return nil, "could not get the TURN server addresses"
+		}
+		return servers, ""
+	case <-time.After(5 * time.Second):
+		return nil, "main loop didn't respond to a message within 5 second"
+	}
+}
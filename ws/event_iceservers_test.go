@@ -0,0 +1,36 @@
+package ws
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/config/ipdns"
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestICEServers(t *testing.T) {
+	standaloneICETTL = time.Hour
+	turnServer := &fakeTurn{lookup: map[string]bool{}}
+	rooms := newTestRooms()
+	rooms.turnServer = turnServer
+	rooms.config.TurnIPProvider = &ipdns.Static{V4: net.ParseIP("192.0.2.1")}
+	rooms.config.TurnPorts = []string{"3478"}
+
+	e := &ICEServers{User: "alice", Addr: net.ParseIP("198.51.100.7"), Response: make(chan []outgoing.ICEServer, 1)}
+	assert.NoError(t, e.Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	servers := <-e.Response
+	if assert.Len(t, servers, 2) {
+		assert.Equal(t, []string{"stun:192.0.2.1:3478"}, servers[0].URLs)
+		turn := servers[1]
+		assert.Equal(t, []string{"turn:192.0.2.1:3478", "turn:192.0.2.1:3478?transport=tcp"}, turn.URLs)
+		assert.Contains(t, turnServer.lookup, turn.Username)
+		assert.Equal(t, int64(3600), turn.TTL, "credentials of the internal server are revoked after the ttl")
+	}
+
+	turnServer.ttl = 24 * time.Hour
+	assert.NoError(t, e.Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.Equal(t, int64(86400), (<-e.Response)[1].TTL)
+}
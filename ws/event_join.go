@@ -1,7 +1,13 @@
 package ws
 
 import (
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/util"
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
 )
 
 // init 注册join事件处理器
@@ -15,57 +21,100 @@ func init() {
 // Join 表示用户加入房间的事件
 // 包含要加入的房间ID和用户名信息
 type Join struct {
-	ID       string `json:"id"`       // 要加入的房间ID
-	UserName string `json:"username,omitempty"` // 用户名，可选
+	ID            string `json:"id"`                      // 要加入的房间ID
+	UserName      string `json:"username,omitempty"`      // 用户名，可选
+	RoomDelta     bool   `json:"roomDelta,omitempty"`     // 是否接收只包含变化的房间信息
+	WatchOnDemand bool   `json:"watchOnDemand,omitempty"` // 是否只在watch事件后才创建会话，否则自动观看所有共享
+	Recorder      bool   `json:"recorder,omitempty"`      // 是否是录制程序，开始和停止录制时收到通知
 }
 
 // Execute 处理用户加入房间的逻辑
 // 验证房间存在性，添加用户到房间，并设置相关连接
-func (e *Join) Execute(rooms *Rooms, current ClientInfo) error {
+func (e *Join) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	// 检查用户是否已经在某个房间中
 	if rooms.connected[current.ID] != "" {
 		return fmt.Errorf("cannot join room, you are already in one")
 	}
 
 	// 检查目标房间是否存在
+	e.ID = rooms.normalizeRoomID(e.ID)
 	room, ok := rooms.Rooms[e.ID]
+	if !ok && rooms.isReserved(e.ID) {
+		// 保留房间被排空后在下一次加入时重新创建
+		room, ok = rooms.createReserved(e.ID), true
+	}
 	if !ok {
 		return fmt.Errorf("room with id %s does not exist", e.ID)
 	}
-	
+
+	// 检查房间是否已锁定
+	if room.Locked {
+		return fmt.Errorf("room with id %s is locked", e.ID)
+	}
+
+	// 正在排空的房间即将关闭
+	if room.draining {
+		return fmt.Errorf("room with id %s is draining", e.ID)
+	}
+
+	// 拒绝无效或包含屏蔽词的用户名
+	name, err := rooms.userName(e.UserName)
+	if err != nil {
+		return err
+	}
+
 	// 确定用户名
-	name := e.UserName
 	if current.Authenticated {
 		// 如果用户已认证，使用认证用户名
 		name = current.AuthenticatedUser
 	}
 	if name == "" {
+		// 如果要求用户名，则拒绝没有用户名的加入
+		if rooms.config.RequireUserName {
+			return errors.New("username must be set")
+		}
 		// 如果没有提供用户名，生成随机用户名
 		name = rooms.RandUserName()
 	}
 
-	// 创建用户并添加到房间
-	room.Users[current.ID] = &User{
+	// 创建用户并添加到房间，第一个进入空的保留房间的用户成为房主
+	user := &User{
 		ID:        current.ID,
 		Name:      name,
 		Streaming: false,
-		Owner:     false,
+		Owner:     room.reserved && len(room.Users) == 0,
 		Addr:      current.Addr,
+		delta:     e.RoomDelta,
+		onDemand:  e.WatchOnDemand,
+		recorder:  e.Recorder,
+		joined:    room.nextJoin(),
+		since:     time.Now(),
 		_write:    current.Write,
+		seq:       current.Seq,
+	}
+	room.Users[current.ID] = user
+	if room.welcome != "" {
+		user.pending = append(user.pending, outgoing.Welcome{Message: room.welcome})
 	}
+	rooms.issueResume(user)
 	// 记录用户所在的房间
 	rooms.connected[current.ID] = room.ID
 	// 通知房间内所有用户信息已更改
-	room.notifyInfoChanged()
+	rooms.markChanged(room)
 	// 增加用户加入计数
 	usersJoinedTotal.Inc()
 
 	// 获取TURN服务器的IP地址
-	v4, v6, err := rooms.config.TurnIPProvider.Get()
+	v4, v6, err := rooms.turnIPs()
 	if err != nil {
 		return err
 	}
 
+	// 按需观看的用户通过watch事件创建会话
+	if e.WatchOnDemand {
+		return nil
+	}
+
 	// 为房间中正在流式传输的用户创建新的会话
 	// 这样新加入的用户可以看到已经在共享的屏幕
 	for _, user := range room.Users {
@@ -77,3 +126,17 @@ func (e *Join) Execute(rooms *Rooms, current ClientInfo) error {
 
 	return nil
 }
+
+// Validate 校验加入房间事件的房间ID
+func (e *Join) Validate() error {
+	return util.ValidateRoomID(e.ID)
+}
+
+func (*Join) Type() string {
+	return "join"
+}
+
+// roomID 返回目标房间ID，用于选择处理该客户端的分片
+func (e *Join) roomID() string {
+	return e.ID
+}
@@ -0,0 +1,73 @@
+package ws
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog"
+)
+
+// init 注册lock和unlock事件处理器
+// 在包初始化时被调用，将事件处理函数注册到事件处理系统中
+func init() {
+	register("lock", func() Event {
+		return &Lock{}
+	})
+	register("unlock", func() Event {
+		return &Unlock{}
+	})
+}
+
+// Lock 表示锁定房间的事件
+// 锁定后其他用户无法再加入房间，只有房主可以执行
+type Lock struct{}
+
+// Execute 处理锁定房间事件
+func (e *Lock) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	return setLocked(rooms, current, true)
+}
+
+// Unlock 表示解锁房间的事件
+// 解锁后用户可以重新加入房间，只有房主可以执行
+type Unlock struct{}
+
+// Execute 处理解锁房间事件
+func (e *Unlock) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	return setLocked(rooms, current, false)
+}
+
+// setLocked 更新房间的锁定状态并通知所有用户
+func setLocked(rooms *Rooms, current ClientInfo, locked bool) error {
+	// 获取当前用户所在的房间
+	room, err := rooms.CurrentRoom(current)
+	if err != nil {
+		return err
+	}
+
+	// 只有房主可以锁定或解锁房间
+	if !room.Users[current.ID].Owner {
+		return errors.New("permission denied, only the owner can lock the room")
+	}
+
+	room.Locked = locked
+	// 通知所有用户房间信息已更改
+	rooms.markChanged(room)
+	return nil
+}
+
+// Validate 锁定事件没有参数，无需校验
+func (e *Lock) Validate() error {
+	return nil
+}
+
+func (*Lock) Type() string {
+	return "lock"
+}
+
+// Validate 解锁事件没有参数，无需校验
+func (e *Unlock) Validate() error {
+	return nil
+}
+
+func (*Unlock) Type() string {
+	return "unlock"
+}
@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/config"
+	"github.com/AsterZephyr/Scree-go-AZlearn/config/ipdns"
+	"github.com/AsterZephyr/Scree-go-AZlearn/util"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinLockedRoom(t *testing.T) {
+	rooms := newTestRooms()
+	owner := connectTestClient(rooms)
+	guest := connectTestClient(rooms)
+
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionLocal}).Execute(rooms, owner, zerolog.Nop()))
+	assert.Error(t, (&Lock{}).Execute(rooms, guest, zerolog.Nop()), "guest is not in a room")
+	assert.NoError(t, (&Lock{}).Execute(rooms, owner, zerolog.Nop()))
+	assert.True(t, rooms.Rooms["room"].Locked)
+
+	assert.Error(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	assert.NotContains(t, rooms.Rooms["room"].Users, guest.ID)
+
+	assert.NoError(t, (&Unlock{}).Execute(rooms, owner, zerolog.Nop()))
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	assert.Contains(t, rooms.Rooms["room"].Users, guest.ID)
+
+	assert.Error(t, (&Lock{}).Execute(rooms, guest, zerolog.Nop()), "only the owner may lock")
+}
+
+func newTestRooms() *Rooms {
+	rooms := &Rooms{
+		Rooms:     map[string]*Room{},
+		connected: map[xid.ID]string{},
+		done:      make(chan struct{}),
+		r:         rand.New(rand.NewSource(1)),
+		names:     util.DefaultNames(),
+		turnAddrs: &turnIPCache{},
+		config: config.Config{
+			AuthMode:       config.AuthModeNone,
+			TurnIPProvider: &ipdns.Static{},
+		},
+	}
+	rooms.shards = []*Rooms{rooms}
+	return rooms
+}
+
+func connectTestClient(rooms *Rooms) ClientInfo {
+	info := ClientInfo{ID: xid.New(), Write: newOutbox(), Seq: new(atomic.Uint64)}
+	_ = Connected{}.Execute(rooms, info, zerolog.Nop())
+	return info
+}
+
+func TestRoomIDLowercase(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.config.RoomIDLowercase = true
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "StandUp", Mode: ConnectionLocal}).Execute(rooms, owner, zerolog.Nop()))
+	assert.Contains(t, rooms.Rooms, "standup")
+
+	guest := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "STANDUP"}).Execute(rooms, guest, zerolog.Nop()))
+	assert.Equal(t, "standup", rooms.connected[guest.ID])
+
+	sharded := NewRooms(nil, nil, config.Config{EventLoopShards: 8, RoomIDLowercase: true})
+	assert.Same(t, sharded.shardFor("standup"), sharded.shardFor("StandUp"), "the normalized id selects the shard")
+}
+
+func TestJoin_invalidRoomID(t *testing.T) {
+	assert.Error(t, (&Join{ID: "a/b"}).Validate())
+	assert.Error(t, (&Create{ID: "two words", Mode: ConnectionLocal}).Validate())
+	assert.NoError(t, (&Create{Mode: ConnectionLocal}).Validate(), "the server generates missing ids")
+}
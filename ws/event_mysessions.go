@@ -0,0 +1,48 @@
+package ws
+
+import (
+	"sort"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+)
+
+func init() {
+	register("mysessions", func() Event {
+		return &MySessions{}
+	})
+}
+
+// MySessions 查询当前用户参与的会话，例如界面重新加载后恢复会话状态
+type MySessions struct{}
+
+// Execute 只向请求方发送其作为主机或客户端参与的会话列表
+func (e *MySessions) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	room, err := rooms.CurrentRoom(current)
+	if err != nil {
+		return err
+	}
+
+	sessions := []outgoing.SessionInfo{}
+	for id, session := range room.Sessions {
+		switch current.ID {
+		case session.Host:
+			sessions = append(sessions, outgoing.SessionInfo{ID: id, Peer: session.Client, Role: turnRoleHost})
+		case session.Client:
+			sessions = append(sessions, outgoing.SessionInfo{ID: id, Peer: session.Host, Role: turnRoleClient})
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ID.Compare(sessions[j].ID) < 0
+	})
+	room.Users[current.ID].Write(outgoing.MySessions{Sessions: sessions})
+	return nil
+}
+
+func (e *MySessions) Validate() error {
+	return nil
+}
+
+func (*MySessions) Type() string {
+	return "mysessions"
+}
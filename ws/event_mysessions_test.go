@@ -0,0 +1,41 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySessions(t *testing.T) {
+	rooms := newTestRooms()
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionLocal}).Execute(rooms, owner, zerolog.Nop()))
+	guest := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	other := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, other, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.newSession(owner.ID, guest.ID, rooms, nil, nil)
+	room.newSession(other.ID, owner.ID, rooms, nil, nil)
+	hosted, _ := room.session(owner.ID, guest.ID)
+	watched, _ := room.session(other.ID, owner.ID)
+	owner.Write.pop()
+	guest.Write.pop()
+
+	assert.NoError(t, (&MySessions{}).Execute(rooms, owner, zerolog.Nop()))
+	msgs := owner.Write.pop()
+	if assert.Len(t, msgs, 1) {
+		assert.ElementsMatch(t, []outgoing.SessionInfo{
+			{ID: hosted, Peer: guest.ID, Role: "host"},
+			{ID: watched, Peer: other.ID, Role: "client"},
+		}, msgs[0].(outgoing.MySessions).Sessions)
+	}
+	assert.Empty(t, guest.Write.pop(), "only the caller gets the list")
+
+	assert.NoError(t, (&MySessions{}).Execute(rooms, guest, zerolog.Nop()))
+	assert.Equal(t, []outgoing.Message{outgoing.MySessions{Sessions: []outgoing.SessionInfo{
+		{ID: hosted, Peer: owner.ID, Role: "client"},
+	}}}, guest.Write.pop())
+}
@@ -1,5 +1,12 @@
 package ws
 
+import (
+	"errors"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+)
+
 func init() {
 	register("name", func() Event {
 		return &Name{}
@@ -10,14 +17,33 @@ type Name struct {
 	UserName string `json:"username"`
 }
 
-func (e *Name) Execute(rooms *Rooms, current ClientInfo) error {
+func (e *Name) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	room, err := rooms.CurrentRoom(current)
 	if err != nil {
 		return err
 	}
 
-	room.Users[current.ID].Name = e.UserName
+	if e.UserName == "" && rooms.config.RequireUserName {
+		return errors.New("username must be set")
+	}
+
+	// 名称无效或包含屏蔽词时保留原来的名称，客户端可以重新改名
+	name, err := rooms.userName(e.UserName)
+	if err != nil {
+		current.Write.push(outgoing.Error{Message: err.Error()})
+		return nil
+	}
+
+	room.Users[current.ID].Name = name
+
+	rooms.markChanged(room)
+	return nil
+}
 
-	room.notifyInfoChanged()
+func (e *Name) Validate() error {
 	return nil
 }
+
+func (*Name) Type() string {
+	return "name"
+}
@@ -0,0 +1,63 @@
+package ws
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/util"
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockedWords(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.blocklist = util.NewBlocklist([]string{"otter", "brave"})
+
+	for i := 0; i < 200; i++ {
+		assert.False(t, rooms.blocklist.Blocked(rooms.RandUserName()))
+		assert.False(t, rooms.blocklist.Blocked(rooms.RandRoomName()))
+	}
+
+	host := connectTestClient(rooms)
+	assert.Error(t, (&Create{ID: "Otter-Room", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	assert.Error(t, (&Create{ID: "room", UserName: "Sea Otter", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	assert.NoError(t, (&Create{ID: "room", UserName: "host", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+
+	viewer := connectTestClient(rooms)
+	assert.Error(t, (&Join{ID: "room", UserName: "BRAVE"}).Execute(rooms, viewer, zerolog.Nop()))
+	assert.NoError(t, (&Join{ID: "room", UserName: "viewer"}).Execute(rooms, viewer, zerolog.Nop()))
+	viewer.Write.pop()
+
+	assert.NoError(t, (&Name{UserName: "otterly"}).Execute(rooms, viewer, zerolog.Nop()))
+	assert.Equal(t, "viewer", rooms.Rooms["room"].Users[viewer.ID].Name)
+	msgs := viewer.Write.pop()
+	if assert.Len(t, msgs, 1) {
+		assert.True(t, strings.Contains(msgs[0].(outgoing.Error).Message, "blocked"))
+	}
+
+	assert.NoError(t, (&Name{UserName: "renamed"}).Execute(rooms, viewer, zerolog.Nop()))
+	assert.Equal(t, "renamed", rooms.Rooms["room"].Users[viewer.ID].Name)
+}
+
+func TestUserNameValidation(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.config.MaxUserNameLength = 5
+
+	host := connectTestClient(rooms)
+	assert.Error(t, (&Create{ID: "room", UserName: "\u202eevil", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	assert.NoError(t, (&Create{ID: "room", UserName: "Jose\u0301", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	assert.Equal(t, "José", rooms.Rooms["room"].Users[host.ID].Name)
+
+	viewer := connectTestClient(rooms)
+	assert.Error(t, (&Join{ID: "room", UserName: "viewer"}).Execute(rooms, viewer, zerolog.Nop()))
+	assert.NoError(t, (&Join{ID: "room", UserName: "view"}).Execute(rooms, viewer, zerolog.Nop()))
+	viewer.Write.pop()
+
+	assert.NoError(t, (&Name{UserName: "new\nline"}).Execute(rooms, viewer, zerolog.Nop()))
+	assert.Equal(t, "view", rooms.Rooms["room"].Users[viewer.ID].Name)
+	msgs := viewer.Write.pop()
+	if assert.Len(t, msgs, 1) {
+		assert.True(t, strings.Contains(msgs[0].(outgoing.Error).Message, "invalid character"))
+	}
+}
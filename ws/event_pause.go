@@ -0,0 +1,95 @@
+package ws
+
+import (
+	"errors"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+// init 注册pausestream和resumestream事件处理器
+// 在包初始化时被调用，将事件处理函数注册到事件处理系统中
+func init() {
+	register("pausestream", func() Event {
+		return &PauseStream{}
+	})
+	register("resumestream", func() Event {
+		return &ResumeStream{}
+	})
+}
+
+// PauseStream 表示暂停共享的事件
+// 与停止共享不同，会话和TURN凭证都会保留，恢复时无需重新协商
+type PauseStream struct{}
+
+// Execute 处理暂停共享事件
+func (e *PauseStream) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	return setPaused(rooms, current, true)
+}
+
+// ResumeStream 表示恢复已暂停的共享的事件
+type ResumeStream struct{}
+
+// Execute 处理恢复共享事件
+func (e *ResumeStream) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	return setPaused(rooms, current, false)
+}
+
+// setPaused 更新用户共享的暂停状态，通知所有观看者并更新房间信息
+func setPaused(rooms *Rooms, current ClientInfo, paused bool) error {
+	// 获取当前用户所在的房间
+	room, err := rooms.CurrentRoom(current)
+	if err != nil {
+		return err
+	}
+
+	user := room.Users[current.ID]
+	if !user.Streaming {
+		return errors.New("cannot pause or resume, you are not sharing")
+	}
+	if user.Paused == paused {
+		return nil
+	}
+	user.Paused = paused
+
+	// 通知当前用户作为主机的会话中的观看者
+	for id, session := range room.Sessions {
+		if session.Host != current.ID {
+			continue
+		}
+		if client, ok := room.Users[session.Client]; ok {
+			client.Write(streamPausedMessage(id, paused))
+		}
+	}
+
+	// 通知所有用户房间信息已更改
+	rooms.markChanged(room)
+	return nil
+}
+
+// streamPausedMessage 返回会话的暂停或恢复消息
+func streamPausedMessage(sid xid.ID, paused bool) outgoing.Message {
+	if paused {
+		return outgoing.StreamPaused(sid)
+	}
+	return outgoing.StreamResumed(sid)
+}
+
+// Validate 暂停共享事件没有参数，无需校验
+func (e *PauseStream) Validate() error {
+	return nil
+}
+
+func (*PauseStream) Type() string {
+	return "pausestream"
+}
+
+// Validate 恢复共享事件没有参数，无需校验
+func (e *ResumeStream) Validate() error {
+	return nil
+}
+
+func (*ResumeStream) Type() string {
+	return "resumestream"
+}
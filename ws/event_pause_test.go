@@ -0,0 +1,43 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseStream_keepsSessions(t *testing.T) {
+	rooms := newTestRooms()
+	host := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	viewer := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, viewer, zerolog.Nop()))
+
+	assert.Error(t, (&PauseStream{}).Execute(rooms, host, zerolog.Nop()), "not sharing yet")
+
+	assert.NoError(t, (&StartShare{}).Execute(rooms, host, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	assert.Len(t, room.Sessions, 1)
+	viewer.Write.pop()
+
+	assert.NoError(t, (&PauseStream{}).Execute(rooms, host, zerolog.Nop()))
+	assert.True(t, room.Users[host.ID].Paused)
+	assert.Len(t, room.Sessions, 1)
+	for sid := range room.Sessions {
+		assert.Equal(t, []outgoing.Message{outgoing.StreamPaused(sid)}, viewer.Write.pop())
+	}
+
+	rooms.flushChanged()
+	for _, user := range viewer.Write.pop()[0].(outgoing.Room).Users {
+		assert.Equal(t, user.ID == host.ID, user.Paused)
+	}
+
+	assert.NoError(t, (&ResumeStream{}).Execute(rooms, host, zerolog.Nop()))
+	assert.False(t, room.Users[host.ID].Paused)
+	assert.Len(t, room.Sessions, 1)
+	for sid := range room.Sessions {
+		assert.Equal(t, []outgoing.Message{outgoing.StreamResumed(sid)}, viewer.Write.pop())
+	}
+}
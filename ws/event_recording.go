@@ -0,0 +1,82 @@
+package ws
+
+import (
+	"errors"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+)
+
+// init 注册startrecording和stoprecording事件处理器
+// 在包初始化时被调用，将事件处理函数注册到事件处理系统中
+func init() {
+	register("startrecording", func() Event {
+		return &StartRecording{}
+	})
+	register("stoprecording", func() Event {
+		return &StopRecording{}
+	})
+}
+
+// StartRecording 表示开始录制的事件，只有房主可以执行
+// 服务器本身不录制，只同步录制标记并通知作为观看者加入的录制程序
+type StartRecording struct{}
+
+// Execute 处理开始录制事件
+func (e *StartRecording) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	return setRecording(rooms, current, true)
+}
+
+// StopRecording 表示停止录制的事件，只有房主可以执行
+type StopRecording struct{}
+
+// Execute 处理停止录制事件
+func (e *StopRecording) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	return setRecording(rooms, current, false)
+}
+
+// setRecording 更新房间的录制状态，通知录制程序并更新房间信息
+func setRecording(rooms *Rooms, current ClientInfo, recording bool) error {
+	// 获取当前用户所在的房间
+	room, err := rooms.CurrentRoom(current)
+	if err != nil {
+		return err
+	}
+
+	// 只有房主可以开始或停止录制
+	if !room.Users[current.ID].Owner {
+		return errors.New("permission denied, only the owner can start or stop recording")
+	}
+	if room.Recording == recording {
+		return nil
+	}
+
+	room.Recording = recording
+	// 只通知录制程序，其他用户通过房间信息得知录制状态
+	for _, user := range room.Users {
+		if user.recorder {
+			user.Write(outgoing.Recording{Recording: recording})
+		}
+	}
+	// 通知所有用户房间信息已更改
+	rooms.markChanged(room)
+	return nil
+}
+
+// Validate 开始录制事件没有参数，无需校验
+func (e *StartRecording) Validate() error {
+	return nil
+}
+
+func (*StartRecording) Type() string {
+	return "startrecording"
+}
+
+// Validate 停止录制事件没有参数，无需校验
+func (e *StopRecording) Validate() error {
+	return nil
+}
+
+func (*StopRecording) Type() string {
+	return "stoprecording"
+}
@@ -0,0 +1,38 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecording_ownerOnlyAndNotifiesRecorder(t *testing.T) {
+	rooms := newTestRooms()
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, owner, zerolog.Nop()))
+	recorder := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room", Recorder: true}).Execute(rooms, recorder, zerolog.Nop()))
+	guest := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	rooms.flushChanged()
+	owner.Write.pop()
+	recorder.Write.pop()
+	guest.Write.pop()
+
+	assert.Error(t, (&StartRecording{}).Execute(rooms, guest, zerolog.Nop()), "only the owner may start recording")
+
+	assert.NoError(t, (&StartRecording{}).Execute(rooms, owner, zerolog.Nop()))
+	assert.True(t, rooms.Rooms["room"].Recording)
+	assert.Equal(t, []outgoing.Message{outgoing.Recording{Recording: true}}, recorder.Write.pop())
+	assert.Empty(t, guest.Write.pop(), "others are informed by the room info")
+
+	rooms.flushChanged()
+	assert.True(t, guest.Write.pop()[0].(outgoing.Room).Recording)
+	recorder.Write.pop()
+
+	assert.NoError(t, (&StopRecording{}).Execute(rooms, owner, zerolog.Nop()))
+	assert.False(t, rooms.Rooms["room"].Recording)
+	assert.Equal(t, []outgoing.Message{outgoing.Recording{Recording: false}}, recorder.Write.pop())
+}
@@ -0,0 +1,72 @@
+package ws
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+func init() {
+	register("refreshice", func() Event {
+		return &RefreshICE{}
+	})
+}
+
+// refreshICEOverlap 是续签后旧的TURN凭证仍然有效的时间
+var refreshICEOverlap = time.Minute
+
+// RefreshICE 表示会话的一方在凭证过期前请求新的TURN凭证
+type RefreshICE struct {
+	SID xid.ID `json:"sid"`
+}
+
+// Execute 为请求方签发新的凭证，并重新发送会话信息
+// 旧的凭证在refreshICEOverlap后撤销，已经建立的中继连接不需要重新协商
+func (e *RefreshICE) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	room, err := rooms.CurrentRoom(current)
+	if err != nil {
+		return err
+	}
+
+	session, ok := room.Sessions[e.SID]
+	if !ok {
+		logger.Debug().Str("id", e.SID.String()).Msg("unknown session")
+		return nil
+	}
+	role := turnRoleHost
+	if session.Client == current.ID {
+		role = turnRoleClient
+	} else if session.Host != current.ID {
+		return fmt.Errorf("permission denied for session %s", e.SID)
+	}
+
+	v4, v6, err := rooms.turnIPs()
+	if err != nil {
+		return err
+	}
+
+	previous, generation := session.renewTurn(role)
+	user := room.Users[current.ID]
+	ice := room.iceServers(rooms, e.SID, user, role, generation, v4, v6)
+	if role == turnRoleHost {
+		user.Write(outgoing.HostSession{Peer: session.Client, ID: e.SID, ICEServers: ice})
+	} else {
+		user.Write(outgoing.ClientSession{Peer: session.Host, ID: e.SID, ICEServers: ice})
+	}
+
+	if room.Mode == ConnectionTURN {
+		rooms.revokeTurnLater(e.SID, role, previous, refreshICEOverlap)
+	}
+	return nil
+}
+
+func (e *RefreshICE) Validate() error {
+	return validateSID(e.SID)
+}
+
+func (*RefreshICE) Type() string {
+	return "refreshice"
+}
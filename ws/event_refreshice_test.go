@@ -0,0 +1,49 @@
+package ws
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshICE(t *testing.T) {
+	refreshICEOverlap = time.Hour
+	turnServer := &fakeTurn{lookup: map[string]bool{}, ttl: time.Hour}
+	rooms := newTestRooms()
+	rooms.turnServer = turnServer
+	owner := connectTestClient(rooms)
+	guest := connectTestClient(rooms)
+	other := connectTestClient(rooms)
+
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionTURN}).Execute(rooms, owner, zerolog.Nop()))
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, other, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.newSession(owner.ID, guest.ID, rooms, net.IPv4(127, 0, 0, 1), nil)
+	sid, _ := room.session(owner.ID, guest.ID)
+	owner.Write.pop()
+	guest.Write.pop()
+
+	refresh := &RefreshICE{SID: sid}
+	assert.NoError(t, refresh.Validate())
+	assert.NoError(t, refresh.Execute(rooms, guest, zerolog.Nop()))
+	msgs := guest.Write.pop()
+	if assert.Len(t, msgs, 1) {
+		session := msgs[0].(outgoing.ClientSession)
+		assert.Equal(t, owner.ID, session.Peer)
+		assert.Equal(t, sid.String()+"client1", session.ICEServers[0].Username)
+		assert.Equal(t, int64(3600), session.ICEServers[0].TTL)
+	}
+	assert.Empty(t, owner.Write.pop(), "the peer isn't notified")
+	assert.Len(t, turnServer.lookup, 3, "the old credential stays valid during the overlap")
+
+	assert.Error(t, refresh.Execute(rooms, other, zerolog.Nop()), "not part of the session")
+	assert.Error(t, (&RefreshICE{}).Validate())
+
+	room.closeSession(rooms, sid)
+	assert.Empty(t, turnServer.lookup)
+}
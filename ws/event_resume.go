@@ -0,0 +1,158 @@
+package ws
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// issueResume 配置了DisconnectGrace时为用户签发恢复令牌，令牌在房间信息之后发送
+func (r *Rooms) issueResume(user *User) {
+	if r.config.DisconnectGrace <= 0 {
+		return
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		log.Warn().Err(err).Msg("Could not create resume token")
+		return
+	}
+	user.resume = hex.EncodeToString(raw)
+	user.pending = append(user.pending, outgoing.ResumeToken{Token: user.resume, Grace: r.config.DisconnectGrace.Milliseconds()})
+}
+
+// awaitResume 保留断开连接的用户和会话，grace后仍未恢复时用户离开房间
+// 宽限期内发给用户的消息（例如转发的offer和ICE候选）保存在新的队列中，恢复时交给新连接
+func (r *Rooms) awaitResume(room *Room, user *User, grace time.Duration) {
+	expired := &ResumeExpired{room: room, user: user}
+	user.gone = expired
+	user._write = newOutbox()
+	user._write.limit = r.config.ClientQueueLimit
+	time.AfterFunc(grace, func() {
+		select {
+		case r.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: expired}:
+		case <-r.done:
+		}
+	})
+}
+
+// ResumeExpired 在断开连接的用户的宽限期结束后使其离开房间，仅供内部使用
+type ResumeExpired struct {
+	room *Room
+	user *User
+}
+
+// Execute 用户已恢复、再次断开或房间已关闭时不做任何事
+func (e *ResumeExpired) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	if rooms.Rooms[e.room.ID] != e.room || e.room.Users[e.user.ID] != e.user || e.user.gone != e {
+		return nil
+	}
+	logger.Debug().Str("room", e.room.ID).Str("user", e.user.ID.String()).Msg("Resume grace period expired")
+	rooms.leave(e.room, e.user)
+	return nil
+}
+
+func (e *ResumeExpired) Validate() error {
+	return nil
+}
+
+func (*ResumeExpired) Type() string {
+	return "resumeexpired"
+}
+
+// Resume 将新的连接关联到宽限期内断开连接的用户，仅供内部使用
+// 用户保留原来的ID，因此房间中的会话不需要改变
+type Resume struct {
+	Room     string
+	Token    string
+	Write    *outbox     // 新连接的消息队列
+	Response chan xid.ID // 恢复的用户ID，令牌无效时为空ID
+
+	// Seq 是用户最后收到的消息序列号，在Response之前设置，新连接据此丢弃重发的消息
+	Seq *atomic.Uint64
+}
+
+func (e *Resume) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	room, ok := rooms.Rooms[rooms.normalizeRoomID(e.Room)]
+	if !ok {
+		writeTimeout(e.Response, xid.NilID())
+		return nil
+	}
+	var user *User
+	for _, candidate := range room.Users {
+		if candidate.gone != nil && subtle.ConstantTimeCompare([]byte(candidate.resume), []byte(e.Token)) == 1 {
+			user = candidate
+			break
+		}
+	}
+	if user == nil {
+		writeTimeout(e.Response, xid.NilID())
+		return nil
+	}
+
+	buffered := user._write
+	if buffered.isOverflowed() {
+		// 宽限期内有必须送达的消息丢失，恢复后的会话无法继续，客户端需要重新加入
+		logger.Debug().Str("room", room.ID).Str("user", user.ID.String()).Msg("Messages lost during the grace period, not resuming")
+		rooms.leave(room, user)
+		writeTimeout(e.Response, xid.NilID())
+		return nil
+	}
+
+	user.gone = nil
+	user._write = e.Write
+	user.lastSent = nil
+	if user.seq == nil {
+		user.seq = new(atomic.Uint64)
+	}
+	e.Seq = user.seq
+	rooms.connected[user.ID] = room.ID
+	// 新连接收到的第一条消息必须是房间信息，之后是宽限期内保存的消息
+	room.notifyInfoChanged()
+	for _, msg := range buffered.pop() {
+		switch msg.(type) {
+		case outgoing.Room, outgoing.RoomDelta:
+			// 已过时，新连接刚收到完整的房间信息
+		default:
+			e.Write.push(msg)
+		}
+	}
+	rooms.resumeSessions(room, user)
+	logger.Debug().Str("room", room.ID).Str("user", user.ID.String()).Msg("Resumed user")
+	writeTimeout(e.Response, user.ID)
+	return nil
+}
+
+// resumeSessions 补建用户断开连接期间没有创建的会话
+func (r *Rooms) resumeSessions(room *Room, resumed *User) {
+	v4, v6, err := r.turnIPs()
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not resume sessions")
+		return
+	}
+	for _, user := range room.Users {
+		if user == resumed || user.gone != nil {
+			continue
+		}
+		if _, ok := room.session(user.ID, resumed.ID); !ok && user.Streaming && !resumed.onDemand {
+			room.newSession(user.ID, resumed.ID, r, v4, v6)
+		}
+		if _, ok := room.session(resumed.ID, user.ID); !ok && resumed.Streaming && !user.onDemand {
+			room.newSession(resumed.ID, user.ID, r, v4, v6)
+		}
+	}
+}
+
+func (e *Resume) Validate() error {
+	return nil
+}
+
+func (*Resume) Type() string {
+	return "resume"
+}
@@ -0,0 +1,106 @@
+package ws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/gorilla/websocket"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResume(t *testing.T) {
+	rooms := newTestRooms()
+	defer close(rooms.done)
+	rooms.config.DisconnectGrace = time.Minute
+	rooms.config.RoomIDLowercase = true
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionLocal}).Execute(rooms, owner, zerolog.Nop()))
+	guest := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	rooms.flushChanged()
+	room := rooms.Rooms["room"]
+	user := room.Users[guest.ID]
+	msgs := guest.Write.pop()
+	if assert.Len(t, msgs, 2) {
+		assert.IsType(t, outgoing.Room{}, msgs[0], "the room info comes first")
+		assert.Equal(t, outgoing.ResumeToken{Token: user.resume, Grace: time.Minute.Milliseconds()}, msgs[1])
+	}
+	assert.False(t, guest.duplicate(5))
+	assert.NoError(t, (&StartShare{}).Execute(rooms, owner, zerolog.Nop()))
+	rooms.flushChanged()
+	owner.Write.pop()
+	guest.Write.pop()
+
+	assert.NoError(t, (&Disconnected{Code: websocket.CloseAbnormalClosure}).Execute(rooms, guest, zerolog.Nop()))
+	assert.Same(t, user, room.Users[guest.ID], "the user stays during the grace period")
+	assert.Len(t, room.Sessions, 1, "the sessions stay during the grace period")
+	assert.NotContains(t, rooms.connected, guest.ID)
+	assert.Empty(t, owner.Write.pop(), "the peers are not disrupted")
+	expired := user.gone
+	var sid xid.ID
+	for id := range room.Sessions {
+		sid = id
+	}
+	candidate := &HostICE{SID: sid, Value: []byte(`{"candidate":"candidate:1 1 udp 1 192.0.2.1 5000 typ host"}`)}
+	assert.NoError(t, candidate.Execute(rooms, owner, zerolog.Nop()))
+
+	invalid := &Resume{Room: "room", Token: "wrong", Write: newOutbox(), Response: make(chan xid.ID, 1)}
+	assert.NoError(t, invalid.Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.True(t, (<-invalid.Response).IsNil())
+
+	write := newOutbox()
+	resume := &Resume{Room: "Room", Token: user.resume, Write: write, Response: make(chan xid.ID, 1)}
+	assert.NoError(t, resume.Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.Equal(t, guest.ID, <-resume.Response, "the user keeps its id")
+	assert.Same(t, guest.Seq, resume.Seq, "the new connection continues the sequence numbers")
+	assert.Equal(t, "room", rooms.connected[guest.ID])
+	if msgs := write.pop(); assert.Len(t, msgs, 2) {
+		assert.IsType(t, outgoing.Room{}, msgs[0], "the room info comes first")
+		assert.Equal(t, outgoing.HostICE(*candidate), msgs[1], "messages relayed during the grace period are delivered")
+	}
+
+	assert.NoError(t, expired.Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.Contains(t, room.Users, guest.ID, "an outdated expiry is ignored")
+
+	resumed := ClientInfo{ID: guest.ID, Write: write, Seq: resume.Seq}
+	assert.True(t, resumed.duplicate(5), "messages replayed after resuming are dropped")
+	assert.False(t, resumed.duplicate(6))
+	assert.NoError(t, (&Disconnected{Code: websocket.CloseAbnormalClosure}).Execute(rooms, resumed, zerolog.Nop()))
+	assert.NoError(t, user.gone.Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.NotContains(t, room.Users, guest.ID, "the user leaves after the grace period")
+	assert.Empty(t, room.Sessions)
+	assert.Contains(t, owner.Write.pop(), outgoing.EndShare(sid), "the host is told that the session ended")
+}
+
+func TestResume_lostMessages(t *testing.T) {
+	rooms := newTestRooms()
+	defer close(rooms.done)
+	rooms.config.DisconnectGrace = time.Minute
+	rooms.config.ClientQueueLimit = 1
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionLocal}).Execute(rooms, owner, zerolog.Nop()))
+	guest := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	assert.NoError(t, (&StartShare{}).Execute(rooms, owner, zerolog.Nop()))
+	rooms.flushChanged()
+	room := rooms.Rooms["room"]
+	user := room.Users[guest.ID]
+	var sid xid.ID
+	for id := range room.Sessions {
+		sid = id
+	}
+
+	assert.NoError(t, (&Disconnected{Code: websocket.CloseAbnormalClosure}).Execute(rooms, guest, zerolog.Nop()))
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, (&HostICE{SID: sid, Value: []byte(`{}`)}).Execute(rooms, owner, zerolog.Nop()))
+	}
+
+	resume := &Resume{Room: "room", Token: user.resume, Write: newOutbox(), Response: make(chan xid.ID, 1)}
+	assert.NoError(t, resume.Execute(rooms, ClientInfo{}, zerolog.Nop()))
+	assert.True(t, (<-resume.Response).IsNil(), "a session that lost messages can't be resumed")
+	assert.NotContains(t, room.Users, guest.ID)
+	assert.Empty(t, room.Sessions)
+}
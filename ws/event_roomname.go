@@ -0,0 +1,21 @@
+package ws
+
+import "github.com/rs/zerolog"
+
+// RoomName 在主循环中生成一个未被使用的房间名，仅供内部使用
+type RoomName struct {
+	Response chan string
+}
+
+func (e *RoomName) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	e.Response <- rooms.uniqueRoomName()
+	return nil
+}
+
+func (e *RoomName) Validate() error {
+	return nil
+}
+
+func (*RoomName) Type() string {
+	return "roomname"
+}
@@ -0,0 +1,130 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+// init 注册sessionstats事件处理器
+// 在包初始化时被调用，将事件处理函数注册到事件处理系统中
+func init() {
+	register("sessionstats", func() Event {
+		return &SessionStats{}
+	})
+}
+
+// SessionStats 表示客户端定期上报的会话WebRTC统计信息
+// 服务器只汇总为Prometheus指标，不接触媒体数据
+type SessionStats struct {
+	SID   xid.ID          `json:"sid"`
+	Stats WebRTCStatsBlob `json:"stats"`
+}
+
+// WebRTCStatsBlob 包含会话的通话质量统计
+type WebRTCStatsBlob struct {
+	Bitrate       float64 `json:"bitrate"`       // 比特率，单位bit/s
+	PacketLoss    float64 `json:"packetLoss"`    // 丢包率，0到1之间
+	RTT           float64 `json:"rtt"`           // 往返时间，单位秒
+	CandidateType string  `json:"candidateType"` // 选中的ICE候选类型，例如host、srflx或relay
+	BytesSent     float64 `json:"bytesSent"`     // 客户端在会话中累计发送的字节数
+	BytesReceived float64 `json:"bytesReceived"` // 客户端在会话中累计接收的字节数
+}
+
+// candidateTypes 是允许作为指标标签的ICE候选类型，其他值记为unknown以限制标签数量
+var candidateTypes = map[string]bool{"host": true, "srflx": true, "prflx": true, "relay": true}
+
+// Execute 验证当前用户属于该会话，并更新通话质量指标
+func (e *SessionStats) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	// 获取当前用户所在的房间
+	room, err := rooms.CurrentRoom(current)
+	if err != nil {
+		return err
+	}
+
+	// 查找对应的会话
+	session, ok := room.Sessions[e.SID]
+	if !ok {
+		logger.Debug().Str("id", e.SID.String()).Msg("unknown session")
+		return nil
+	}
+	if session.Host != current.ID && session.Client != current.ID {
+		return fmt.Errorf("permission denied for session %s", e.SID)
+	}
+
+	candidate := e.Stats.CandidateType
+	if !candidateTypes[candidate] {
+		candidate = "unknown"
+	}
+	sessionBitrate.WithLabelValues(candidate).Observe(e.Stats.Bitrate)
+	sessionPacketLoss.WithLabelValues(candidate).Observe(e.Stats.PacketLoss)
+	sessionRTT.WithLabelValues(candidate).Observe(e.Stats.RTT)
+	room.accountBytes(session.reported(current.ID), e.Stats)
+
+	logger.Debug().
+		Str("id", e.SID.String()).
+		Float64("bitrate", e.Stats.Bitrate).
+		Float64("packetLoss", e.Stats.PacketLoss).
+		Float64("rtt", e.Stats.RTT).
+		Str("candidateType", candidate).
+		Msg("Session stats")
+
+	// 连续多次丢包率过高时让主机重启ICE，上次重启后的等待时间内不再重复触发
+	threshold := rooms.config.ICERestartPacketLoss
+	if threshold <= 0 {
+		return nil
+	}
+	if e.Stats.PacketLoss < threshold {
+		session.degraded = 0
+		return nil
+	}
+	session.degraded++
+	if session.degraded < iceRestartDegradedReports || time.Since(session.lastRestart) < iceRestartGrace {
+		return nil
+	}
+	return rooms.restartICE(room, e.SID, logger)
+}
+
+// accountBytes 将客户端上报的累计字节数与上次上报的差值计入房间和全局的流量估算
+// 累计值变小说明客户端重新建立了连接，此时整个值都算作新的流量
+func (r *Room) accountBytes(last *sessionBytes, stats WebRTCStatsBlob) {
+	sent := bytesDelta(last.sent, stats.BytesSent)
+	received := bytesDelta(last.received, stats.BytesReceived)
+	last.sent, last.received = stats.BytesSent, stats.BytesReceived
+
+	r.bytesSent += sent
+	r.bytesReceived += received
+	relayBytesTotal.WithLabelValues("sent").Add(sent)
+	relayBytesTotal.WithLabelValues("received").Add(received)
+}
+
+func bytesDelta(last, current float64) float64 {
+	if current < last {
+		return current
+	}
+	return current - last
+}
+
+// Validate 校验统计信息是否包含会话ID且数值在合理范围内
+func (e *SessionStats) Validate() error {
+	if err := validateSID(e.SID); err != nil {
+		return err
+	}
+	for _, v := range []float64{e.Stats.Bitrate, e.Stats.PacketLoss, e.Stats.RTT, e.Stats.BytesSent, e.Stats.BytesReceived} {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return errors.New("stats must be finite and not negative")
+		}
+	}
+	if e.Stats.PacketLoss > 1 {
+		return errors.New("packetLoss must be between 0 and 1")
+	}
+	return nil
+}
+
+func (*SessionStats) Type() string {
+	return "sessionstats"
+}
@@ -0,0 +1,57 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionStats(t *testing.T) {
+	rooms := newTestRooms()
+	host := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	viewer := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, viewer, zerolog.Nop()))
+	other := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, other, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.newSession(host.ID, viewer.ID, rooms, nil, nil)
+	sid, _ := room.session(host.ID, viewer.ID)
+
+	stats := &SessionStats{SID: sid, Stats: WebRTCStatsBlob{Bitrate: 1_000_000, PacketLoss: 0.01, RTT: 0.05, CandidateType: "bogus"}}
+	assert.NoError(t, stats.Validate())
+	assert.NoError(t, stats.Execute(rooms, viewer, zerolog.Nop()))
+	assert.Equal(t, 1, testutil.CollectAndCount(sessionRTT))
+	assert.Error(t, stats.Execute(rooms, other, zerolog.Nop()), "not part of the session")
+
+	assert.Error(t, (&SessionStats{SID: sid, Stats: WebRTCStatsBlob{PacketLoss: 2}}).Validate())
+	assert.Error(t, (&SessionStats{SID: sid, Stats: WebRTCStatsBlob{RTT: -1}}).Validate())
+}
+
+func TestSessionStats_accountsBytes(t *testing.T) {
+	rooms := newTestRooms()
+	host := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	viewer := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, viewer, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.newSession(host.ID, viewer.ID, rooms, nil, nil)
+	sid, _ := room.session(host.ID, viewer.ID)
+
+	report := func(user ClientInfo, sent, received float64) {
+		stats := &SessionStats{SID: sid, Stats: WebRTCStatsBlob{BytesSent: sent, BytesReceived: received}}
+		assert.NoError(t, stats.Execute(rooms, user, zerolog.Nop()))
+	}
+	before := testutil.ToFloat64(relayBytesTotal.WithLabelValues("sent"))
+	report(host, 1000, 10)
+	report(host, 1500, 20)
+	report(viewer, 5, 1400)
+	// the host reconnected and its counters started again
+	report(host, 300, 5)
+
+	assert.Equal(t, float64(1805), room.bytesSent)
+	assert.Equal(t, float64(1425), room.bytesReceived)
+	assert.Equal(t, float64(1805), testutil.ToFloat64(relayBytesTotal.WithLabelValues("sent"))-before)
+}
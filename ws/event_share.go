@@ -1,5 +1,11 @@
 package ws
 
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
 // init 注册share事件处理器
 // 在包初始化时被调用，将事件处理函数注册到事件处理系统中
 func init() {
@@ -14,7 +20,7 @@ type StartShare struct{}
 
 // Execute 处理开始共享事件
 // 将用户标记为正在流式传输，并为每个其他用户创建WebRTC会话
-func (e *StartShare) Execute(rooms *Rooms, current ClientInfo) error {
+func (e *StartShare) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	// 获取当前用户所在的房间
 	room, err := rooms.CurrentRoom(current)
 	if err != nil {
@@ -23,23 +29,34 @@ func (e *StartShare) Execute(rooms *Rooms, current ClientInfo) error {
 
 	// 将当前用户标记为正在流式传输
 	room.Users[current.ID].Streaming = true
+	room.Users[current.ID].Paused = false
+	room.lastStream = time.Now()
 
 	// 获取TURN服务器的IPv4和IPv6地址
-	v4, v6, err := rooms.config.TurnIPProvider.Get()
+	v4, v6, err := rooms.turnIPs()
 	if err != nil {
 		return err
 	}
 
 	// 为房间中的每个其他用户创建WebRTC会话
-	// 当前用户作为主机，其他用户作为客户端
+	// 当前用户作为主机，其他用户作为客户端，按需观看的用户除外
 	for _, user := range room.Users {
-		if current.ID == user.ID {
+		if current.ID == user.ID || user.onDemand {
 			continue
 		}
 		room.newSession(current.ID, user.ID, rooms, v4, v6)
 	}
 
 	// 通知所有用户房间信息已更改
-	room.notifyInfoChanged()
+	rooms.markChanged(room)
 	return nil
 }
+
+// Validate 开始共享事件没有参数，无需校验
+func (e *StartShare) Validate() error {
+	return nil
+}
+
+func (*StartShare) Type() string {
+	return "share"
+}
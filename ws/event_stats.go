@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"sort"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+// RoomStats 描述一个房间的当前状态，用于管理接口
+type RoomStats struct {
+	ID       string      `json:"id"`
+	Mode     string      `json:"mode"`
+	Locked   bool        `json:"locked"`
+	Sessions int         `json:"sessions"`
+	Users    []UserStats `json:"users"`
+
+	// 根据客户端上报的会话统计估算的流量，服务器本身看不到媒体数据
+	BytesSent     uint64 `json:"bytesSent"`
+	BytesReceived uint64 `json:"bytesReceived"`
+}
+
+// UserStats 描述房间中一个用户的当前状态
+type UserStats struct {
+	ID        xid.ID `json:"id"`
+	Name      string `json:"name"`
+	Owner     bool   `json:"owner"`
+	Streaming bool   `json:"streaming"`
+	Sessions  int    `json:"sessions"` // 用户作为主机的会话数
+}
+
+// Stats 在主循环中收集所有房间的状态，仅供内部使用
+type Stats struct {
+	Response chan []RoomStats
+}
+
+func (e *Stats) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	stats := make([]RoomStats, 0, len(rooms.Rooms))
+	for _, room := range rooms.Rooms {
+		hosted := map[xid.ID]int{}
+		for _, session := range room.Sessions {
+			hosted[session.Host]++
+		}
+		users := make([]UserStats, 0, len(room.Users))
+		for _, user := range room.Users {
+			users = append(users, UserStats{
+				ID:        user.ID,
+				Name:      user.Name,
+				Owner:     user.Owner,
+				Streaming: user.Streaming,
+				Sessions:  hosted[user.ID],
+			})
+		}
+		sort.Slice(users, func(i, j int) bool {
+			return users[i].Name < users[j].Name
+		})
+		stats = append(stats, RoomStats{
+			ID:       room.ID,
+			Mode:     string(room.Mode),
+			Locked:   room.Locked,
+			Sessions: len(room.Sessions),
+			Users:    users,
+
+			BytesSent:     uint64(room.bytesSent),
+			BytesReceived: uint64(room.bytesReceived),
+		})
+	}
+	writeTimeout(e.Response, stats)
+	return nil
+}
+
+func (e *Stats) Validate() error {
+	return nil
+}
+
+func (*Stats) Type() string {
+	return "stats"
+}
@@ -2,8 +2,10 @@ package ws
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
 )
 
 // init 注册stopshare事件处理器
@@ -20,7 +22,7 @@ type StopShare struct{}
 
 // Execute 处理停止屏幕共享的逻辑
 // 更新用户状态，关闭相关会话，并通知其他用户
-func (e *StopShare) Execute(rooms *Rooms, current ClientInfo) error {
+func (e *StopShare) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
 	// 获取当前用户所在的房间
 	room, err := rooms.CurrentRoom(current)
 	if err != nil {
@@ -29,6 +31,8 @@ func (e *StopShare) Execute(rooms *Rooms, current ClientInfo) error {
 
 	// 更新用户的共享状态为false
 	room.Users[current.ID].Streaming = false
+	room.Users[current.ID].Paused = false
+	room.lastStream = time.Now()
 	
 	// 遍历所有会话，关闭当前用户作为主机的会话
 	for id, session := range room.Sessions {
@@ -37,7 +41,7 @@ func (e *StopShare) Execute(rooms *Rooms, current ClientInfo) error {
 			client, ok := room.Users[session.Client]
 			if ok {
 				// 通知客户端共享已结束
-				client.WriteTimeout(outgoing.EndShare(id))
+				client.Write(outgoing.EndShare(id))
 			}
 			// 关闭会话
 			room.closeSession(rooms, id)
@@ -45,6 +49,15 @@ func (e *StopShare) Execute(rooms *Rooms, current ClientInfo) error {
 	}
 
 	// 通知房间内所有用户信息已更改
-	room.notifyInfoChanged()
+	rooms.markChanged(room)
 	return nil
 }
+
+// Validate 停止共享事件没有参数，无需校验
+func (e *StopShare) Validate() error {
+	return nil
+}
+
+func (*StopShare) Type() string {
+	return "stopshare"
+}
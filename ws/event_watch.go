@@ -0,0 +1,100 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+// init 注册watch和unwatch事件处理器
+// 在包初始化时被调用，将事件处理函数注册到事件处理系统中
+func init() {
+	register("watch", func() Event {
+		return &Watch{}
+	})
+	register("unwatch", func() Event {
+		return &Unwatch{}
+	})
+}
+
+// Watch 表示观看指定用户共享的事件
+// 只有在这时才创建与该用户的会话，房间中有很多共享者时避免为每个共享创建会话
+type Watch struct {
+	ID xid.ID `json:"id"` // 要观看的共享者的ID
+}
+
+// Execute 处理观看事件，为共享者和当前用户创建会话
+func (e *Watch) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	room, err := rooms.CurrentRoom(current)
+	if err != nil {
+		return err
+	}
+
+	host, ok := room.Users[e.ID]
+	if !ok || e.ID == current.ID {
+		return fmt.Errorf("user with id %s does not exist", e.ID)
+	}
+	if !host.Streaming {
+		return fmt.Errorf("user with id %s is not sharing", e.ID)
+	}
+	// 已经在观看时忽略重复的请求
+	if _, ok := room.session(e.ID, current.ID); ok {
+		return nil
+	}
+
+	v4, v6, err := rooms.turnIPs()
+	if err != nil {
+		return err
+	}
+	room.newSession(e.ID, current.ID, rooms, v4, v6)
+	return nil
+}
+
+// Unwatch 表示停止观看指定用户共享的事件
+type Unwatch struct {
+	ID xid.ID `json:"id"` // 要停止观看的共享者的ID
+}
+
+// Execute 处理停止观看事件，关闭会话并通知双方
+func (e *Unwatch) Execute(rooms *Rooms, current ClientInfo, logger zerolog.Logger) error {
+	room, err := rooms.CurrentRoom(current)
+	if err != nil {
+		return err
+	}
+
+	id, ok := room.session(e.ID, current.ID)
+	if !ok {
+		return nil
+	}
+	room.Users[e.ID].Write(outgoing.EndShare(id))
+	room.Users[current.ID].Write(outgoing.EndShare(id))
+	room.closeSession(rooms, id)
+	return nil
+}
+
+// Validate 校验观看事件是否包含共享者ID
+func (e *Watch) Validate() error {
+	if e.ID.IsNil() {
+		return errors.New("id must be set")
+	}
+	return nil
+}
+
+func (*Watch) Type() string {
+	return "watch"
+}
+
+// Validate 校验停止观看事件是否包含共享者ID
+func (e *Unwatch) Validate() error {
+	if e.ID.IsNil() {
+		return errors.New("id must be set")
+	}
+	return nil
+}
+
+func (*Unwatch) Type() string {
+	return "unwatch"
+}
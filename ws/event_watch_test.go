@@ -0,0 +1,64 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch_createsSessionOnDemand(t *testing.T) {
+	rooms := newTestRooms()
+	host := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN, WatchOnDemand: true}).Execute(rooms, host, zerolog.Nop()))
+	assert.NoError(t, (&StartShare{}).Execute(rooms, host, zerolog.Nop()))
+
+	viewer := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room", WatchOnDemand: true}).Execute(rooms, viewer, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	assert.Empty(t, room.Sessions, "no session before watch")
+
+	other := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room", WatchOnDemand: true}).Execute(rooms, other, zerolog.Nop()))
+	assert.NoError(t, (&StartShare{}).Execute(rooms, other, zerolog.Nop()))
+	assert.Empty(t, room.Sessions, "on demand viewers don't watch new shares automatically")
+
+	assert.Error(t, (&Watch{ID: viewer.ID}).Execute(rooms, other, zerolog.Nop()), "viewer isn't sharing")
+
+	assert.NoError(t, (&Watch{ID: host.ID}).Execute(rooms, viewer, zerolog.Nop()))
+	assert.NoError(t, (&Watch{ID: host.ID}).Execute(rooms, viewer, zerolog.Nop()))
+	assert.Len(t, room.Sessions, 1)
+	sid, ok := room.session(host.ID, viewer.ID)
+	assert.True(t, ok)
+
+	host.Write.pop()
+	viewer.Write.pop()
+	assert.NoError(t, (&Unwatch{ID: host.ID}).Execute(rooms, viewer, zerolog.Nop()))
+	assert.Empty(t, room.Sessions)
+	assert.Equal(t, []outgoing.Message{outgoing.EndShare(sid)}, host.Write.pop())
+	assert.Equal(t, []outgoing.Message{outgoing.EndShare(sid)}, viewer.Write.pop())
+}
+
+func TestNewSession_maxSessionsPerUser(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.config.MaxSessionsPerUser = 2
+	host := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, host, zerolog.Nop()))
+	assert.NoError(t, (&StartShare{}).Execute(rooms, host, zerolog.Nop()))
+
+	for i := 0; i < 2; i++ {
+		viewer := connectTestClient(rooms)
+		assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, viewer, zerolog.Nop()))
+	}
+	late := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, late, zerolog.Nop()))
+
+	room := rooms.Rooms["room"]
+	assert.Equal(t, 2, room.hostedSessions(host.ID))
+	_, ok := room.session(host.ID, late.ID)
+	assert.False(t, ok)
+	msgs := late.Write.pop()
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, host.ID, msgs[0].(outgoing.SessionRejected).Peer)
+}
@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+)
+
+// outbox 是发往单个客户端的消息队列
+// 写入永远不会阻塞，因此主循环不会被写得慢的客户端拖住，
+// 客户端的写入协程在ready通知后按顺序取出所有等待的消息
+// 队列满时按消息的outgoing.Overflow处理，见push
+type outbox struct {
+	lock       sync.Mutex
+	pending    []outgoing.Message
+	ready      chan struct{} // 有新消息时收到通知，容量为1
+	limit      int           // 最多等待发送的消息数，0表示不限制
+	overflowed bool          // 必须送达的消息超过了limit，写入协程会关闭连接
+}
+
+// newOutbox 创建一个空的消息队列
+func newOutbox() *outbox {
+	return &outbox{ready: make(chan struct{}, 1)}
+}
+
+// push 将消息加入队列并通知写入协程，不会阻塞
+// 合并类型的消息替换队列中同类型的消息；队列已满时丢弃同类型最旧的可丢弃消息，
+// 必须送达的消息则将队列标记为溢出。关闭消息总是加入队列。
+func (o *outbox) push(msg outgoing.Message) {
+	o.lock.Lock()
+	if o.enqueue(msg) {
+		outgoingOverflowTotal.WithLabelValues(outgoing.OverflowOf(msg).String()).Inc()
+	}
+	o.lock.Unlock()
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue 将消息加入队列，返回是否应用了溢出策略，调用方持有lock
+func (o *outbox) enqueue(msg outgoing.Message) bool {
+	policy := outgoing.OverflowOf(msg)
+	if policy == outgoing.OverflowCoalesce {
+		if i := o.index(msg.Type()); i != -1 {
+			o.pending[i] = msg
+			return true
+		}
+	}
+	if _, closing := msg.(outgoing.CloseWriter); closing || o.limit <= 0 || len(o.pending) < o.limit {
+		o.pending = append(o.pending, msg)
+		return false
+	}
+
+	if policy == outgoing.OverflowBlock {
+		o.overflowed = true
+		return true
+	}
+	// 没有同类型的旧消息时丢弃新消息本身
+	if i := o.index(msg.Type()); i != -1 {
+		o.pending = append(slices.Delete(o.pending, i, i+1), msg)
+	}
+	return true
+}
+
+// index 返回队列中第一条给定类型的消息的位置，没有时返回-1
+func (o *outbox) index(kind string) int {
+	return slices.IndexFunc(o.pending, func(pending outgoing.Message) bool {
+		return pending.Type() == kind
+	})
+}
+
+// pop 取出所有等待的消息
+func (o *outbox) pop() []outgoing.Message {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	msgs := o.pending
+	o.pending = nil
+	return msgs
+}
+
+// isOverflowed 返回是否有必须送达的消息因队列已满无法加入
+func (o *outbox) isOverflowed() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.overflowed
+}
@@ -0,0 +1,49 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutbox_pushDoesNotBlock(t *testing.T) {
+	box := newOutbox()
+	// nobody reads the outbox, a channel based write would block here.
+	for i := 0; i < 100; i++ {
+		box.push(outgoing.EndShare{})
+	}
+	box.push(outgoing.CloseWriter{Code: 1000, Reason: "done"})
+
+	<-box.ready
+	msgs := box.pop()
+	assert.Len(t, msgs, 101)
+	assert.Equal(t, outgoing.CloseWriter{Code: 1000, Reason: "done"}, msgs[100])
+	assert.Empty(t, box.pop())
+}
+
+func TestOutbox_overflowPolicies(t *testing.T) {
+	box := newOutbox()
+	box.limit = 3
+	box.push(outgoing.Room{ID: "room", Locked: false})
+	box.push(outgoing.Error{Message: "first"})
+	box.push(outgoing.Room{ID: "room", Locked: true})
+	assert.Equal(t, []outgoing.Message{
+		outgoing.Room{ID: "room", Locked: true},
+		outgoing.Error{Message: "first"},
+	}, box.pending, "room updates are coalesced in place")
+
+	box.push(outgoing.EndShare{})
+	box.push(outgoing.Error{Message: "second"})
+	assert.Equal(t, []outgoing.Message{
+		outgoing.Room{ID: "room", Locked: true},
+		outgoing.EndShare{},
+		outgoing.Error{Message: "second"},
+	}, box.pending, "the oldest error is dropped when the queue is full")
+	assert.False(t, box.isOverflowed())
+
+	box.push(outgoing.HostOffer{})
+	assert.True(t, box.isOverflowed(), "signaling messages can't be dropped")
+	box.push(outgoing.CloseWriter{Code: 1000})
+	assert.Len(t, box.pop(), 4, "close messages are always queued")
+}
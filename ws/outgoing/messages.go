@@ -11,15 +11,18 @@ type Message interface {
 }
 
 type Room struct {
-	ID    string         `json:"id"`
-	Mode  ConnectionMode `json:"mode"`
-	Users []User         `json:"users"`
+	ID        string         `json:"id"`
+	Mode      ConnectionMode `json:"mode"`
+	Locked    bool           `json:"locked"`
+	Recording bool           `json:"recording"`
+	Users     []User         `json:"users"`
 }
 
 type User struct {
 	ID        xid.ID `json:"id"`
 	Name      string `json:"name"`
 	Streaming bool   `json:"streaming"`
+	Paused    bool   `json:"paused"`
 	You       bool   `json:"you"`
 	Owner     bool   `json:"owner"`
 }
@@ -28,6 +31,21 @@ func (Room) Type() string {
 	return "room"
 }
 
+// RoomDelta only contains the users that changed since the last Room or
+// RoomDelta sent to the client. It's only sent to clients that opted in.
+type RoomDelta struct {
+	ID        string   `json:"id"`
+	Locked    bool     `json:"locked"`
+	Recording bool     `json:"recording"`
+	Added     []User   `json:"added,omitempty"`
+	Changed   []User   `json:"changed,omitempty"`
+	Removed   []xid.ID `json:"removed,omitempty"`
+}
+
+func (RoomDelta) Type() string {
+	return "roomdelta"
+}
+
 type HostSession struct {
 	ID         xid.ID      `json:"id"`
 	Peer       xid.ID      `json:"peer"`
@@ -48,15 +66,50 @@ func (ClientSession) Type() string {
 	return "clientsession"
 }
 
+// ICERestart tells both peers of a session to use new ICE servers. The host
+// restarts ICE by sending a new offer when Initiate is set.
+type ICERestart struct {
+	ID         xid.ID      `json:"id"`
+	ICEServers []ICEServer `json:"iceServers"`
+	Initiate   bool        `json:"initiate"`
+}
+
+func (ICERestart) Type() string {
+	return "icerestart"
+}
+
+// MySessions lists the sessions the receiver takes part in.
+type MySessions struct {
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+func (MySessions) Type() string {
+	return "mysessions"
+}
+
+// SessionInfo describes a session from the view of one of its peers. Role is
+// host if the peer shares its screen in the session, client otherwise.
+type SessionInfo struct {
+	ID   xid.ID `json:"id"`
+	Peer xid.ID `json:"peer"`
+	Role string `json:"role"`
+}
+
 type ICEServer struct {
 	URLs       []string `json:"urls"`
 	Credential string   `json:"credential"`
 	Username   string   `json:"username"`
+	// TTL is the number of seconds the credential stays valid, 0 if it is
+	// valid until the session ends. Clients renew it with refreshice.
+	TTL int64 `json:"ttl,omitempty"`
 }
 
 type P2PMessage struct {
 	SID   xid.ID          `json:"sid"`
 	Value json.RawMessage `json:"value"`
+	// AckID is optional, when set the receiver confirms the message with an
+	// ack and the sender is notified about the delivery.
+	AckID string `json:"ackId,omitempty"`
 }
 
 type HostICE P2PMessage
@@ -83,12 +136,134 @@ func (HostOffer) Type() string {
 	return "hostoffer"
 }
 
+// DataChannelOffer renegotiates an existing session to add a DataChannel,
+// it can be sent by the host or the client of the session.
+type DataChannelOffer P2PMessage
+
+func (DataChannelOffer) Type() string {
+	return "datachannel-offer"
+}
+
+type DataChannelAnswer P2PMessage
+
+func (DataChannelAnswer) Type() string {
+	return "datachannel-answer"
+}
+
+// ICEEnd marks that a peer finished gathering ICE candidates.
+type ICEEnd struct {
+	SID xid.ID `json:"sid"`
+}
+
+type HostICEEnd ICEEnd
+
+func (HostICEEnd) Type() string {
+	return "hosticeend"
+}
+
+type ClientICEEnd ICEEnd
+
+func (ClientICEEnd) Type() string {
+	return "clienticeend"
+}
+
+// Recording is sent to recorders in the room when the owner starts or stops
+// the recording.
+type Recording struct {
+	Recording bool `json:"recording"`
+}
+
+func (Recording) Type() string {
+	return "recording"
+}
+
+// Welcome is sent once to a user that joined a room with a welcome message.
+type Welcome struct {
+	Message string `json:"message"`
+}
+
+func (Welcome) Type() string {
+	return "welcome"
+}
+
+// ResumeToken is sent once after joining a room when a disconnect grace
+// period is configured. A client that lost its connection may reconnect to
+// /stream?room=<id>&resume=<token> within GraceMillis to keep its sessions.
+type ResumeToken struct {
+	Token string `json:"token"`
+	Grace int64  `json:"graceMillis"`
+}
+
+func (ResumeToken) Type() string {
+	return "resumetoken"
+}
+
+// Drain asks the client to reconnect, the room is closed after Grace
+// milliseconds. Reconnecting through the load balancer moves the room to
+// another instance.
+type Drain struct {
+	Grace int64 `json:"graceMillis"`
+}
+
+func (Drain) Type() string {
+	return "drain"
+}
+
+// Ack tells the sender of a P2PMessage with an AckID whether the receiver
+// confirmed the message in time.
+type Ack struct {
+	SID       xid.ID `json:"sid"`
+	AckID     string `json:"ackId"`
+	Delivered bool   `json:"delivered"`
+}
+
+func (Ack) Type() string {
+	return "ack"
+}
+
+// Error informs the client about a rejected message, the connection stays
+// open.
+type Error struct {
+	Message string `json:"message"`
+}
+
+func (Error) Type() string {
+	return "Error"
+}
+
 type EndShare xid.ID
 
 func (EndShare) Type() string {
 	return "endshare"
 }
 
+// StreamPaused tells the viewer of a session that the host paused the
+// stream, the session stays open.
+type StreamPaused xid.ID
+
+func (StreamPaused) Type() string {
+	return "streampaused"
+}
+
+// StreamResumed tells the viewer of a session that the host resumed the
+// paused stream.
+type StreamResumed xid.ID
+
+func (StreamResumed) Type() string {
+	return "streamresumed"
+}
+
+// SessionRejected tells a viewer that no session was created because the
+// host already shares to the maximum number of viewers.
+type SessionRejected struct {
+	Peer   xid.ID `json:"peer"`
+	Reason string `json:"reason"`
+}
+
+func (SessionRejected) Type() string {
+	return "sessionrejected"
+}
+
 type ConnectionMode string
 
 const (
@@ -0,0 +1,59 @@
+package outgoing
+
+// Overflow defines how a message is queued when the queue of a client is
+// full, because the client reads slower than messages are sent to it.
+type Overflow int
+
+const (
+	// OverflowBlock messages must be delivered, e.g. offers, answers and ice
+	// candidates. A client that can't keep up is disconnected.
+	OverflowBlock Overflow = iota
+	// OverflowDropOldest messages are informational. The oldest queued
+	// message of the same type is dropped to make room.
+	OverflowDropOldest
+	// OverflowCoalesce messages describe the latest state. A queued message of
+	// the same type is replaced, even if the queue isn't full.
+	OverflowCoalesce
+)
+
+// String returns the name used in logs and metric labels.
+func (o Overflow) String() string {
+	switch o {
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowCoalesce:
+		return "coalesce"
+	default:
+		return "block"
+	}
+}
+
+// Overflowing is implemented by messages with a policy other than
+// OverflowBlock.
+type Overflowing interface {
+	Overflow() Overflow
+}
+
+// OverflowOf returns the overflow policy of msg.
+func OverflowOf(msg Message) Overflow {
+	if o, ok := msg.(Overflowing); ok {
+		return o.Overflow()
+	}
+	return OverflowBlock
+}
+
+func (Room) Overflow() Overflow {
+	return OverflowCoalesce
+}
+
+func (Recording) Overflow() Overflow {
+	return OverflowCoalesce
+}
+
+func (Error) Overflow() Overflow {
+	return OverflowDropOldest
+}
+
+func (SessionRejected) Overflow() Overflow {
+	return OverflowDropOldest
+}
@@ -30,4 +30,73 @@ var (
 		Name: "screego_session_closed_total",
 		Help: "The total number of sessions closed",
 	})
+	sessionRejectedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "screego_session_rejected_total",
+		Help: "The total number of sessions rejected because the host reached the session limit",
+	})
+	relayBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "screego_relay_bytes_total",
+		Help: "The estimated number of bytes sent and received by clients, derived from their session stats reports",
+	}, []string{"direction"})
+	standaloneICEServersTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "screego_standalone_ice_servers_total",
+		Help: "The total number of ICE servers issued to standalone clients via /ice-servers",
+	})
+	iceRestartTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "screego_ice_restart_total",
+		Help: "The total number of ICE restarts initiated by the server",
+	})
+	sessionBitrate = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "screego_session_bitrate_bits",
+		Help:    "The bitrate of sessions in bit/s as reported by the clients",
+		Buckets: prometheus.ExponentialBuckets(64_000, 2, 10),
+	}, []string{"candidate_type"})
+	sessionPacketLoss = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "screego_session_packet_loss_ratio",
+		Help:    "The packet loss of sessions as reported by the clients",
+		Buckets: []float64{0, 0.001, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5},
+	}, []string{"candidate_type"})
+	sessionRTT = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "screego_session_rtt_seconds",
+		Help:    "The round trip time of sessions as reported by the clients",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.2, 0.3, 0.5, 1, 2},
+	}, []string{"candidate_type"})
+	roomLifetimeSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "screego_room_lifetime_seconds",
+		Help:    "The time between creating and closing a room",
+		Buckets: []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 86400},
+	}, []string{"mode"})
+	userSessionSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "screego_user_session_seconds",
+		Help:    "The time users stayed in a room",
+		Buckets: []float64{10, 60, 300, 900, 1800, 3600, 7200, 14400, 28800},
+	}, []string{"mode"})
+	outgoingOverflowTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "screego_outgoing_overflow_total",
+		Help: "The total number of outgoing messages handled by their overflow policy, block means a client was disconnected",
+	}, []string{"policy"})
+	eventQueueLength = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "screego_event_queue_length",
+		Help: "The number of messages waiting to be processed by the event loop",
+	})
+	connectedClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "screego_connected_clients",
+		Help: "The number of open WebSocket connections",
+	})
+	eventQueueRejectedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "screego_event_queue_rejected_total",
+		Help: "The total number of WebSocket upgrades rejected because the event queue was above its high-water mark",
+	})
+	connectionsByCountry = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "screego_connections_by_country_total",
+		Help: "The total number of WebSocket connections by country, only collected if SCREEGO_GEO_IP_DATABASE is set",
+	}, []string{"country"})
+	messageDecodeErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "screego_message_decode_errors_total",
+		Help: "The total number of incoming WebSocket messages that could not be decoded, by kind: read, binary, malformed_json, unknown_type, bad_payload or invalid_payload",
+	}, []string{"kind"})
+	originRejectedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "screego_origin_rejected_total",
+		Help: "The total number of WebSocket upgrades rejected because of the origin",
+	})
 )
@@ -1,10 +1,14 @@
 package ws
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"sort"
+	"sync"
 
 	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
 )
@@ -12,20 +16,45 @@ import (
 // Typed 表示一个带类型的WebSocket消息
 // 用于在JSON序列化和反序列化过程中保留消息类型信息
 type Typed struct {
-	Type    string          `json:"type"`    // 消息类型，用于标识不同种类的消息
-	Payload json.RawMessage `json:"payload"` // 消息内容，使用原始JSON格式存储
+	Type    string          `json:"type"`          // 消息类型，用于标识不同种类的消息
+	Payload json.RawMessage `json:"payload"`       // 消息内容，使用原始JSON格式存储
+	Seq     uint64          `json:"seq,omitempty"` // 可选的递增序列号，用于丢弃重复的消息
 }
 
+// encoder 是可复用的JSON编码器和它写入的缓冲区
+type encoder struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+// encoders 复用发送消息时使用的编码器，减少每条消息的内存分配
+var encoders = sync.Pool{New: func() interface{} {
+	e := &encoder{}
+	e.enc = json.NewEncoder(&e.buf)
+	return e
+}}
+
+// buffers 复用读取消息时使用的缓冲区，替代每条消息新建的json.Decoder
+var buffers = sync.Pool{New: func() interface{} {
+	return &bytes.Buffer{}
+}}
+
+// maxPooledBuffer 超过此大小的缓冲区不放回池中，避免个别大消息长期占用内存
+const maxPooledBuffer = 64 * 1024
+
 // ToTypedOutgoing 将outgoing包中的消息转换为带类型的WebSocket消息
 // 这个函数用于准备发送到客户端的消息
 // 参数outgoing是要发送的消息对象
 // 返回转换后的Typed对象和可能的错误
 func ToTypedOutgoing(outgoing outgoing.Message) (Typed, error) {
-	// 将消息对象序列化为JSON
-	payload, err := json.Marshal(outgoing)
-	if err != nil {
+	// 使用池中的编码器将消息对象序列化为JSON
+	e := encoders.Get().(*encoder)
+	defer putEncoder(e)
+	if err := e.enc.Encode(outgoing); err != nil {
 		return Typed{}, err
 	}
+	// Encode会追加换行符，载荷需要拷贝，因为缓冲区会被复用
+	payload := append(json.RawMessage(nil), bytes.TrimSuffix(e.buf.Bytes(), []byte("\n"))...)
 	// 创建并返回带类型的消息
 	return Typed{
 		Type:    outgoing.Type(), // 获取消息类型
@@ -36,39 +65,105 @@ func ToTypedOutgoing(outgoing outgoing.Message) (Typed, error) {
 // ReadTypedIncoming 从读取器中解析带类型的WebSocket消息
 // 并创建对应的事件对象
 // 参数r是包含JSON消息的读取器
-// 返回解析后的事件对象和可能的错误
-func ReadTypedIncoming(r io.Reader) (Event, error) {
+// 返回解析后的事件对象、消息的序列号（未设置时为0）和可能的错误
+func ReadTypedIncoming(r io.Reader) (Event, uint64, error) {
+	buf := buffers.Get().(*bytes.Buffer)
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(r); err != nil {
+		messageDecodeErrorsTotal.WithLabelValues("read").Inc()
+		return nil, 0, fmt.Errorf("%s e", err)
+	}
+
 	typed := Typed{}
-	// 从读取器解码JSON到Typed结构体
-	if err := json.NewDecoder(r).Decode(&typed); err != nil {
-		return nil, fmt.Errorf("%s e", err)
+	// 解码JSON到Typed结构体，Payload会被拷贝，因此缓冲区可以安全复用
+	if err := json.Unmarshal(buf.Bytes(), &typed); err != nil {
+		messageDecodeErrorsTotal.WithLabelValues("malformed_json").Inc()
+		return nil, 0, fmt.Errorf("%s e", err)
 	}
 
-	// 查找消息类型对应的事件创建函数
-	create, ok := provider[typed.Type]
+	// 查找消息类型对应的事件对象池
+	pool, ok := events[typed.Type]
 
 	if !ok {
-		return nil, errors.New("cannot handle " + typed.Type)
+		messageDecodeErrorsTotal.WithLabelValues("unknown_type").Inc()
+		return nil, 0, errors.New("cannot handle " + typed.Type)
 	}
 
-	// 创建对应类型的事件对象
-	payload := create()
+	// 从池中取出对应类型的空事件对象
+	payload := pool.Get().(Event)
 
 	// 将JSON载荷解码到事件对象
 	if err := json.Unmarshal(typed.Payload, payload); err != nil {
-		return nil, fmt.Errorf("incoming payload %s", err)
+		releaseEvent(payload)
+		messageDecodeErrorsTotal.WithLabelValues("bad_payload").Inc()
+		return nil, 0, fmt.Errorf("incoming payload %s", err)
+	}
+
+	// 校验事件内容，尽早拒绝不合法的消息
+	if err := payload.Validate(); err != nil {
+		releaseEvent(payload)
+		messageDecodeErrorsTotal.WithLabelValues("invalid_payload").Inc()
+		return nil, 0, fmt.Errorf("invalid %s payload: %s", typed.Type, err)
+	}
+	return payload, typed.Seq, nil
+}
+
+// putEncoder 清空编码器的缓冲区并放回池中
+func putEncoder(e *encoder) {
+	if e.buf.Cap() > maxPooledBuffer {
+		return
 	}
-	return payload, nil
+	e.buf.Reset()
+	encoders.Put(e)
+}
+
+// putBuffer 清空缓冲区并放回池中
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	buffers.Put(buf)
 }
 
 // provider 存储所有已注册的事件类型和对应的创建函数
 // 键是事件类型字符串，值是创建对应事件对象的函数
 var provider = map[string]func() Event{}
 
+// events 为每个已注册的事件类型复用解码后的事件对象，减少每条消息的内存分配
+var events = map[string]*sync.Pool{}
+
 // register 注册一个事件类型和对应的创建函数
 // 这个函数在各个事件类型的init函数中被调用
 // 参数t是事件类型字符串
 // 参数incoming是创建事件对象的函数
 func register(t string, incoming func() Event) {
 	provider[t] = incoming
+	events[t] = &sync.Pool{New: func() interface{} {
+		return incoming()
+	}}
+}
+
+// releaseEvent 将处理完的事件清零后放回对象池，之后不能再使用该事件
+// 事件处理器只能拷贝事件的值，不能保留事件指针。清零会丢弃切片等引用，
+// 因此拷贝出去的值（例如发给对端的SDP）不会被之后的解码覆盖。
+// 内部事件没有对象池，会被忽略。
+func releaseEvent(e Event) {
+	pool, ok := events[e.Type()]
+	if !ok {
+		return
+	}
+	reflect.ValueOf(e).Elem().SetZero()
+	pool.Put(e)
+}
+
+// RegisteredEventTypes 返回所有已注册的事件类型
+// 返回的是排序后的副本，客户端可以用它检测服务器支持的功能
+func RegisteredEventTypes() []string {
+	types := make([]string, 0, len(provider))
+	for t := range provider {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
 }
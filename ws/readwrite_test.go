@@ -0,0 +1,130 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadTypedIncoming_validates(t *testing.T) {
+	valid := `{"type":"hostoffer","seq":3,"payload":{"sid":"9m4e2mr0ui3e8a215n4g","value":{"type":"offer","sdp":"v=0"}}}`
+	event, seq, err := ReadTypedIncoming(strings.NewReader(valid))
+	assert.NoError(t, err)
+	assert.IsType(t, &HostOffer{}, event)
+	assert.Equal(t, uint64(3), seq)
+
+	for name, msg := range map[string]string{
+		"missing sid":     `{"type":"hostoffer","payload":{"value":{"type":"offer","sdp":"v=0"}}}`,
+		"missing sdp":     `{"type":"clientanswer","payload":{"sid":"9m4e2mr0ui3e8a215n4g","value":{"type":"answer"}}}`,
+		"null value":      `{"type":"clientanswer","payload":{"sid":"9m4e2mr0ui3e8a215n4g","value":null}}`,
+		"missing room id": `{"type":"join","payload":{}}`,
+		"invalid mode":    `{"type":"create","payload":{"id":"room","mode":"relay"}}`,
+	} {
+		_, _, err := ReadTypedIncoming(strings.NewReader(msg))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestReadTypedIncoming_countsDecodeErrors(t *testing.T) {
+	for kind, msg := range map[string]string{
+		"malformed_json":  `{"type":`,
+		"unknown_type":    `{"type":"nope","payload":{}}`,
+		"bad_payload":     `{"type":"join","payload":{"id":5}}`,
+		"invalid_payload": `{"type":"join","payload":{}}`,
+	} {
+		before := testutil.ToFloat64(messageDecodeErrorsTotal.WithLabelValues(kind))
+		_, _, err := ReadTypedIncoming(strings.NewReader(msg))
+		assert.Error(t, err, kind)
+		assert.Equal(t, before+1, testutil.ToFloat64(messageDecodeErrorsTotal.WithLabelValues(kind)), kind)
+	}
+}
+
+func TestToTypedOutgoing_matchesMarshal(t *testing.T) {
+	msg := outgoing.HostICE{SID: xid.New(), Value: []byte(`{"candidate":"<a&b>"}`)}
+	for i := 0; i < 3; i++ {
+		typed, err := ToTypedOutgoing(msg)
+		assert.NoError(t, err)
+		expected, err := json.Marshal(msg)
+		assert.NoError(t, err)
+		assert.Equal(t, "hostice", typed.Type)
+		assert.Equal(t, string(expected), string(typed.Payload))
+	}
+}
+
+func TestEventType_matchesRegistration(t *testing.T) {
+	for _, name := range RegisteredEventTypes() {
+		assert.Equal(t, name, provider[name]().Type())
+	}
+}
+
+func TestReleaseEvent_resetsEvent(t *testing.T) {
+	msg := `{"type":"hostoffer","payload":{"sid":"9m4e2mr0ui3e8a215n4g","value":{"type":"offer","sdp":"v=0"}}}`
+	event, _, err := ReadTypedIncoming(strings.NewReader(msg))
+	assert.NoError(t, err)
+	copied := outgoing.HostOffer(*event.(*HostOffer))
+	releaseEvent(event)
+	assert.Equal(t, HostOffer{}, *event.(*HostOffer))
+
+	other := `{"type":"hostoffer","payload":{"sid":"9m4e2mr0ui3e8a215n4g","value":{"type":"offer","sdp":"v=1"}}}`
+	for i := 0; i < 10; i++ {
+		event, _, err := ReadTypedIncoming(strings.NewReader(other))
+		assert.NoError(t, err)
+		releaseEvent(event)
+	}
+	// values copied during Execute must not be overwritten by later messages.
+	assert.JSONEq(t, `{"type":"offer","sdp":"v=0"}`, string(copied.Value))
+}
+
+func BenchmarkReadTypedIncoming(b *testing.B) {
+	msg := `{"type":"hostice","seq":3,"payload":{"sid":"9m4e2mr0ui3e8a215n4g","value":{"candidate":"candidate:1 1 udp 2122260223 192.168.1.2 54321 typ host","sdpMid":"0","sdpMLineIndex":0}}}`
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ReadTypedIncoming(strings.NewReader(msg)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadTypedIncoming_release(b *testing.B) {
+	msg := `{"type":"hostice","seq":3,"payload":{"sid":"9m4e2mr0ui3e8a215n4g","value":{"candidate":"candidate:1 1 udp 2122260223 192.168.1.2 54321 typ host","sdpMid":"0","sdpMLineIndex":0}}}`
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		event, _, err := ReadTypedIncoming(strings.NewReader(msg))
+		if err != nil {
+			b.Fatal(err)
+		}
+		releaseEvent(event)
+	}
+}
+
+func BenchmarkToTypedOutgoing(b *testing.B) {
+	msg := outgoing.HostICE{SID: xid.New(), Value: []byte(`{"candidate":"candidate:1 1 udp 2122260223 192.168.1.2 54321 typ host","sdpMid":"0","sdpMLineIndex":0}`)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ToTypedOutgoing(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEventType(b *testing.B) {
+	var event Event = &HostICE{}
+	b.Run("sprintf", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = fmt.Sprintf("%T", event)
+		}
+	})
+	b.Run("type", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = event.Type()
+		}
+	})
+}
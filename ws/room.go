@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/AsterZephyr/Scree-go-AZlearn/config"
+	"github.com/AsterZephyr/Scree-go-AZlearn/logger"
 	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog/log"
@@ -29,8 +31,21 @@ type Room struct {
 	ID                string                  // 房间唯一标识符
 	CloseOnOwnerLeave bool                    // 房主离开时是否关闭房间
 	Mode              ConnectionMode          // 房间使用的连接模式
+	Locked            bool                    // 房间是否已锁定，锁定后不允许新用户加入
+	Recording         bool                    // 房主是否标记了正在录制
 	Users             map[xid.ID]*User        // 房间中的用户映射
 	Sessions          map[xid.ID]*RoomSession // 活跃的WebRTC会话映射
+	turnSessions      map[xid.ID]int          // 签发过TURN凭证的会话及其最新的凭证代数，房间关闭时据此清理遗留的凭证
+	acks              map[pendingAck]xid.ID   // 等待确认的点对点消息及其发送方
+	changed           bool                    // 房间信息已更改但还没有通知用户，见Rooms.markChanged
+	joins             uint64                  // 加入过房间的用户数，用于记录用户加入的顺序
+	lastStream        time.Time               // 最后一次有用户开始或停止共享的时间，见Rooms.closeIdleRooms
+	draining          bool                    // 房间是否正在排空，排空期间不允许新用户加入，见Drain
+	reserved          bool                    // 是否是配置的保留房间，保留房间为空时不关闭，也不会因空闲被关闭
+	welcome           string                  // 发送给加入房间的用户的欢迎消息，空表示不发送
+	created           time.Time               // 房间创建的时间，用于统计房间的存在时长
+	bytesSent         float64                 // 根据客户端上报估算的房间累计发送字节数
+	bytesReceived     float64                 // 根据客户端上报估算的房间累计接收字节数
 }
 
 const (
@@ -38,11 +53,32 @@ const (
 	CloseOwnerLeft = "Owner Left"
 	// CloseDone 表示房间关闭的原因是正常结束
 	CloseDone = "Read End"
+	// CloseNoStream 表示房间关闭的原因是长时间没有用户共享
+	CloseNoStream = "No Stream"
+	// CloseLifetimeExceeded 表示连接的关闭原因是超过了最长连接时间
+	CloseLifetimeExceeded = "Lifetime Exceeded"
+	// CloseDrained 表示房间关闭的原因是管理员排空了房间
+	CloseDrained = "Drained"
+	// CloseQueueOverflow 表示连接的关闭原因是客户端接收消息太慢，等待发送的消息超过了上限
+	CloseQueueOverflow = "Queue Overflow"
 )
 
 // newSession 在房间中创建一个新的WebRTC会话
 // 根据连接模式配置ICE服务器，并通知主机和客户端
 func (r *Room) newSession(host, client xid.ID, rooms *Rooms, v4, v6 net.IP) {
+	// 断开连接的用户收不到会话信息，恢复连接时再补建会话
+	if r.Users[host].gone != nil || r.Users[client].gone != nil {
+		return
+	}
+	// 主机的会话数达到上限时拒绝，并告知观看者
+	if limit := rooms.config.MaxSessionsPerUser; limit > 0 && r.hostedSessions(host) >= limit {
+		sessionRejectedTotal.Inc()
+		r.Users[client].Write(outgoing.SessionRejected{
+			Peer:   host,
+			Reason: fmt.Sprintf("the user already shares to the maximum of %d viewers", limit),
+		})
+		return
+	}
 	// 生成新的会话ID
 	id := xid.New()
 	// 创建会话并存储到映射中
@@ -53,50 +89,82 @@ func (r *Room) newSession(host, client xid.ID, rooms *Rooms, v4, v6 net.IP) {
 	sessionCreatedTotal.Inc()
 
 	// 根据连接模式配置ICE服务器
-	iceHost := []outgoing.ICEServer{}
-	iceClient := []outgoing.ICEServer{}
+	iceHost := r.iceServers(rooms, id, r.Users[host], turnRoleHost, 0, v4, v6)
+	iceClient := r.iceServers(rooms, id, r.Users[client], turnRoleClient, 0, v4, v6)
+	// 向主机和客户端发送会话信息
+	r.Users[host].Write(outgoing.HostSession{Peer: client, ID: id, ICEServers: iceHost})
+	r.Users[client].Write(outgoing.ClientSession{Peer: host, ID: id, ICEServers: iceClient})
+}
+
+// iceServers 根据连接模式返回用户在会话中使用的ICE服务器，TURN模式下签发新的凭证
+// generation是凭证的代数，每次续签使用新的TURN用户名，旧的凭证可以单独撤销
+func (r *Room) iceServers(rooms *Rooms, sid xid.ID, user *User, role string, generation int, v4, v6 net.IP) []outgoing.ICEServer {
 	switch r.Mode {
-	case ConnectionLocal:
-		// 本地模式不需要ICE服务器
 	case ConnectionSTUN:
 		// STUN模式：配置STUN服务器地址
-		iceHost = []outgoing.ICEServer{{URLs: rooms.addresses("stun", v4, v6, false)}}
-		iceClient = []outgoing.ICEServer{{URLs: rooms.addresses("stun", v4, v6, false)}}
+		return []outgoing.ICEServer{{URLs: rooms.iceURLs("stun", user.Addr, v4, v6, false)}}
 	case ConnectionTURN:
-		// TURN模式：为主机和客户端生成TURN凭证
-		hostName, hostPW := rooms.turnServer.Credentials(id.String()+"host", r.Users[host].Addr)
-		clientName, clientPW := rooms.turnServer.Credentials(id.String()+"client", r.Users[client].Addr)
-		iceHost = []outgoing.ICEServer{{
-			URLs:       rooms.addresses("turn", v4, v6, true),
-			Credential: hostPW,
-			Username:   hostName,
-		}}
-		iceClient = []outgoing.ICEServer{{
-			URLs:       rooms.addresses("turn", v4, v6, true),
-			Credential: clientPW,
-			Username:   clientName,
+		// TURN模式：生成TURN凭证
+		if r.turnSessions == nil {
+			r.turnSessions = map[xid.ID]int{}
+		}
+		r.turnSessions[sid] = generation
+		name, pw := rooms.turnServer.Credentials(rooms.turnUsername(sid, turnRole(role, generation)), user.Addr)
+		return []outgoing.ICEServer{{
+			URLs:       rooms.iceURLs("turn", user.Addr, v4, v6, true),
+			Credential: pw,
+			Username:   name,
+			TTL:        int64(rooms.turnServer.TTL().Seconds()),
 		}}
+	default:
+		// 本地模式不需要ICE服务器
+		return []outgoing.ICEServer{}
 	}
-	// 向主机和客户端发送会话信息
-	r.Users[host].WriteTimeout(outgoing.HostSession{Peer: client, ID: id, ICEServers: iceHost})
-	r.Users[client].WriteTimeout(outgoing.ClientSession{Peer: host, ID: id, ICEServers: iceClient})
+}
+
+// iceURLs 生成用户addr使用的ICE服务器URL列表
+// 如果addr属于配置的区域则使用该区域的TURN服务器，否则使用默认服务器
+func (r *Rooms) iceURLs(prefix string, addr, v4, v6 net.IP, tcp bool) []string {
+	if region := config.MatchTurnRegion(r.config.TurnRegionsParsed, addr); region != nil {
+		log.Debug().Str("addr", logger.IP(addr)).Str("region", region.Name).Msg("Using TURN region")
+		ports := r.config.TurnPorts
+		if region.Port != "" {
+			ports = []string{region.Port}
+		}
+		return urls(prefix, []string{region.Host}, ports, tcp, r.config.TurnExplicitUDP)
+	}
+	return r.addresses(prefix, v4, v6, tcp)
 }
 
 // addresses 生成ICE服务器的URL地址列表
 // 根据提供的IPv4和IPv6地址以及是否支持TCP生成不同的URL
-func (r *Rooms) addresses(prefix string, v4, v6 net.IP, tcp bool) (result []string) {
+func (r *Rooms) addresses(prefix string, v4, v6 net.IP, tcp bool) []string {
+	var hosts []string
 	// 添加IPv4地址
 	if v4 != nil {
-		result = append(result, fmt.Sprintf("%s:%s:%s", prefix, v4.String(), r.config.TurnPort))
-		if tcp {
-			result = append(result, fmt.Sprintf("%s:%s:%s?transport=tcp", prefix, v4.String(), r.config.TurnPort))
-		}
+		hosts = append(hosts, v4.String())
 	}
 	// 添加IPv6地址
 	if v6 != nil {
-		result = append(result, fmt.Sprintf("%s:[%s]:%s", prefix, v6.String(), r.config.TurnPort))
-		if tcp {
-			result = append(result, fmt.Sprintf("%s:[%s]:%s?transport=tcp", prefix, v6.String(), r.config.TurnPort))
+		hosts = append(hosts, "["+v6.String()+"]")
+	}
+	return urls(prefix, hosts, r.config.TurnPorts, tcp, r.config.TurnExplicitUDP)
+}
+
+// urls 为每个端口和主机生成ICE服务器URL，tcp为true时额外生成TCP传输的URL
+// explicitUDP为true时UDP的URL也带上transport参数，只用于TURN，STUN的URL不支持transport
+// 提供多个端口（例如3478和443）可以提高在限制性防火墙后的连接成功率
+func urls(prefix string, hosts, ports []string, tcp, explicitUDP bool) (result []string) {
+	for _, port := range ports {
+		for _, host := range hosts {
+			if tcp && explicitUDP {
+				result = append(result, fmt.Sprintf("%s:%s:%s?transport=udp", prefix, host, port))
+			} else {
+				result = append(result, fmt.Sprintf("%s:%s:%s", prefix, host, port))
+			}
+			if tcp {
+				result = append(result, fmt.Sprintf("%s:%s:%s?transport=tcp", prefix, host, port))
+			}
 		}
 	}
 	return
@@ -106,83 +174,251 @@ func (r *Rooms) addresses(prefix string, v4, v6 net.IP, tcp bool) (result []stri
 // 如果使用TURN模式，还会撤销TURN服务器的凭证
 func (r *Room) closeSession(rooms *Rooms, id xid.ID) {
 	if r.Mode == ConnectionTURN {
-		// 撤销TURN服务器凭证
-		rooms.turnServer.Disallow(id.String() + "host")
-		rooms.turnServer.Disallow(id.String() + "client")
+		// 撤销TURN服务器凭证，包括续签前签发的凭证
+		for generation := 0; generation <= r.turnSessions[id]; generation++ {
+			rooms.revokeTurn(id, generation)
+		}
 	}
 	// 从映射中删除会话
 	delete(r.Sessions, id)
 	sessionClosedTotal.Inc()
 }
 
+// hostedSessions 返回用户作为主机的会话数
+func (r *Room) hostedSessions(host xid.ID) int {
+	count := 0
+	for _, session := range r.Sessions {
+		if session.Host == host {
+			count++
+		}
+	}
+	return count
+}
+
+// session 查找主机和客户端之间的会话
+func (r *Room) session(host, client xid.ID) (xid.ID, bool) {
+	for id, session := range r.Sessions {
+		if session.Host == host && session.Client == client {
+			return id, true
+		}
+	}
+	return xid.NilID(), false
+}
+
 // RoomSession 表示房间中的一个WebRTC会话
 // 包含主机和客户端的ID
 type RoomSession struct {
 	Host   xid.ID // 主机（共享者）的ID
 	Client xid.ID // 客户端（观看者）的ID
+
+	degraded    int       // 连续上报的劣化统计次数
+	lastRestart time.Time // 上次ICE重启的时间
+
+	generation       int // 最近签发的TURN凭证的代数
+	hostGeneration   int // 主机当前使用的凭证代数
+	clientGeneration int // 客户端当前使用的凭证代数
+
+	hostBytes   sessionBytes // 主机上次上报的累计字节数
+	clientBytes sessionBytes // 客户端上次上报的累计字节数
+}
+
+// sessionBytes 是会话的一方上次上报的累计字节数
+type sessionBytes struct {
+	sent     float64
+	received float64
+}
+
+// renewTurn 为角色分配新的凭证代数，返回角色之前使用的代数和新的代数
+func (s *RoomSession) renewTurn(role string) (int, int) {
+	s.generation++
+	current := &s.hostGeneration
+	if role == turnRoleClient {
+		current = &s.clientGeneration
+	}
+	previous := *current
+	*current = s.generation
+	return previous, s.generation
+}
+
+// reported 返回用户在会话中上次上报的累计字节数
+func (s *RoomSession) reported(user xid.ID) *sessionBytes {
+	if user == s.Host {
+		return &s.hostBytes
+	}
+	return &s.clientBytes
 }
 
 // notifyInfoChanged 通知房间中的所有用户房间信息已更改
-// 发送更新后的用户列表给每个用户
+// 用户列表只构建和排序一次，每个用户收到一份拷贝，其中只有自己被标记为You。
+// 每个用户需要自己的拷贝，因为消息由各自的写入协程稍后序列化。
 func (r *Room) notifyInfoChanged() {
-	for _, current := range r.Users {
-		users := []outgoing.User{}
-		// 构建用户列表
-		for _, user := range r.Users {
-			users = append(users, outgoing.User{
-				ID:        user.ID,
-				Name:      user.Name,
-				Streaming: user.Streaming,
-				You:       current == user, // 标记当前用户
-				Owner:     user.Owner,      // 标记房主
+	users := make([]outgoing.User, 0, len(r.Users))
+	// 构建用户列表
+	for _, user := range r.Users {
+		users = append(users, outgoing.User{
+			ID:        user.ID,
+			Name:      user.Name,
+			Streaming: user.Streaming,
+			Paused:    user.Paused,
+			Owner:     user.Owner, // 标记房主
+		})
+	}
+
+	// 对用户列表进行排序：
+	// 1. 房主优先
+	// 2. 正在流式传输的用户优先
+	// 3. 按名称字母顺序排序
+	sort.Slice(users, func(i, j int) bool {
+		left := users[i]
+		right := users[j]
+
+		if left.Owner != right.Owner {
+			return left.Owner
+		}
+
+		if left.Streaming != right.Streaming {
+			return left.Streaming
+		}
+
+		return left.Name < right.Name
+	})
+
+	for i, user := range users {
+		own := make([]outgoing.User, len(users))
+		copy(own, users)
+		own[i].You = true // 标记当前用户
+
+		recipient := r.Users[user.ID]
+		if !recipient.delta {
+			// 发送房间信息给当前用户
+			recipient.Write(outgoing.Room{
+				ID:        r.ID,
+				Locked:    r.Locked,
+				Recording: r.Recording,
+				Users:     own,
 			})
+			continue
+		}
+		// 支持增量更新的用户第一次收到完整的房间信息，之后只收到变化
+		if recipient.lastSent == nil {
+			recipient.Write(outgoing.Room{ID: r.ID, Locked: r.Locked, Recording: r.Recording, Users: own})
+		} else if delta, changed := roomDelta(r, recipient, own); changed {
+			recipient.Write(delta)
 		}
+		recipient.lastSent = own
+		recipient.lastLocked = r.Locked
+		recipient.lastRecording = r.Recording
+	}
+}
 
-		// 对用户列表进行排序：
-		// 1. 房主优先
-		// 2. 正在流式传输的用户优先
-		// 3. 按名称字母顺序排序
-		sort.Slice(users, func(i, j int) bool {
-			left := users[i]
-			right := users[j]
+// sendPending 向刚加入的用户发送一次性的消息，例如欢迎消息和恢复令牌
+// 在房间信息之后发送，客户端收到的第一条消息始终是房间信息
+func (r *Room) sendPending() {
+	for _, user := range r.Users {
+		for _, msg := range user.pending {
+			user.Write(msg)
+		}
+		user.pending = nil
+	}
+}
 
-			if left.Owner != right.Owner {
-				return left.Owner
-			}
+// roomDelta 计算用户上一次收到的房间信息与当前信息之间的差异
+// 没有任何变化时返回false
+func roomDelta(r *Room, recipient *User, current []outgoing.User) (outgoing.RoomDelta, bool) {
+	delta := outgoing.RoomDelta{ID: r.ID, Locked: r.Locked, Recording: r.Recording}
+	previous := make(map[xid.ID]outgoing.User, len(recipient.lastSent))
+	for _, user := range recipient.lastSent {
+		previous[user.ID] = user
+	}
+	for _, user := range current {
+		old, ok := previous[user.ID]
+		switch {
+		case !ok:
+			delta.Added = append(delta.Added, user)
+		case old != user:
+			delta.Changed = append(delta.Changed, user)
+		}
+		delete(previous, user.ID)
+	}
+	for id := range previous {
+		delta.Removed = append(delta.Removed, id)
+	}
+	changed := len(delta.Added) > 0 || len(delta.Changed) > 0 || len(delta.Removed) > 0 ||
+		r.Locked != recipient.lastLocked || r.Recording != recipient.lastRecording
+	return delta, changed
+}
 
-			if left.Streaming != right.Streaming {
-				return left.Streaming
-			}
+// observeLeave 记录用户在房间中的时长
+func (r *Room) observeLeave(user *User) {
+	userSessionSeconds.WithLabelValues(string(r.Mode)).Observe(time.Since(user.since).Seconds())
+}
 
-			return left.Name < right.Name
-		})
+// streaming 返回房间中是否有用户正在共享
+func (r *Room) streaming() bool {
+	for _, user := range r.Users {
+		if user.Streaming {
+			return true
+		}
+	}
+	return false
+}
 
-		// 发送房间信息给当前用户
-		current.WriteTimeout(outgoing.Room{
-			ID:    r.ID,
-			Users: users,
-		})
+// nextJoin 返回下一个加入房间的用户的顺序
+func (r *Room) nextJoin() uint64 {
+	r.joins++
+	return r.joins
+}
+
+// transferOwnership 将房主转移给在房间中时间最长的用户并返回该用户
+// 房间中没有用户时返回nil
+func (r *Room) transferOwnership() *User {
+	var owner *User
+	for _, user := range r.Users {
+		if owner == nil || user.joined < owner.joined {
+			owner = user
+		}
+	}
+	if owner != nil {
+		owner.Owner = true
 	}
+	return owner
 }
 
 // User 表示房间中的一个用户
 type User struct {
-	ID        xid.ID                  // 用户唯一标识符
-	Addr      net.IP                  // 用户的IP地址
-	Name      string                  // 用户名称
-	Streaming bool                    // 是否正在共享屏幕
-	Owner     bool                    // 是否是房主
-	_write    chan<- outgoing.Message // 用于发送消息的通道
+	ID        xid.ID  // 用户唯一标识符
+	Addr      net.IP  // 用户的IP地址
+	Name      string  // 用户名称
+	Streaming bool    // 是否正在共享屏幕
+	Paused    bool    // 共享是否已暂停，暂停时会话保持不变
+	Owner     bool    // 是否是房主
+	_write    *outbox // 发往用户的消息队列
+
+	delta    bool   // 是否接收只包含变化的房间信息
+	onDemand bool   // 是否只通过watch事件观看共享
+	joined   uint64 // 用户加入房间的顺序，房主为0
+	recorder bool   // 是否是录制程序，开始和停止录制时收到通知
+
+	pending []outgoing.Message // 在房间信息之后发送的一次性消息，见Room.sendPending
+	resume  string             // 恢复令牌，断开连接后在宽限期内可以凭此恢复，空表示不能恢复
+	gone    *ResumeExpired     // 断开连接后等待恢复的到期事件，nil表示已连接
+	seq     *atomic.Uint64     // 最后收到的消息序列号，恢复后的连接继续使用
+	since   time.Time          // 加入房间的时间，用于统计用户在房间中的时长
+
+	lastSent      []outgoing.User // 上一次发送给用户的用户列表，仅用于增量更新
+	lastLocked    bool            // 上一次发送给用户的锁定状态，仅用于增量更新
+	lastRecording bool            // 上一次发送给用户的录制状态，仅用于增量更新
 }
 
-// WriteTimeout 向用户发送消息，带有超时处理
-// 如果2秒内无法发送，则记录警告日志
-func (u *User) WriteTimeout(msg outgoing.Message) {
-	writeTimeout(u._write, msg)
+// Write 向用户发送消息
+// 消息进入用户的消息队列，由客户端的写入协程发送，不会阻塞主循环
+func (u *User) Write(msg outgoing.Message) {
+	u._write.push(msg)
 }
 
 // writeTimeout 是一个泛型函数，用于向通道发送消息，带有超时处理
 // 如果2秒内无法发送，则记录警告日志
+// 仅用于带缓冲的响应通道，例如内部事件的结果
 func writeTimeout[T any](ch chan<- T, msg T) {
 	select {
 	case <-time.After(2 * time.Second):
@@ -0,0 +1,350 @@
+package ws
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/config"
+	"github.com/AsterZephyr/Scree-go-AZlearn/config/ipdns"
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTurn records the issued credentials like the internal TURN server.
+type fakeTurn struct {
+	lookup map[string]bool
+	ttl    time.Duration
+}
+
+func (f *fakeTurn) Credentials(id string, addr net.IP) (string, string) {
+	f.lookup[id] = true
+	return id, "secret"
+}
+
+func (f *fakeTurn) Disallow(username string) {
+	delete(f.lookup, username)
+}
+
+func (f *fakeTurn) DisallowPrefix(prefix string) {
+	for username := range f.lookup {
+		if strings.HasPrefix(username, prefix) {
+			delete(f.lookup, username)
+		}
+	}
+}
+
+func (f *fakeTurn) Close() error {
+	return nil
+}
+
+func (f *fakeTurn) Healthy() bool {
+	return true
+}
+
+func (f *fakeTurn) TTL() time.Duration {
+	return f.ttl
+}
+
+func TestCloseRoom_sweepsOrphanedTurnCredentials(t *testing.T) {
+	turnServer := &fakeTurn{lookup: map[string]bool{}}
+	rooms := newTestRooms()
+	rooms.turnServer = turnServer
+	owner := connectTestClient(rooms)
+	guest := connectTestClient(rooms)
+
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionTURN}).Execute(rooms, owner, zerolog.Nop()))
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.Users[owner.ID].Streaming = true
+	room.newSession(owner.ID, guest.ID, rooms, net.IPv4(127, 0, 0, 1), nil)
+	assert.Len(t, turnServer.lookup, 2)
+
+	// the session is gone before its credentials were revoked
+	room.Sessions = map[xid.ID]*RoomSession{}
+	rooms.closeRoom("room")
+
+	assert.Empty(t, turnServer.lookup)
+}
+
+func TestNewSession_turnUsernameFormat(t *testing.T) {
+	turnServer := &fakeTurn{lookup: map[string]bool{}}
+	rooms := newTestRooms()
+	rooms.turnServer = turnServer
+	rooms.turnNames = FormatTurnUsername("{time}-{session}-{role}")
+	owner := connectTestClient(rooms)
+	guest := connectTestClient(rooms)
+
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionTURN}).Execute(rooms, owner, zerolog.Nop()))
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	room.Users[owner.ID].Streaming = true
+	room.newSession(owner.ID, guest.ID, rooms, net.IPv4(127, 0, 0, 1), nil)
+
+	for id := range room.Sessions {
+		prefix := fmt.Sprintf("%d-%s-", id.Time().Unix(), id)
+		assert.Equal(t, map[string]bool{prefix + "host": true, prefix + "client": true}, turnServer.lookup)
+		room.closeSession(rooms, id)
+	}
+	assert.Empty(t, turnServer.lookup, "credentials are revoked with the same usernames")
+}
+
+func TestNewSession_advertisesCredentialTTL(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.turnServer = &fakeTurn{lookup: map[string]bool{}, ttl: time.Hour}
+	owner := connectTestClient(rooms)
+	guest := connectTestClient(rooms)
+
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionTURN}).Execute(rooms, owner, zerolog.Nop()))
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	owner.Write.pop()
+	rooms.Rooms["room"].newSession(owner.ID, guest.ID, rooms, net.IPv4(127, 0, 0, 1), nil)
+
+	msgs := owner.Write.pop()
+	if assert.Len(t, msgs, 1) {
+		assert.Equal(t, int64(3600), msgs[0].(outgoing.HostSession).ICEServers[0].TTL)
+	}
+}
+
+func TestCloseIdleRooms(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.config.CloseRoomWhenNoStreamFor = time.Minute
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionLocal}).Execute(rooms, owner, zerolog.Nop()))
+	guest := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	room := rooms.Rooms["room"]
+	created := room.lastStream
+
+	rooms.closeIdleRooms(created.Add(30 * time.Second))
+	assert.Contains(t, rooms.Rooms, "room")
+
+	assert.NoError(t, (&StartShare{}).Execute(rooms, owner, zerolog.Nop()))
+	rooms.closeIdleRooms(created.Add(2 * time.Minute))
+	assert.Contains(t, rooms.Rooms, "room", "rooms with a stream stay open")
+
+	assert.NoError(t, (&StopShare{}).Execute(rooms, owner, zerolog.Nop()))
+	stopped := room.lastStream
+	rooms.closeIdleRooms(stopped.Add(59 * time.Second))
+	assert.Contains(t, rooms.Rooms, "room", "stopping the share resets the timer")
+
+	guest.Write.pop()
+	rooms.closeIdleRooms(stopped.Add(time.Minute))
+	assert.NotContains(t, rooms.Rooms, "room")
+	assert.NotContains(t, rooms.connected, guest.ID)
+	assert.Equal(t, []outgoing.Message{outgoing.CloseWriter{Code: websocket.CloseNormalClosure, Reason: CloseNoStream}}, guest.Write.pop())
+}
+
+func TestReservedRooms(t *testing.T) {
+	rooms := NewRooms(nil, nil, config.Config{
+		EventLoopShards:          3,
+		ReservedRooms:            []string{"standup", "allhands"},
+		ReservedRoomMode:         "stun",
+		CloseRoomWhenNoStreamFor: time.Minute,
+		TurnIPProvider:           &ipdns.Static{},
+	})
+	for _, id := range []string{"standup", "allhands"} {
+		room, ok := rooms.shardFor(id).Rooms[id]
+		if assert.True(t, ok, "reserved rooms are created at startup") {
+			assert.Equal(t, ConnectionSTUN, room.Mode)
+			assert.False(t, room.CloseOnOwnerLeave)
+		}
+	}
+
+	shard := rooms.shardFor("standup")
+	first := connectTestClient(shard)
+	assert.NoError(t, (&Join{ID: "standup"}).Execute(shard, first, zerolog.Nop()))
+	second := connectTestClient(shard)
+	assert.NoError(t, (&Join{ID: "standup"}).Execute(shard, second, zerolog.Nop()))
+	room := shard.Rooms["standup"]
+	assert.True(t, room.Users[first.ID].Owner, "the first user of an empty reserved room owns it")
+	assert.False(t, room.Users[second.ID].Owner)
+
+	shard.closeIdleRooms(room.lastStream.Add(time.Hour))
+	assert.Contains(t, shard.Rooms, "standup", "reserved rooms are not reaped")
+
+	assert.NoError(t, (&Disconnected{Code: websocket.CloseNormalClosure}).Execute(shard, first, zerolog.Nop()))
+	assert.NoError(t, (&Disconnected{Code: websocket.CloseNormalClosure}).Execute(shard, second, zerolog.Nop()))
+	assert.Same(t, room, shard.Rooms["standup"], "reserved rooms survive emptying")
+
+	shard.closeRoom("standup")
+	third := connectTestClient(shard)
+	assert.NoError(t, (&Join{ID: "standup"}).Execute(shard, third, zerolog.Nop()), "joining recreates a closed reserved room")
+	assert.True(t, shard.Rooms["standup"].reserved)
+}
+
+func TestJoin_welcome(t *testing.T) {
+	rooms := newTestRooms()
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionLocal, Welcome: "hello"}).Execute(rooms, owner, zerolog.Nop()))
+	guest := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	rooms.flushChanged()
+
+	assert.Len(t, owner.Write.pop(), 1, "the creator gets no welcome")
+	msgs := guest.Write.pop()
+	if assert.Len(t, msgs, 2) {
+		assert.IsType(t, outgoing.Room{}, msgs[0], "the room info comes first")
+		assert.Equal(t, outgoing.Welcome{Message: "hello"}, msgs[1])
+	}
+
+	assert.NoError(t, (&Lock{}).Execute(rooms, owner, zerolog.Nop()))
+	rooms.flushChanged()
+	assert.Len(t, guest.Write.pop(), 1, "the welcome is sent once")
+
+	assert.Error(t, (&Create{Mode: ConnectionLocal, Welcome: strings.Repeat("ü", maxWelcomeLength+1)}).Validate())
+}
+
+func TestCloseRoom_observesDurations(t *testing.T) {
+	rooms := newTestRooms()
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, owner, zerolog.Nop()))
+	guest := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	rooms.Rooms["room"].created = time.Now().Add(-time.Hour)
+	roomsBefore := histogramCount(t, "screego_room_lifetime_seconds", "stun")
+	usersBefore := histogramCount(t, "screego_user_session_seconds", "stun")
+
+	assert.NoError(t, (&Disconnected{Code: websocket.CloseNormalClosure}).Execute(rooms, guest, zerolog.Nop()))
+	assert.Equal(t, usersBefore+1, histogramCount(t, "screego_user_session_seconds", "stun"))
+	assert.Equal(t, roomsBefore, histogramCount(t, "screego_room_lifetime_seconds", "stun"))
+
+	rooms.closeRoom("room")
+	assert.Equal(t, usersBefore+2, histogramCount(t, "screego_user_session_seconds", "stun"), "the remaining users leave")
+	assert.Equal(t, roomsBefore+1, histogramCount(t, "screego_room_lifetime_seconds", "stun"))
+}
+
+// histogramCount returns the number of observations of the histogram name
+// with the given mode label.
+func histogramCount(t *testing.T, name, mode string) uint64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if !assert.NoError(t, err) {
+		return 0
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "mode" && label.GetValue() == mode {
+					return metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestReapInterval(t *testing.T) {
+	assert.Equal(t, time.Second, reapInterval(time.Second))
+	assert.Equal(t, 30*time.Second, reapInterval(5*time.Minute))
+	assert.Equal(t, time.Minute, reapInterval(time.Hour))
+}
+
+func TestFlushChanged_coalescesNotifications(t *testing.T) {
+	rooms := newTestRooms()
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN}).Execute(rooms, owner, zerolog.Nop()))
+	for i := 0; i < 3; i++ {
+		guest := connectTestClient(rooms)
+		assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	}
+	assert.Empty(t, owner.Write.pop(), "nothing is sent before the flush")
+
+	rooms.flushChanged()
+	msgs := owner.Write.pop()
+	assert.Len(t, msgs, 1)
+	assert.Len(t, msgs[0].(outgoing.Room).Users, 4, "the final state is broadcast")
+
+	rooms.flushChanged()
+	assert.Empty(t, owner.Write.pop())
+
+	// closed rooms aren't broadcast.
+	assert.NoError(t, (&Lock{}).Execute(rooms, owner, zerolog.Nop()))
+	rooms.closeRoom("room")
+	rooms.flushChanged()
+	for _, msg := range owner.Write.pop() {
+		assert.IsType(t, outgoing.CloseWriter{}, msg)
+	}
+}
+
+func TestNotifyInfoChanged_marksOnlyRecipient(t *testing.T) {
+	room := &Room{ID: "room", Users: map[xid.ID]*User{}}
+	for i := 0; i < 5; i++ {
+		id := xid.New()
+		room.Users[id] = &User{ID: id, Name: fmt.Sprint("user", i), Owner: i == 3, _write: newOutbox()}
+	}
+	room.notifyInfoChanged()
+	for id, user := range room.Users {
+		msgs := user._write.pop()
+		assert.Len(t, msgs, 1)
+		users := msgs[0].(outgoing.Room).Users
+		assert.True(t, users[0].Owner, "the owner is listed first")
+		for _, u := range users {
+			assert.Equal(t, u.ID == id, u.You)
+		}
+	}
+}
+
+func TestNotifyInfoChanged_delta(t *testing.T) {
+	rooms := newTestRooms()
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{ID: "room", Mode: ConnectionSTUN, RoomDelta: true}).Execute(rooms, owner, zerolog.Nop()))
+	rooms.flushChanged()
+	msgs := owner.Write.pop()
+	assert.Len(t, msgs, 1)
+	assert.IsType(t, outgoing.Room{}, msgs[0], "the first update is complete")
+
+	guest := connectTestClient(rooms)
+	assert.NoError(t, (&Join{ID: "room"}).Execute(rooms, guest, zerolog.Nop()))
+	rooms.flushChanged()
+	msgs = owner.Write.pop()
+	assert.Len(t, msgs, 1)
+	delta := msgs[0].(outgoing.RoomDelta)
+	assert.Len(t, delta.Added, 1)
+	assert.Equal(t, guest.ID, delta.Added[0].ID)
+	assert.Empty(t, delta.Changed)
+	assert.IsType(t, outgoing.Room{}, guest.Write.pop()[0], "clients without opt in get the complete room")
+
+	assert.NoError(t, (&StartShare{}).Execute(rooms, guest, zerolog.Nop()))
+	rooms.flushChanged()
+	for _, msg := range owner.Write.pop() {
+		if delta, ok := msg.(outgoing.RoomDelta); ok {
+			assert.Len(t, delta.Changed, 1)
+			assert.True(t, delta.Changed[0].Streaming)
+		}
+	}
+
+	// nothing changed, nothing is sent.
+	rooms.markChanged(rooms.Rooms["room"])
+	rooms.flushChanged()
+	assert.Empty(t, owner.Write.pop())
+
+	assert.NoError(t, (&Disconnected{Code: 1000}).Execute(rooms, guest, zerolog.Nop()))
+	rooms.flushChanged()
+	msgs = owner.Write.pop()
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, []xid.ID{guest.ID}, msgs[1].(outgoing.RoomDelta).Removed)
+}
+
+func BenchmarkNotifyInfoChanged(b *testing.B) {
+	room := &Room{ID: "room", Users: map[xid.ID]*User{}}
+	for i := 0; i < 100; i++ {
+		id := xid.New()
+		room.Users[id] = &User{ID: id, Name: fmt.Sprint("user", i), Owner: i == 0, Streaming: i%10 == 0, _write: newOutbox()}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		room.notifyInfoChanged()
+		for _, user := range room.Users {
+			user._write.pop()
+		}
+	}
+}
@@ -1,18 +1,27 @@
 package ws
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/AsterZephyr/Scree-go-AZlearn/auth"
 	"github.com/AsterZephyr/Scree-go-AZlearn/config"
 	"github.com/AsterZephyr/Scree-go-AZlearn/turn"
 	"github.com/AsterZephyr/Scree-go-AZlearn/util"
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
 	"github.com/gorilla/websocket"
 	"github.com/rs/xid"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
@@ -22,15 +31,21 @@ import (
 // - tServer: TURN服务器实例，用于WebRTC连接
 // - users: 用户认证管理器
 // - conf: 应用配置
-func NewRooms(tServer turn.Server, users *auth.Users, conf config.Config) *Rooms {
-	return &Rooms{
+// - opts: 可选配置，例如WithNames或WithSeed
+func NewRooms(tServer turn.Server, users *auth.Users, conf config.Config, opts ...Option) *Rooms {
+	rooms := &Rooms{
 		Rooms:      map[string]*Room{},          // 初始化空房间映射
-		Incoming:   make(chan ClientMessage),    // 创建消息通道
+		Incoming:   make(chan ClientMessage, conf.EventQueueSize), // 创建带缓冲的消息通道
+		done:       make(chan struct{}),         // 主循环停止时关闭
 		connected:  map[xid.ID]string{},         // 初始化客户端连接映射
 		turnServer: tServer,                     // 设置TURN服务器
 		users:      users,                       // 设置用户管理器
 		config:     conf,                        // 设置配置
 		r:          rand.New(rand.NewSource(time.Now().Unix())), // 初始化随机数生成器
+		names:      util.DefaultNames(),         // 内置的名称词表
+		turnNames:  FormatTurnUsername(conf.TurnUsernameFormat), // TURN用户名的格式
+		clients:    new(atomic.Int64),           // 打开的连接数
+		turnAddrs:  &turnIPCache{},              // 所有分片共享的TURN地址
 		upgrader: websocket.Upgrader{            // 配置WebSocket升级器
 			ReadBufferSize:  1024,               // 读缓冲区大小
 			WriteBufferSize: 1024,               // 写缓冲区大小
@@ -38,15 +53,97 @@ func NewRooms(tServer turn.Server, users *auth.Users, conf config.Config) *Rooms
 				origin := r.Header.Get("origin")
 				u, err := url.Parse(origin)
 				if err != nil {
+					originRejectedTotal.Inc()
+					log.Info().Err(err).Str("host", r.Host).Str("origin", origin).Msg("Rejected WebSocket upgrade with invalid origin")
 					return false
 				}
-				if u.Host == r.Host {
+				if u.Host == r.Host || conf.CheckOrigin(origin) {
 					return true
 				}
-				return conf.CheckOrigin(origin)
+				originRejectedTotal.Inc()
+				log.Info().Str("host", r.Host).Str("origin", origin).Msg("Rejected WebSocket upgrade from foreign origin")
+				return false
 			},
 		},
 	}
+	rooms.upgrader.Error = rooms.upgradeError
+	rooms.upgrader.EnableCompression = conf.WebSocketCompression
+	for _, opt := range opts {
+		opt(rooms)
+	}
+	// 第一个分片是rooms本身，只有一个分片时行为与不分片相同
+	rooms.shards = []*Rooms{rooms}
+	for i := 1; i < conf.EventLoopShards; i++ {
+		rooms.shards = append(rooms.shards, rooms.newShard())
+	}
+	for _, shard := range rooms.shards[1:] {
+		shard.shards = rooms.shards
+	}
+	// 保留房间由负责其ID的分片持有
+	for _, id := range conf.ReservedRooms {
+		rooms.shardFor(id).createReserved(rooms.normalizeRoomID(id))
+	}
+	return rooms
+}
+
+// newShard 创建一个额外的分片，与r共享配置、TURN服务器、用户和词表
+// 每个分片有自己的房间、连接、消息队列和随机数生成器
+func (r *Rooms) newShard() *Rooms {
+	return &Rooms{
+		Rooms:      map[string]*Room{},
+		Incoming:   make(chan ClientMessage, r.config.EventQueueSize),
+		done:       make(chan struct{}),
+		connected:  map[xid.ID]string{},
+		turnServer: r.turnServer,
+		users:      r.users,
+		config:     r.config,
+		r:          rand.New(rand.NewSource(r.r.Int63())),
+		names:      r.names,
+		blocklist:  r.blocklist,
+		turnNames:  r.turnNames,
+		geoIP:      r.geoIP,
+		clients:    r.clients,
+		turnAddrs:  r.turnAddrs,
+	}
+}
+
+// Option 是NewRooms的可选配置
+type Option func(*Rooms)
+
+// WithSeed 使用固定的种子初始化随机数生成器，生成的名称是确定的，用于测试
+// 默认使用当前时间作为种子
+func WithSeed(seed int64) Option {
+	return func(r *Rooms) {
+		r.r = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithNames 使用自定义词表生成用户名和房间名
+func WithNames(names util.Names) Option {
+	return func(r *Rooms) {
+		r.names = names
+	}
+}
+
+// WithBlocklist 过滤包含屏蔽词的用户名和房间名
+func WithBlocklist(blocklist *util.Blocklist) Option {
+	return func(r *Rooms) {
+		r.blocklist = blocklist
+	}
+}
+
+// WithTurnUsername 使用自定义函数组合TURN用户名，覆盖配置的格式
+func WithTurnUsername(turnUsername TurnUsername) Option {
+	return func(r *Rooms) {
+		r.turnNames = turnUsername
+	}
+}
+
+// WithGeoIP 记录并统计连接客户端所在的国家
+func WithGeoIP(geoIP *util.GeoIP) Option {
+	return func(r *Rooms) {
+		r.geoIP = geoIP
+	}
 }
 
 // Rooms 管理所有房间和WebSocket连接
@@ -55,11 +152,23 @@ type Rooms struct {
 	turnServer turn.Server             // TURN服务器，用于WebRTC连接
 	Rooms      map[string]*Room        // 所有活跃房间的映射，键为房间ID
 	Incoming   chan ClientMessage      // 接收客户端消息的通道
+	done       chan struct{}           // 主循环停止后关闭，发送方据此停止发送
 	upgrader   websocket.Upgrader      // WebSocket连接升级器
 	users      *auth.Users             // 用户认证管理器
 	config     config.Config           // 应用配置
-	r          *rand.Rand              // 随机数生成器，用于生成随机名称
+	r          *rand.Rand              // 随机数生成器，用于生成随机名称，由rLock保护
+	rLock      sync.Mutex              // rand.Rand不是并发安全的，HTTP处理器和主循环都会使用r
+	names      util.Names              // 生成随机名称使用的词表
+	blocklist  *util.Blocklist         // 名称中不允许出现的屏蔽词，nil表示不过滤
+	turnNames  TurnUsername            // 组合会话的TURN用户名
+	geoIP      *util.GeoIP             // 解析客户端所在国家的数据库，nil表示不解析
+	clients    *atomic.Int64           // 打开的WebSocket连接数，所有分片共享，不经过主循环更新
 	connected  map[xid.ID]string       // 客户端ID到房间ID的映射，记录每个客户端所在的房间
+	shards     []*Rooms                // 所有分片，第一个是主分片本身，按房间ID的哈希分配房间
+	changed    []*Room                 // 信息已更改、等待通知用户的房间
+	shedding   atomic.Bool             // 队列超过高水位后拒绝新连接，降到低水位以下才恢复
+	turnAddrs  *turnIPCache            // 上一次成功解析的TURN地址，所有分片共享
+	eventLog   eventLogHook            // 为当前处理的事件的日志添加用户和房间字段
 }
 
 // CurrentRoom 获取客户端当前所在的房间
@@ -87,16 +196,121 @@ func (r *Rooms) CurrentRoom(info ClientInfo) (*Room, error) {
 	return room, nil
 }
 
+// turnIPs 获取TURN服务器的IPv4和IPv6地址
+// 解析失败时回退到上一次成功解析的地址，避免短暂的DNS故障断开客户端
+// 只有在从未成功解析过时才返回错误
+func (r *Rooms) turnIPs() (net.IP, net.IP, error) {
+	return r.turnAddrs.get(r.config.TurnIPProvider)
+}
+
+// maxBlockedNameAttempts 是生成不含屏蔽词的随机名称的最大尝试次数
+// 词表几乎全被屏蔽时避免无限循环，之后使用最后生成的名称
+const maxBlockedNameAttempts = 100
+
 // RandUserName 生成一个随机的用户名
-// 使用util包中的函数生成随机名称
+// 使用util包中的函数生成随机名称，包含屏蔽词时重新生成
 func (r *Rooms) RandUserName() string {
-	return util.NewUserName(r.r)
+	r.rLock.Lock()
+	defer r.rLock.Unlock()
+	name := r.names.UserName(r.r)
+	for i := 1; i < maxBlockedNameAttempts && r.blocklist.Blocked(name); i++ {
+		name = r.names.UserName(r.r)
+	}
+	return name
 }
 
 // RandRoomName 生成一个随机的房间名
-// 使用util包中的函数生成随机名称
+// 使用util包中的函数生成随机名称，包含屏蔽词时重新生成
 func (r *Rooms) RandRoomName() string {
-	return util.NewRoomName(r.r)
+	r.rLock.Lock()
+	defer r.rLock.Unlock()
+	name := r.names.RoomName(r.r)
+	for i := 1; i < maxBlockedNameAttempts && r.blocklist.Blocked(name); i++ {
+		name = r.names.RoomName(r.r)
+	}
+	return name
+}
+
+// blockedName 返回用户提供的名称包含屏蔽词时的错误
+func (r *Rooms) blockedName(kind, name string) error {
+	if r.blocklist.Blocked(name) {
+		return fmt.Errorf("%s contains a blocked word", kind)
+	}
+	return nil
+}
+
+// userName 将客户端选择的用户名规范化为NFC，并拒绝过长、包含控制字符或屏蔽词的用户名
+func (r *Rooms) userName(name string) (string, error) {
+	name, err := util.NormalizeUserName(name, r.config.MaxUserNameLength)
+	if err != nil {
+		return "", err
+	}
+	return name, r.blockedName("username", name)
+}
+
+// maxRoomNameAttempts 是生成不冲突房间名的最大尝试次数，之后追加随机后缀
+const maxRoomNameAttempts = 10
+
+// uniqueRoomName 生成一个未被使用的房间名，必须在主循环中调用
+func (r *Rooms) uniqueRoomName() string {
+	for i := 0; i < maxRoomNameAttempts; i++ {
+		name := r.RandRoomName()
+		name = r.normalizeRoomID(name)
+		if _, exists := r.Rooms[name]; !exists && r.owns(name) {
+			return name
+		}
+	}
+	for {
+		name := r.normalizeRoomID(fmt.Sprintf("%s-%d", r.RandRoomName(), r.randIntn(10000)))
+		if _, exists := r.Rooms[name]; !exists && r.owns(name) {
+			return name
+		}
+	}
+}
+
+// normalizeRoomID 在配置了RoomIDLowercase时将房间ID转换为小写
+// 房间ID在查找房间和选择分片前都需要规范化，例如Standup和standup是同一个房间
+func (r *Rooms) normalizeRoomID(id string) string {
+	if r.config.RoomIDLowercase {
+		return strings.ToLower(id)
+	}
+	return id
+}
+
+// shardFor 返回负责给定ID的分片
+func (r *Rooms) shardFor(id string) *Rooms {
+	if len(r.shards) <= 1 {
+		return r
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(r.normalizeRoomID(id)))
+	return r.shards[h.Sum32()%uint32(len(r.shards))]
+}
+
+// owns 返回房间ID是否由当前分片负责
+func (r *Rooms) owns(roomID string) bool {
+	return r.shardFor(roomID) == r
+}
+
+// randIntn 并发安全地返回[0,n)之间的随机数
+func (r *Rooms) randIntn(n int) int {
+	r.rLock.Lock()
+	defer r.rLock.Unlock()
+	return r.r.Intn(n)
+}
+
+// UniqueRoomName 通过主循环生成一个未被使用的房间名
+// 主循环不可用时退回到可能冲突的随机房间名
+func (r *Rooms) UniqueRoomName() string {
+	shard := r.shards[r.randIntn(len(r.shards))]
+	e := RoomName{Response: make(chan string, 1)}
+	select {
+	case shard.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: &e}:
+		return <-e.Response
+	case <-shard.done:
+	case <-time.After(5 * time.Second):
+	}
+	return r.RandRoomName()
 }
 
 // Upgrade 将HTTP连接升级为WebSocket连接
@@ -105,67 +319,400 @@ func (r *Rooms) RandRoomName() string {
 // - w: HTTP响应写入器
 // - req: HTTP请求
 func (r *Rooms) Upgrade(w http.ResponseWriter, req *http.Request) {
+	// 客户端先由按客户端ID选择的分片处理，创建或加入房间时移交到房间所在的分片
+	id := xid.New()
+	shard := r.shardFor(id.String())
+	// 消息队列积压时拒绝新连接，避免主循环继续积压
+	if shard.overloaded() {
+		eventQueueRejectedTotal.Inc()
+		log.Warn().Int("length", len(shard.Incoming)).Int("capacity", cap(shard.Incoming)).Msg("Event queue overloaded, rejecting WebSocket upgrade")
+		w.Header().Set("Retry-After", "5")
+		r.writeUpgradeError(w, http.StatusServiceUnavailable, "overloaded", nil)
+		return
+	}
+
 	// 将HTTP连接升级为WebSocket连接
 	conn, err := r.upgrader.Upgrade(w, req, nil)
 	if err != nil {
-		log.Debug().Err(err).Msg("Websocket upgrade")
-		w.WriteHeader(400)
-		_, _ = w.Write([]byte(fmt.Sprintf("Upgrade failed %s", err)))
+		// 响应已由upgradeError写入，或者连接已被接管无法再写入
 		return
 	}
 
+	// 协商了permessage-deflate时按客户端的提示选择压缩级别
+	_ = conn.SetCompressionLevel(compressionLevel(req.URL.Query().Get("compression"), r.config.WebSocketCompressionLevel))
+
 	// 获取当前用户信息
-	user, loggedIn := r.users.CurrentUser(req)
+	user, loggedIn := r.users.AuthenticateSession(req)
+	// 携带恢复令牌的客户端继续使用断开连接前的用户和会话
+	if token := req.URL.Query().Get("resume"); token != "" {
+		r.upgradeResume(conn, req, req.URL.Query().Get("room"), token, user, loggedIn)
+		return
+	}
 	// 创建新的客户端
-	c := newClient(conn, req, r.Incoming, user, loggedIn, r.config.TrustProxyHeaders)
+	c := newClient(conn, req, shard, id, user, loggedIn, r.config.TrustProxyHeaders)
+	r.countCountry(c.info)
 	// 发送连接事件
-	r.Incoming <- ClientMessage{Info: c.info, Incoming: Connected{}, SkipConnectedCheck: true}
+	if !c.send(ClientMessage{Info: c.info, Incoming: Connected{}, SkipConnectedCheck: true}) {
+		c.CloseOnDone(websocket.CloseGoingAway, "server shutting down")
+		return
+	}
 
 	// 启动读取和写入处理
 	go c.startReading(time.Second * 20)
-	go c.startWriteHandler(time.Second * 5)
+	go c.startWriteHandler(jitter(time.Second*5, r.config.PingJitter, id), r.config.MaxConnectionLifetime)
+}
+
+// upgradeResume 将升级后的连接关联到宽限期内断开连接的用户
+// 令牌无效或宽限期已过时关闭连接，客户端需要重新创建或加入房间
+func (r *Rooms) upgradeResume(conn *websocket.Conn, req *http.Request, roomID, token, user string, loggedIn bool) {
+	shard := r.shardFor(roomID)
+	write := newOutbox()
+	write.limit = r.config.ClientQueueLimit
+	e := Resume{Room: roomID, Token: token, Write: write, Response: make(chan xid.ID, 1)}
+	id := xid.NilID()
+	// 主循环总会响应，不能超时放弃：放弃后用户会关联到没有连接读取的消息队列
+	select {
+	case shard.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: &e}:
+		select {
+		case id = <-e.Response:
+		case <-shard.done:
+		}
+	case <-shard.done:
+	}
+	if id.IsNil() {
+		message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "invalid resume token")
+		_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+
+	c := newClient(conn, req, shard, id, user, loggedIn, r.config.TrustProxyHeaders)
+	c.info.Write = write
+	c.info.Seq = e.Seq
+	c.routed = true
+	r.countCountry(c.info)
+	go c.startReading(time.Second * 20)
+	go c.startWriteHandler(jitter(time.Second*5, r.config.PingJitter, id), r.config.MaxConnectionLifetime)
+}
+
+// countCountry 记录并统计客户端所在的国家，未配置数据库时不做任何事
+func (r *Rooms) countCountry(info ClientInfo) {
+	if r.geoIP == nil {
+		return
+	}
+	country := r.geoIP.Country(info.Addr)
+	if country == "" {
+		country = "unknown"
+	}
+	connectionsByCountry.WithLabelValues(country).Inc()
+	log.Debug().Str("id", info.ID.String()).Str("country", country).Msg("WebSocket country")
 }
 
 // Start 启动房间管理器的主循环
-// 处理来自客户端的所有消息
-func (r *Rooms) Start() {
-	for msg := range r.Incoming {
-		// 检查客户端是否已连接
-		_, connected := r.connected[msg.Info.ID]
-		if !msg.SkipConnectedCheck && !connected {
-			log.Debug().Interface("event", fmt.Sprintf("%T", msg.Incoming)).Interface("payload", msg.Incoming).Msg("WebSocket Ignore")
+// 处理来自客户端的所有消息，直到ctx被取消
+// 取消后立即返回，正在处理的消息会处理完，之后的消息不再被接收：
+// 发送方通过done通道得知循环已停止并丢弃消息。
+// Incoming通道不会被关闭，因为客户端协程可能仍在向其发送，关闭会导致panic。
+// 配置了多个分片时，其他分片的循环在各自的协程中运行，同样在ctx取消后停止。
+// TURN地址在后台定期刷新，同样在ctx取消后停止。
+func (r *Rooms) Start(ctx context.Context) {
+	go r.turnAddrs.refresh(ctx, r.config.TurnIPProvider, turnIPRefreshInterval)
+	for _, shard := range r.shards[1:] {
+		go shard.loop(ctx)
+	}
+	r.loop(ctx)
+}
+
+// maxCoalescedEvents 是合并房间信息通知时最多连续处理的事件数
+const maxCoalescedEvents = 64
+
+// loop 运行单个分片的事件循环
+// 房间信息的通知在队列为空或连续处理maxCoalescedEvents个事件后才发送，
+// 因此短时间内的多次更改（例如多个用户同时加入）只广播一次最终状态
+func (r *Rooms) loop(ctx context.Context) {
+	defer close(r.done)
+	var reap <-chan time.Time
+	if limit := r.config.CloseRoomWhenNoStreamFor; limit > 0 {
+		ticker := time.NewTicker(reapInterval(limit))
+		defer ticker.Stop()
+		reap = ticker.C
+	}
+	processed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-reap:
+			r.closeIdleRooms(now)
+		case msg := <-r.Incoming:
+			r.handle(msg)
+			eventQueueLength.Set(float64(r.queueLength()))
+			processed++
+			if len(r.Incoming) == 0 || processed >= maxCoalescedEvents {
+				r.flushChanged()
+				processed = 0
+			}
+		}
+	}
+}
+
+// reapInterval 返回检查空闲房间的间隔，为限制的十分之一，在1秒到1分钟之间
+func reapInterval(limit time.Duration) time.Duration {
+	return min(max(limit/10, time.Second), time.Minute)
+}
+
+// isReserved 返回id是否是配置的保留房间
+func (r *Rooms) isReserved(id string) bool {
+	for _, reserved := range r.config.ReservedRooms {
+		if r.normalizeRoomID(reserved) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// createReserved 创建一个没有用户的保留房间
+// 保留房间没有房主，房主离开时也不会关闭
+func (r *Rooms) createReserved(id string) *Room {
+	room := &Room{
+		ID:                id,
+		CloseOnOwnerLeave: false,
+		Mode:              ConnectionMode(r.config.ReservedRoomMode),
+		Users:             map[xid.ID]*User{},
+		Sessions:          map[xid.ID]*RoomSession{},
+		lastStream:        time.Now(),
+		created:           time.Now(),
+		reserved:          true,
+		welcome:           r.config.ReservedRoomWelcome,
+	}
+	r.Rooms[id] = room
+	roomsCreatedTotal.Inc()
+	return room
+}
+
+// closeIdleRooms 关闭超过CloseRoomWhenNoStreamFor没有用户共享的房间，保留房间除外
+func (r *Rooms) closeIdleRooms(now time.Time) {
+	limit := r.config.CloseRoomWhenNoStreamFor
+	for id, room := range r.Rooms {
+		if room.reserved || room.streaming() || now.Sub(room.lastStream) < limit {
 			continue
 		}
+		log.Info().Str("room", id).Dur("idle", now.Sub(room.lastStream)).Msg("Closing room without stream")
+		for _, member := range room.Users {
+			delete(r.connected, member.ID)
+			member.Write(outgoing.CloseWriter{Code: websocket.CloseNormalClosure, Reason: CloseNoStream})
+		}
+		r.closeRoom(id)
+	}
+}
+
+// markChanged 标记房间信息已更改，用户会在flushChanged时收到一次更新
+func (r *Rooms) markChanged(room *Room) {
+	if room.changed {
+		return
+	}
+	room.changed = true
+	r.changed = append(r.changed, room)
+}
+
+// flushChanged 向所有已更改房间的用户发送最新的房间信息，已关闭的房间被跳过
+func (r *Rooms) flushChanged() {
+	for _, room := range r.changed {
+		room.changed = false
+		if r.Rooms[room.ID] == room {
+			room.notifyInfoChanged()
+			room.sendPending()
+		}
+	}
+	clear(r.changed)
+	r.changed = r.changed[:0]
+}
+
+// queueLength 返回所有分片中等待处理的消息总数
+func (r *Rooms) queueLength() int {
+	length := 0
+	for _, shard := range r.shards {
+		length += len(shard.Incoming)
+	}
+	return length
+}
+
+// handle 处理单条客户端消息，处理后事件被放回对象池
+func (r *Rooms) handle(msg ClientMessage) {
+	defer releaseEvent(msg.Incoming)
+
+	// 检查客户端是否已连接
+	_, connected := r.connected[msg.Info.ID]
+	if !msg.SkipConnectedCheck && !connected {
+		log.Debug().Str("event", msg.Incoming.Type()).Interface("payload", msg.Incoming).Msg("WebSocket Ignore")
+		return
+	}
+
+	// 用户和房间字段由钩子在输出日志时才添加，避免为每条消息创建子日志
+	r.eventLog = eventLogHook{rooms: r, user: msg.Info.ID, event: msg.Incoming}
+	defer func() { r.eventLog = eventLogHook{} }()
+	logger := log.Logger.Hook(&r.eventLog)
+
+	// 执行事件处理
+	if err := msg.Incoming.Execute(r, msg.Info, logger); err != nil {
+		logger.Debug().Err(err).Str("event", msg.Incoming.Type()).Msg("Event failed")
+		// 如果处理出错，断开客户端连接
+		dis := Disconnected{Code: websocket.CloseNormalClosure, Reason: err.Error()}
+		dis.executeNoError(r, msg.Info)
+	}
+}
 
-		// 执行事件处理
-		if err := msg.Incoming.Execute(r, msg.Info); err != nil {
-			// 如果处理出错，断开客户端连接
-			dis := Disconnected{Code: websocket.CloseNormalClosure, Reason: err.Error()}
-			dis.executeNoError(r, msg.Info)
+// eventLogHook 为处理事件时输出的日志添加用户和房间字段
+// 只在主循环处理事件期间使用，输出日志时才查找用户所在的房间
+type eventLogHook struct {
+	rooms *Rooms
+	user  xid.ID
+	event Event
+}
+
+// Run 实现zerolog.Hook接口
+// 用户还不在房间中时，创建和加入事件使用请求的房间ID
+func (h *eventLogHook) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	room := h.rooms.connected[h.user]
+	if room == "" {
+		switch event := h.event.(type) {
+		case *Create:
+			room = event.ID
+		case *Join:
+			room = event.ID
 		}
 	}
+	e.Str("user", h.user.String()).Str("room", room)
 }
 
-// Count 获取当前房间数量
-// 通过健康检查事件获取房间数量，带有超时处理
+// Count 获取当前连接数量
+// 向每个分片发送健康检查事件并汇总结果，带有超时处理
 // 返回:
-// - 房间数量和可能的错误消息
+// - 连接数量和可能的错误消息
 func (r *Rooms) Count() (int, string) {
 	timeout := time.After(5 * time.Second)
 
-	// 创建健康检查事件
-	h := Health{Response: make(chan int, 1)}
+	// 先向所有分片发送健康检查事件，使各分片并行处理
+	responses := make([]chan int, 0, len(r.shards))
+	for _, shard := range r.shards {
+		h := Health{Response: make(chan int, 1)}
+		select {
+		case shard.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: &h}:
+		case <-shard.done:
+			return -1, "main loop stopped"
+		case <-timeout:
+			return -1, "main loop didn't accept a message within 5 second"
+		}
+		responses = append(responses, h.Response)
+	}
+	count := 0
+	for _, response := range responses {
+		select {
+		case c := <-response:
+			count += c
+		case <-timeout:
+			return -1, "main loop didn't respond to a message within 5 second"
+		}
+	}
+	return count, ""
+}
+
+// ConnectedCount 返回打开的WebSocket连接数
+// 与Count不同，不需要主循环响应，主循环阻塞时也能立即返回
+func (r *Rooms) ConnectedCount() int {
+	return int(r.clients.Load())
+}
+
+// Stats 获取所有房间的状态
+// 向每个分片发送事件并合并结果，房间按ID排序
+func (r *Rooms) Stats() ([]RoomStats, string) {
+	timeout := time.After(5 * time.Second)
+
+	responses := make([]chan []RoomStats, 0, len(r.shards))
+	for _, shard := range r.shards {
+		e := Stats{Response: make(chan []RoomStats, 1)}
+		select {
+		case shard.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: &e}:
+		case <-shard.done:
+			return nil, "main loop stopped"
+		case <-timeout:
+			return nil, "main loop didn't accept a message within 5 second"
+		}
+		responses = append(responses, e.Response)
+	}
+	stats := []RoomStats{}
+	for _, response := range responses {
+		select {
+		case s := <-response:
+			stats = append(stats, s...)
+		case <-timeout:
+			return nil, "main loop didn't respond to a message within 5 second"
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ID < stats[j].ID
+	})
+	return stats, ""
+}
+
+// Drain 通知房间的成员重新连接并在短暂的等待后关闭房间
+// 返回房间是否存在，以及主循环没有响应时的错误
+func (r *Rooms) Drain(id string) (bool, string) {
+	shard := r.shardFor(id)
+	e := Drain{ID: id, Response: make(chan bool, 1)}
 	select {
-	case r.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: &h}:
-	case <-timeout:
-		return -1, "main loop didn't accept a message within 5 second"
+	case shard.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: &e}:
+	case <-shard.done:
+		return false, "main loop stopped"
+	case <-time.After(5 * time.Second):
+		return false, "main loop didn't accept a message within 5 second"
 	}
 	select {
-	case count := <-h.Response:
-		return count, ""
-	case <-timeout:
-		return -1, "main loop didn't respond to a message within 5 second"
+	case found := <-e.Response:
+		return found, ""
+	case <-time.After(5 * time.Second):
+		return false, "main loop didn't respond to a message within 5 second"
+	}
+}
+
+// overloaded 返回是否应拒绝新连接
+// 队列长度达到高水位时开始拒绝，降到低水位以下才恢复，避免在阈值附近反复切换
+func (r *Rooms) overloaded() bool {
+	if cap(r.Incoming) == 0 {
+		return false
+	}
+	high, low := r.waterMarks()
+	length := len(r.Incoming)
+	if r.shedding.Load() {
+		if length < low && r.shedding.CompareAndSwap(true, false) {
+			log.Info().Int("length", length).Int("lowWater", low).Msg("Event queue recovered, accepting WebSocket upgrades again")
+		}
+		return r.shedding.Load()
+	}
+	if length >= high && r.shedding.CompareAndSwap(false, true) {
+		log.Warn().Int("length", length).Int("highWater", high).Msg("Event queue reached the high-water mark, rejecting WebSocket upgrades")
 	}
+	return r.shedding.Load()
+}
+
+// waterMarks 根据队列容量和配置的百分比计算高水位和低水位
+// 未配置时高水位是队列容量，低水位等于高水位
+func (r *Rooms) waterMarks() (high, low int) {
+	capacity := cap(r.Incoming)
+	high = capacity
+	if percent := r.config.EventQueueHighWaterPercent; percent > 0 {
+		high = max(1, capacity*percent/100)
+	}
+	low = high
+	if percent := r.config.EventQueueLowWaterPercent; percent > 0 {
+		low = min(high, max(1, capacity*percent/100))
+	}
+	return high, low
+}
+
+// TurnHealthy 返回TURN服务器是否健康，没有TURN服务器时视为健康
+func (r *Rooms) TurnHealthy() bool {
+	return r.turnServer == nil || r.turnServer.Healthy()
 }
 
 // closeRoom 关闭并删除一个房间
@@ -179,10 +726,22 @@ func (r *Rooms) closeRoom(roomID string) {
 	}
 	// 更新用户离开计数
 	usersLeftTotal.Add(float64(len(room.Users)))
+	for _, user := range room.Users {
+		room.observeLeave(user)
+	}
+	roomLifetimeSeconds.WithLabelValues(string(room.Mode)).Observe(time.Since(room.created).Seconds())
 	// 关闭房间中的所有会话
 	for id := range room.Sessions {
 		room.closeSession(r, id)
 	}
+	// 清理可能遗留的TURN凭证，例如会话在撤销凭证前已被移除
+	if room.Mode == ConnectionTURN {
+		for id, last := range room.turnSessions {
+			for generation := 0; generation <= last; generation++ {
+				r.revokeTurn(id, generation)
+			}
+		}
+	}
 
 	// 从房间映射中删除房间
 	delete(r.Rooms, roomID)
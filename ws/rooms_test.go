@@ -1,15 +1,29 @@
 package ws
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/AsterZephyr/Scree-go-AZlearn/auth"
+	"github.com/AsterZephyr/Scree-go-AZlearn/config"
+	"github.com/AsterZephyr/Scree-go-AZlearn/util"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
 )
 
 const SERVER = "ws://localhost:5050/stream"
@@ -40,6 +54,307 @@ func TestMultipleClients(t *testing.T) {
 	wg.Wait()
 }
 
+func TestStart_stopsOnCancel(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.Incoming = make(chan ClientMessage)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		rooms.Start(ctx)
+		close(stopped)
+	}()
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return after cancel")
+	}
+
+	count, err := rooms.Count()
+	assert.Equal(t, -1, count)
+	assert.Equal(t, "main loop stopped", err)
+}
+
+func TestICEURLs_region(t *testing.T) {
+	_, eu, _ := net.ParseCIDR("10.10.0.0/16")
+	rooms := newTestRooms()
+	rooms.config.TurnPorts = []string{"3478"}
+	rooms.config.TurnRegionsParsed = []config.TurnRegion{{Name: "eu", Host: "turn-eu.example.com", Networks: []*net.IPNet{eu}}}
+
+	v4 := net.ParseIP("192.0.2.1")
+	assert.Equal(t, []string{"turn:turn-eu.example.com:3478", "turn:turn-eu.example.com:3478?transport=tcp"},
+		rooms.iceURLs("turn", net.ParseIP("10.10.1.1"), v4, nil, true))
+	assert.Equal(t, []string{"turn:192.0.2.1:3478", "turn:192.0.2.1:3478?transport=tcp"},
+		rooms.iceURLs("turn", net.ParseIP("10.20.1.1"), v4, nil, true))
+}
+
+func TestAddresses_multiplePorts(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.config.TurnPorts = []string{"3478", "443"}
+
+	assert.Equal(t, []string{
+		"turn:192.0.2.1:3478", "turn:192.0.2.1:3478?transport=tcp",
+		"turn:[2001:db8::1]:3478", "turn:[2001:db8::1]:3478?transport=tcp",
+		"turn:192.0.2.1:443", "turn:192.0.2.1:443?transport=tcp",
+		"turn:[2001:db8::1]:443", "turn:[2001:db8::1]:443?transport=tcp",
+	}, rooms.addresses("turn", net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1"), true))
+}
+
+func TestAddresses_explicitUDP(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.config.TurnPorts = []string{"3478"}
+	rooms.config.TurnExplicitUDP = true
+
+	turn := rooms.addresses("turn", net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1"), true)
+	assert.Equal(t, []string{
+		"turn:192.0.2.1:3478?transport=udp", "turn:192.0.2.1:3478?transport=tcp",
+		"turn:[2001:db8::1]:3478?transport=udp", "turn:[2001:db8::1]:3478?transport=tcp",
+	}, turn)
+	assert.Equal(t, []string{"stun:192.0.2.1:3478"}, rooms.addresses("stun", net.ParseIP("192.0.2.1"), nil, false))
+
+	for i, raw := range turn {
+		u, err := url.Parse(raw)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "turn", u.Scheme)
+			assert.Equal(t, []string{"udp", "tcp"}[i%2], u.Query().Get("transport"))
+		}
+	}
+}
+
+func TestUniqueRoomName_collision(t *testing.T) {
+	rooms := newTestRooms()
+	single := util.NewWordList([]string{"brave"})
+	rooms.names = util.Names{Adjectives: single, Colors: single, Nouns: single}
+
+	first := rooms.uniqueRoomName()
+	assert.Equal(t, "brave-brave-brave", first)
+	rooms.Rooms[first] = &Room{ID: first}
+
+	second := rooms.uniqueRoomName()
+	assert.NotEqual(t, first, second)
+	assert.Regexp(t, `^brave-brave-brave-\d+$`, second)
+
+	owner := connectTestClient(rooms)
+	assert.NoError(t, (&Create{Mode: ConnectionLocal}).Execute(rooms, owner, zerolog.Nop()))
+	assert.Len(t, rooms.Rooms, 2, "create without id must not collide")
+}
+
+func TestRandNames_concurrent(t *testing.T) {
+	rooms := newTestRooms()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				_ = rooms.RandUserName()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				_ = rooms.RandRoomName()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWithSeed(t *testing.T) {
+	conf := config.Config{CheckOrigin: func(string) bool { return false }}
+	first := NewRooms(nil, nil, conf, WithSeed(42))
+	second := NewRooms(nil, nil, conf, WithSeed(42))
+
+	assert.Equal(t, first.RandRoomName(), second.RandRoomName())
+	assert.Equal(t, first.RandUserName(), second.RandUserName())
+}
+
+func TestUniqueRoomName_shards(t *testing.T) {
+	rooms := NewRooms(nil, nil, config.Config{EventLoopShards: 3}, WithSeed(1))
+	assert.Len(t, rooms.shards, 3)
+	for _, shard := range rooms.shards {
+		for i := 0; i < 20; i++ {
+			name := shard.uniqueRoomName()
+			assert.Same(t, shard, rooms.shardFor(name))
+			assert.Same(t, shard, shard.shardFor(name))
+		}
+	}
+}
+
+func TestUpgrade_maxConnectionLifetime(t *testing.T) {
+	conf := config.Config{
+		CheckOrigin:           func(string) bool { return true },
+		SessionCookieName:     "user",
+		MaxConnectionLifetime: 100 * time.Millisecond,
+	}
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: conf.SessionCookieName})
+	assert.NoError(t, err)
+	rooms := NewRooms(nil, users, conf)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rooms.Start(ctx)
+
+	srv := httptest.NewServer(http.HandlerFunc(rooms.Upgrade))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err = conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+}
+
+func TestConnectedCount_withoutLoop(t *testing.T) {
+	conf := config.Config{
+		CheckOrigin:       func(string) bool { return true },
+		SessionCookieName: "user",
+		EventQueueSize:    10,
+	}
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: conf.SessionCookieName})
+	assert.NoError(t, err)
+	// the loop isn't started, counting must not depend on it
+	rooms := NewRooms(nil, users, conf)
+
+	srv := httptest.NewServer(http.HandlerFunc(rooms.Upgrade))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer first.Close()
+	second, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Eventually(t, func() bool { return rooms.ConnectedCount() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	second.Close()
+	assert.Eventually(t, func() bool { return rooms.ConnectedCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestUpgrade_invalidResumeToken(t *testing.T) {
+	conf := config.Config{
+		CheckOrigin:       func(string) bool { return true },
+		SessionCookieName: "user",
+		DisconnectGrace:   time.Minute,
+	}
+	users, err := auth.ReadPasswordsFile("", []byte("secret"), 0, false, auth.CookieOptions{Name: conf.SessionCookieName})
+	assert.NoError(t, err)
+	rooms := NewRooms(nil, users, conf)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rooms.Start(ctx)
+
+	srv := httptest.NewServer(http.HandlerFunc(rooms.Upgrade))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?room=room&resume=token", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), err)
+}
+
+func TestUpgrade_rejectsWhenQueueFull(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.Incoming = make(chan ClientMessage, 1)
+	rooms.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: &Health{Response: make(chan int, 1)}}
+
+	rec := httptest.NewRecorder()
+	rooms.Upgrade(rec, httptest.NewRequest("GET", "/stream", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get("Retry-After"))
+	body := UpgradeError{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, "overloaded", body.Code)
+}
+
+func TestUpgrade_shedsLoadWithHysteresis(t *testing.T) {
+	rooms := newTestRooms()
+	rooms.config.EventQueueHighWaterPercent = 75
+	rooms.config.EventQueueLowWaterPercent = 50
+	rooms.Incoming = make(chan ClientMessage, 4)
+	fill := func(n int) {
+		for len(rooms.Incoming) < n {
+			rooms.Incoming <- ClientMessage{SkipConnectedCheck: true, Incoming: &Health{Response: make(chan int, 1)}}
+		}
+		for len(rooms.Incoming) > n {
+			<-rooms.Incoming
+		}
+	}
+
+	fill(2)
+	assert.False(t, rooms.overloaded())
+
+	before := testutil.ToFloat64(eventQueueRejectedTotal)
+	fill(3)
+	rec := httptest.NewRecorder()
+	rooms.Upgrade(rec, httptest.NewRequest("GET", "/stream", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(eventQueueRejectedTotal))
+
+	// 低水位是2，队列长度降到2时仍然拒绝
+	fill(2)
+	assert.True(t, rooms.overloaded())
+	fill(1)
+	assert.False(t, rooms.overloaded())
+	fill(2)
+	assert.False(t, rooms.overloaded())
+}
+
+func TestCheckOrigin_countsRejected(t *testing.T) {
+	conf := config.Config{CheckOrigin: func(origin string) bool { return origin == "https://allowed.example" }}
+	rooms := NewRooms(nil, nil, conf)
+
+	request := func(origin string) *http.Request {
+		req := httptest.NewRequest("GET", "http://screego.example/stream", nil)
+		req.Header.Set("Origin", origin)
+		return req
+	}
+
+	before := testutil.ToFloat64(originRejectedTotal)
+	assert.True(t, rooms.upgrader.CheckOrigin(request("https://screego.example")))
+	assert.True(t, rooms.upgrader.CheckOrigin(request("https://allowed.example")))
+	assert.Equal(t, before, testutil.ToFloat64(originRejectedTotal))
+
+	assert.False(t, rooms.upgrader.CheckOrigin(request("https://evil.example")))
+	assert.False(t, rooms.upgrader.CheckOrigin(request("://invalid")))
+	assert.Equal(t, before+2, testutil.ToFloat64(originRejectedTotal))
+}
+
+func TestUpgrade_failureResponse(t *testing.T) {
+	upgrade := func(detail bool) (int, UpgradeError) {
+		rooms := NewRooms(nil, nil, config.Config{UpgradeErrorDetail: detail})
+		rec := httptest.NewRecorder()
+		rooms.Upgrade(rec, httptest.NewRequest("GET", "/stream", nil))
+		body := UpgradeError{}
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		return rec.Code, body
+	}
+
+	status, body := upgrade(false)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, UpgradeError{Code: "bad_handshake", Message: "Bad Request"}, body)
+
+	status, body = upgrade(true)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "bad_handshake", body.Code)
+	assert.Contains(t, body.Detail, "websocket")
+}
+
 func testClient(i int64, room string) {
 	r := rand.New(rand.NewSource(i))
 	conn, _, err := websocket.DefaultDialer.Dial(SERVER, nil)
@@ -110,3 +425,25 @@ func msg(r *rand.Rand, room string) []byte {
 	}
 	return b
 }
+
+func TestHandle_logsUserAndRoom(t *testing.T) {
+	buf := &bytes.Buffer{}
+	previous := log.Logger
+	log.Logger = zerolog.New(buf)
+	defer func() { log.Logger = previous }()
+
+	rooms := newTestRooms()
+	owner := connectTestClient(rooms)
+	rooms.handle(ClientMessage{Info: owner, Incoming: &Create{ID: "room", Mode: ConnectionSTUN}})
+	assert.Empty(t, buf.String())
+
+	// the user isn't in a room yet, the room is taken from the event.
+	guest := connectTestClient(rooms)
+	rooms.handle(ClientMessage{Info: guest, Incoming: &Join{ID: "missing"}})
+	assert.Contains(t, buf.String(), `"user":"`+guest.ID.String()+`","room":"missing"`)
+	assert.Nil(t, rooms.eventLog.event)
+
+	buf.Reset()
+	rooms.handle(ClientMessage{Info: owner, Incoming: &Join{ID: "other"}})
+	assert.Contains(t, buf.String(), `"user":"`+owner.ID.String()+`","room":"room"`)
+}
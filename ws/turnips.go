@@ -0,0 +1,60 @@
+package ws
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/config/ipdns"
+	"github.com/rs/zerolog/log"
+)
+
+// turnIPRefreshInterval 是后台刷新TURN地址的间隔
+const turnIPRefreshInterval = 30 * time.Second
+
+// turnIPCache 保存上一次成功解析的TURN地址，所有分片共享同一个缓存，
+// 因此解析失败后所有分片使用相同的地址
+type turnIPCache struct {
+	lock   sync.Mutex
+	v4     net.IP
+	v6     net.IP
+	loaded bool // 是否至少成功解析过一次
+}
+
+// get 从provider获取TURN地址，失败时回退到上一次成功解析的地址
+// 只有在从未成功解析过时才返回错误
+func (c *turnIPCache) get(provider ipdns.Provider) (net.IP, net.IP, error) {
+	v4, v6, err := provider.Get()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err == nil {
+		c.v4, c.v6, c.loaded = v4, v6, true
+		return v4, v6, nil
+	}
+	if !c.loaded {
+		return nil, nil, err
+	}
+	log.Warn().Err(err).
+		Str("v4", c.v4.String()).
+		Str("v6", c.v6.String()).
+		Msg("Could not get TURN IPs, using last known IPs")
+	return c.v4, c.v6, nil
+}
+
+// refresh 定期获取TURN地址直到ctx被取消，地址变化不依赖于新的房间或共享
+func (c *turnIPCache) refresh(ctx context.Context, provider ipdns.Provider, interval time.Duration) {
+	if provider == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _, _ = c.get(provider)
+		}
+	}
+}
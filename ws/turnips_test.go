@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingProvider 返回设置的地址或错误
+type failingProvider struct {
+	lock sync.Mutex
+	v4   net.IP
+	err  error
+}
+
+func (p *failingProvider) Get() (net.IP, net.IP, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.err != nil {
+		return nil, nil, p.err
+	}
+	return p.v4, nil, nil
+}
+
+func (p *failingProvider) Refresh() (net.IP, net.IP, error) {
+	return p.Get()
+}
+
+func (p *failingProvider) set(v4 net.IP, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.v4, p.err = v4, err
+}
+
+func TestTurnIPs_fallsBackToLastKnownIPs(t *testing.T) {
+	provider := &failingProvider{err: errors.New("dns timeout")}
+	rooms := NewRooms(nil, nil, config.Config{EventLoopShards: 4, TurnIPProvider: provider})
+
+	_, _, err := rooms.turnIPs()
+	assert.Error(t, err, "no fallback before the first successful resolution")
+
+	provider.set(net.ParseIP("192.0.2.1"), nil)
+	v4, _, err := rooms.shards[1].turnIPs()
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", v4.String())
+
+	provider.set(nil, errors.New("dns timeout"))
+	for _, shard := range rooms.shards {
+		v4, _, err := shard.turnIPs()
+		assert.NoError(t, err)
+		assert.Equal(t, "192.0.2.1", v4.String(), "all shards share the last known ips")
+	}
+}
+
+func TestTurnIPCache_refresh(t *testing.T) {
+	provider := &failingProvider{v4: net.ParseIP("192.0.2.1")}
+	cache := &turnIPCache{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cache.refresh(ctx, provider, time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		cache.lock.Lock()
+		defer cache.lock.Unlock()
+		return cache.loaded && cache.v4.Equal(net.ParseIP("192.0.2.1"))
+	}, time.Second, time.Millisecond, "the cache is filled without a request")
+
+	provider.set(net.ParseIP("192.0.2.2"), nil)
+	assert.Eventually(t, func() bool {
+		cache.lock.Lock()
+		defer cache.lock.Unlock()
+		return cache.v4.Equal(net.ParseIP("192.0.2.2"))
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,68 @@
+package ws
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// TURN用户名中的角色
+const (
+	turnRoleHost   = "host"
+	turnRoleClient = "client"
+)
+
+// DefaultTurnUsernameFormat 是默认的TURN用户名格式，会话ID后接角色
+const DefaultTurnUsernameFormat = "{session}{role}"
+
+// TurnUsername 根据会话ID和角色组合TURN用户名
+// 同一会话和角色必须总是返回相同的用户名，关闭会话时据此撤销凭证
+type TurnUsername func(session xid.ID, role string) string
+
+// FormatTurnUsername 返回按format组合用户名的TurnUsername
+// 支持的占位符：{session} 会话ID，{role} 角色，{time} 会话创建时的Unix时间戳
+// format为空时使用DefaultTurnUsernameFormat
+func FormatTurnUsername(format string) TurnUsername {
+	if format == "" {
+		format = DefaultTurnUsernameFormat
+	}
+	return func(session xid.ID, role string) string {
+		return strings.NewReplacer(
+			"{session}", session.String(),
+			"{role}", role,
+			"{time}", strconv.FormatInt(session.Time().Unix(), 10),
+		).Replace(format)
+	}
+}
+
+// turnRole 返回第generation代凭证中角色在TURN用户名中的名称，例如host2
+func turnRole(role string, generation int) string {
+	if generation == 0 {
+		return role
+	}
+	return role + strconv.Itoa(generation)
+}
+
+// revokeTurn 撤销会话第generation代的主机和客户端凭证
+func (r *Rooms) revokeTurn(session xid.ID, generation int) {
+	r.turnServer.Disallow(r.turnUsername(session, turnRole(turnRoleHost, generation)))
+	r.turnServer.Disallow(r.turnUsername(session, turnRole(turnRoleClient, generation)))
+}
+
+// revokeTurnLater 在grace后撤销会话中角色第generation代的凭证，续签后旧的连接在此期间仍可使用
+// 会话关闭时会撤销所有代的凭证，因此这里不需要检查会话是否仍然存在
+func (r *Rooms) revokeTurnLater(session xid.ID, role string, generation int, grace time.Duration) {
+	time.AfterFunc(grace, func() {
+		r.turnServer.Disallow(r.turnUsername(session, turnRole(role, generation)))
+	})
+}
+
+// turnUsername 返回会话中角色的TURN用户名，未配置时使用默认格式
+func (r *Rooms) turnUsername(session xid.ID, role string) string {
+	if r.turnNames == nil {
+		return FormatTurnUsername("")(session, role)
+	}
+	return r.turnNames(session, role)
+}
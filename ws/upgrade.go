@@ -0,0 +1,47 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// UpgradeError 是WebSocket升级失败时返回给客户端的响应
+type UpgradeError struct {
+	Code    string `json:"code"`             // 机器可读的错误代码
+	Message string `json:"message"`          // 简短的错误描述
+	Detail  string `json:"detail,omitempty"` // 内部错误详情，只在配置了SCREEGO_UPGRADE_ERROR_DETAIL时返回
+}
+
+// upgradeErrorCodes 将握手失败的HTTP状态码映射为错误代码
+var upgradeErrorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_handshake",
+	http.StatusForbidden:           "origin_rejected",
+	http.StatusMethodNotAllowed:    "method_not_allowed",
+	http.StatusInternalServerError: "upgrade_failed",
+}
+
+// upgradeError 是websocket.Upgrader的错误处理函数
+// 详细错误只记录在服务端日志中，避免向客户端泄露内部信息
+func (r *Rooms) upgradeError(w http.ResponseWriter, req *http.Request, status int, reason error) {
+	log.Debug().Err(reason).Int("status", status).Msg("Websocket upgrade")
+	code, ok := upgradeErrorCodes[status]
+	if !ok {
+		code = "upgrade_failed"
+	}
+	w.Header().Set("Sec-Websocket-Version", "13")
+	r.writeUpgradeError(w, status, code, reason)
+}
+
+// writeUpgradeError 写入JSON格式的升级失败响应
+func (r *Rooms) writeUpgradeError(w http.ResponseWriter, status int, code string, reason error) {
+	body := UpgradeError{Code: code, Message: http.StatusText(status)}
+	if r.config.UpgradeErrorDetail && reason != nil {
+		body.Detail = reason.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
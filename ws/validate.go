@@ -0,0 +1,46 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/AsterZephyr/Scree-go-AZlearn/ws/outgoing"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+// validateSID 校验点对点消息是否包含会话ID
+func validateSID(sid xid.ID) error {
+	if sid.IsNil() {
+		return errors.New("sid must be set")
+	}
+	return nil
+}
+
+// sdpTooLarge 检查会话描述是否超过配置的大小上限
+// 超过时通知发送方并返回true，调用方不再转发该消息，连接保持打开
+func sdpTooLarge(rooms *Rooms, current ClientInfo, sid xid.ID, value json.RawMessage, logger zerolog.Logger) bool {
+	limit := rooms.config.MaxSDPBytes
+	if limit <= 0 || len(value) <= limit {
+		return false
+	}
+	logger.Debug().Str("id", sid.String()).Int("size", len(value)).Int("limit", limit).Msg("session description too large")
+	current.Write.push(outgoing.Error{Message: fmt.Sprintf("session description of session %s exceeds the maximum of %d bytes", sid, limit)})
+	return true
+}
+
+// validateSDP 校验会话描述是否包含type和sdp字段
+func validateSDP(value json.RawMessage) error {
+	desc := struct {
+		Type string `json:"type"`
+		SDP  string `json:"sdp"`
+	}{}
+	if err := json.Unmarshal(value, &desc); err != nil {
+		return fmt.Errorf("malformed session description: %s", err)
+	}
+	if desc.Type == "" || desc.SDP == "" {
+		return errors.New("session description must contain type and sdp")
+	}
+	return nil
+}